@@ -3,6 +3,7 @@ package b2c
 import (
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/bobappleyard/goose/bc"
 )
@@ -101,6 +102,27 @@ func stepCode(c *converter, s bc.Step) string {
 	case bc.Call:
 		return fmt.Sprintf("CZ_CALL(%d, %d)", s.Start, s.Argc)
 
+	case bc.PushInt:
+		return fmt.Sprintf("CZ_PUSH_INT(%d)", s.Value)
+
+	case bc.PushPrim:
+		return fmt.Sprintf("CZ_PUSH_%s(%d)", strings.ToUpper(s.Op.String()), s.Start)
+
+	case bc.PushCon:
+		if s.Argc == 0 {
+			return fmt.Sprintf("CZ_PUSH_TAG(%d)", s.Tag)
+		}
+		return fmt.Sprintf("CZ_PUSH_CON(%d, %d, %d)", s.Tag, s.Start, s.Argc)
+
+	case bc.Switch:
+		return fmt.Sprintf("CZ_SWITCH(%d, %d)", s.Start, s.Argc)
+
+	case bc.PushRec:
+		return fmt.Sprintf("CZ_PUSH_REC(%d)", s.Var)
+
+	case bc.Tie:
+		return fmt.Sprintf("CZ_TIE(%d, %d)", s.Start, s.Count)
+
 	}
 
 	panic("unreachable")
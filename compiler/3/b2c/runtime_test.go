@@ -0,0 +1,23 @@
+package b2c
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestRuntime compiles and runs the tests of the C runtime, if there is a C compiler.
+func TestRuntime(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	bin := filepath.Join(t.TempDir(), "tie_test")
+	out, err := exec.Command(cc, "-Wall", "-o", bin, "../test/tie_test.c", "../test/cz_tie.c").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if out, err := exec.Command(bin).CombinedOutput(); err != nil {
+		t.Errorf("%v\n%s", err, out)
+	}
+}
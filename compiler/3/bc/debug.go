@@ -0,0 +1,174 @@
+package bc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errNoBlock = errors.New("no such block")
+var errFinished = errors.New("program has finished")
+
+// Debugger runs a program on the same machine as Eval, but a step at a time, so that its state can be
+// inspected as it goes.
+type Debugger struct {
+	m       *machine
+	breaks  map[int]bool
+	effects map[string]bool
+}
+
+// State is a snapshot of the machine between steps.
+type State struct {
+	// Block is the block being executed and Next is the index of the step that runs next. Between
+	// calls, Block is -1 and Fn is about to be called with Args.
+	Block int
+	Next  int
+	Fn    prim.Value
+
+	// Args are the arguments to the call, or those bound by the block. Extra are those that the block
+	// passes on when it transfers control.
+	Args  []prim.Value
+	Extra []prim.Value
+
+	// Free are the values of the block's free variables, and Frame the values it has pushed.
+	Free  []prim.Value
+	Frame []prim.Value
+
+	Globals []prim.Value
+
+	// Meta is the runtime's meta-continuation, the most recent frame last.
+	Meta []cps.Frame
+}
+
+// NewDebugger prepares p to be run, with host handling the effects that p does not, as EvalHost
+// does. Nothing is executed until the debugger is told to step.
+func NewDebugger(p Program, host cps.Host) (*Debugger, error) {
+	m, err := newMachine(p, host)
+	if err != nil {
+		return nil, err
+	}
+	return &Debugger{m: m, breaks: map[int]bool{}, effects: map[string]bool{}}, nil
+}
+
+// Break sets a breakpoint that stops the debugger on entering the block given.
+func (d *Debugger) Break(block int) error {
+	if block < 0 || block >= len(d.m.prog.Blocks) {
+		return fmt.Errorf("%w: %d", errNoBlock, block)
+	}
+	d.breaks[block] = true
+	return nil
+}
+
+func (d *Debugger) Clear(block int) {
+	delete(d.breaks, block)
+}
+
+// BreakEffect sets a breakpoint that stops the debugger just before the effect given is looked up
+// in the handler object, which is when a program signals it. Signals that call a clause directly are
+// not seen, so programs should be converted with h2c.ConvertExprForDebugger.
+func (d *Debugger) BreakEffect(effect string) {
+	d.effects["."+effect] = true
+}
+
+func (d *Debugger) ClearEffect(effect string) {
+	delete(d.effects, "."+effect)
+}
+
+// Breakpoints lists the blocks that have breakpoints, in order.
+func (d *Debugger) Breakpoints() []int {
+	blocks := make([]int, 0, len(d.breaks))
+	for b := range d.breaks {
+		blocks = append(blocks, b)
+	}
+	sort.Ints(blocks)
+	return blocks
+}
+
+// Done reports whether the program has finished, and if so what its result was.
+func (d *Debugger) Done() (prim.Value, bool) {
+	return d.m.rt.Done()
+}
+
+// Step executes a single step or, between blocks, makes the call that is waiting.
+func (d *Debugger) Step() error {
+	if _, done := d.Done(); done {
+		return errFinished
+	}
+	return d.m.step()
+}
+
+// EffectBreakpoints lists the effects that have breakpoints, in order.
+func (d *Debugger) EffectBreakpoints() []string {
+	effects := make([]string, 0, len(d.effects))
+	for e := range d.effects {
+		effects = append(effects, e[1:])
+	}
+	sort.Strings(effects)
+	return effects
+}
+
+// Continue runs the program until it finishes, enters a block with a breakpoint or signals an
+// effect with one.
+func (d *Debugger) Continue() error {
+	for {
+		if err := d.Step(); err != nil {
+			return err
+		}
+		if _, done := d.Done(); done {
+			return nil
+		}
+		if d.atBreakpoint() {
+			return nil
+		}
+	}
+}
+
+func (d *Debugger) atBreakpoint() bool {
+	if a := d.m.act; a != nil {
+		return a.next == 0 && d.breaks[a.closure.block]
+	}
+	b, ok := d.m.fn.(*cps.Builtin)
+	return ok && d.effects[b.String()]
+}
+
+// State takes a snapshot of the machine.
+func (d *Debugger) State() State {
+	m := d.m
+	s := State{
+		Block:   -1,
+		Globals: append([]prim.Value(nil), m.globals...),
+		Meta:    m.rt.Meta(),
+	}
+	a := m.act
+	if a == nil {
+		s.Fn = m.fn
+		s.Args = append([]prim.Value(nil), m.args...)
+		return s
+	}
+	s.Block = a.closure.block
+	s.Next = a.next
+	s.Args = append([]prim.Value(nil), a.args...)
+	s.Extra = append([]prim.Value(nil), a.extra...)
+	s.Free = append([]prim.Value(nil), a.closure.free...)
+	s.Frame = append([]prim.Value(nil), a.frame[:a.pos]...)
+	return s
+}
+
+// Describe writes a value for a debugger. Unlike their usual form, functions show the block that
+// they run.
+func Describe(v prim.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "<none>"
+
+	case *closure:
+		return fmt.Sprintf("<closure %d>", v.block)
+
+	case *cps.Builtin:
+		return fmt.Sprintf("<builtin %s>", v)
+	}
+	return v.String()
+}
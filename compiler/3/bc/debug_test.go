@@ -0,0 +1,74 @@
+package bc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/lc"
+	"github.com/bobappleyard/goose/prim"
+)
+
+// addOne calls a closure that adds one to 41.
+func addOne() Program {
+	k, x := lc.Var{Name: "k"}, lc.Var{Name: "x"}
+	return Program{
+		Blocks: []Block{
+			{
+				Bound:  []lc.Var{k},
+				Allocs: 4,
+				Steps:  []Step{PushBlock{ID: 1}, PushBound{Var: 0}, PushFn{Start: 0}, PushInt{Value: 41}, Call{Start: 2, Argc: 2}},
+			},
+			{
+				Free:   []lc.Var{k},
+				Bound:  []lc.Var{x},
+				Allocs: 4,
+				Steps:  []Step{PushBound{Var: 0}, PushInt{Value: 1}, PushFree{Var: 0}, PushPrim{Op: prim.Add, Start: 0, Argc: 2}, Call{Start: 2, Argc: 2}},
+			},
+		},
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	d, err := NewDebugger(addOne(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Break(2); !errors.Is(err, errNoBlock) {
+		t.Errorf("got %v, expecting %v", err, errNoBlock)
+	}
+	if err := d.Break(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := d.State(); s.Block != -1 || Describe(s.Fn) != "<closure 0>" {
+		t.Errorf("got %+v, expecting a call to block 0", s)
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	s := d.State()
+	if s.Block != 1 || s.Next != 0 || !reflect.DeepEqual(s.Args, []prim.Value{prim.Int(41)}) {
+		t.Errorf("got %+v, expecting the start of block 1", s)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := d.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s = d.State()
+	if s.Next != 4 || !reflect.DeepEqual(s.Frame[3], prim.Int(42)) {
+		t.Errorf("got %+v, expecting the sum to have been pushed", s)
+	}
+
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if v, done := d.Done(); !done || v != prim.Int(42) {
+		t.Errorf("got %v, %v, expecting 42", v, done)
+	}
+	if err := d.Step(); !errors.Is(err, errFinished) {
+		t.Errorf("got %v, expecting %v", err, errFinished)
+	}
+}
@@ -0,0 +1,72 @@
+package bc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bobappleyard/goose/lc"
+)
+
+// WriteDot writes p as a graph in the DOT language of Graphviz. Each block is a node, listing its
+// variables and steps. A block that builds a closure from another has an edge to it, labelled with
+// the variables that the closure captures.
+func WriteDot(w io.Writer, p Program) error {
+	var err error
+	printf := func(format string, args ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+
+	printf("digraph bc {\n")
+	printf("\tnode [shape=box, fontname=monospace];\n")
+	for i, b := range p.Blocks {
+		lines := []string{
+			fmt.Sprintf("%d: BLOCK", i),
+			"bound: " + varNames(b.Bound),
+			"free: " + varNames(b.Free),
+		}
+		for _, s := range b.Steps {
+			lines = append(lines, strings.Replace(fmt.Sprint(s), "\t", " ", -1))
+		}
+		printf("\tb%d [label=%s];\n", i, dotLines(lines))
+	}
+	for i, b := range p.Blocks {
+		for _, s := range b.Steps {
+			if s, ok := s.(PushBlock); ok {
+				printf("\tb%d -> b%d [label=%s];\n", i, s.ID, dotQuote(varNames(p.Blocks[s.ID].Free)))
+			}
+		}
+	}
+	printf("}\n")
+
+	return err
+}
+
+func varNames(vs []lc.Var) string {
+	names := make([]string, len(vs))
+	for i, v := range vs {
+		names[i] = v.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+var dotEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// dotQuote writes s as a string in the DOT language.
+func dotQuote(s string) string {
+	return `"` + dotEscape.Replace(s) + `"`
+}
+
+// dotLines writes lines as a left-justified string in the DOT language.
+func dotLines(lines []string) string {
+	var b strings.Builder
+	b.WriteString(`"`)
+	for _, l := range lines {
+		b.WriteString(dotEscape.Replace(l))
+		b.WriteString(`\l`)
+	}
+	b.WriteString(`"`)
+	return b.String()
+}
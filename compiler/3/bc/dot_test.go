@@ -0,0 +1,42 @@
+package bc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bobappleyard/goose/lc"
+)
+
+func TestWriteDot(t *testing.T) {
+	k, x := lc.Var{Name: "k"}, lc.Var{Name: "x"}
+	in := Program{
+		Globals: []lc.Var{{Name: "f"}},
+		Blocks: []Block{
+			{
+				Bound:  []lc.Var{k},
+				Allocs: 4,
+				Steps:  []Step{PushBlock{ID: 1}, PushBound{Var: 0}, PushGlobal{Var: 0}, PushFn{Start: 0}, Call{Start: 2, Argc: 2}},
+			},
+			{
+				Free:   []lc.Var{k},
+				Bound:  []lc.Var{x},
+				Allocs: 2,
+				Steps:  []Step{PushFree{Var: 0}, PushBound{Var: 0}, Call{Start: 0, Argc: 2}},
+			},
+		},
+	}
+	out := `digraph bc {
+	node [shape=box, fontname=monospace];
+	b0 [label="0: BLOCK\lbound: k\lfree: \lBLOCK 1\lBOUND 0\lGLOB 0\lFN 0\lCALL 2 2\l"];
+	b1 [label="1: BLOCK\lbound: x\lfree: k\lFREE 0\lBOUND 0\lCALL 0 2\l"];
+	b0 -> b1 [label="k"];
+}
+`
+	var b strings.Builder
+	if err := WriteDot(&b, in); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != out {
+		t.Errorf("got\n%s\nexpecting\n%s", b.String(), out)
+	}
+}
@@ -0,0 +1,241 @@
+package bc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errNotFunction = errors.New("not a function")
+var errNoMatch = errors.New("no matching arm")
+var errWrongArgCount = errors.New("wrong number of arguments")
+var errMalformed = errors.New("malformed program")
+
+// Eval runs p on a virtual machine that executes its steps directly. The first block is the program
+// itself, which takes the continuation of the whole program, and the runtime provides a continuation
+// that finishes it.
+func Eval(p Program) (prim.Value, error) {
+	return EvalHost(p, nil)
+}
+
+// EvalHost runs p as Eval does, with host handling the effects that p does not.
+func EvalHost(p Program, host cps.Host) (prim.Value, error) {
+	m, err := newMachine(p, host)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if v, done := m.rt.Done(); done {
+			return v, nil
+		}
+		if err := m.step(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func newMachine(p Program, host cps.Host) (*machine, error) {
+	m := &machine{prog: &p, globals: make([]prim.Value, len(p.Globals))}
+	m.rt.Host = host
+	for i, g := range p.Globals {
+		v, err := m.rt.Global(g.Name)
+		if err != nil {
+			return nil, err
+		}
+		m.globals[i] = v
+	}
+	if len(p.Blocks) == 0 {
+		return nil, fmt.Errorf("%w: no blocks", errMalformed)
+	}
+	m.Call(&closure{block: 0}, []prim.Value{m.rt.Return()})
+	return m, nil
+}
+
+type machine struct {
+	prog    *Program
+	rt      cps.Runtime
+	globals []prim.Value
+
+	// the call to make once the current one is complete
+	fn   prim.Value
+	args []prim.Value
+
+	// the block being executed, or nil between calls
+	act *activation
+}
+
+// activation is the state of a closure's block as it executes. Arguments beyond those that the block
+// binds are passed on when it transfers control.
+type activation struct {
+	closure *closure
+	args    []prim.Value
+	extra   []prim.Value
+	frame   []prim.Value
+	pos     int
+	next    int
+}
+
+// closure is a block together with the values of its free variables.
+type closure struct {
+	block int
+	free  []prim.Value
+}
+
+// blockRef is pushed by PushBlock, for PushFn to build a closure from.
+type blockRef struct {
+	id int
+}
+
+// recRef stands in for a recursive function until Tie replaces it.
+type recRef struct {
+	index int
+}
+
+func (c *closure) String() string {
+	return "<function>"
+}
+
+func (b blockRef) String() string {
+	return fmt.Sprintf("<block %d>", b.id)
+}
+
+func (r recRef) String() string {
+	return fmt.Sprintf("<rec %d>", r.index)
+}
+
+// Call arranges for f to be called with args once the current call is complete.
+func (m *machine) Call(f prim.Value, args []prim.Value) {
+	m.fn = f
+	m.args = args
+}
+
+// step either executes the next step of the current block or, between blocks, makes the call that is
+// waiting.
+func (m *machine) step() error {
+	if m.act != nil {
+		return m.exec()
+	}
+	f, args := m.fn, m.args
+	m.fn, m.args = nil, nil
+
+	switch f := f.(type) {
+	case *closure:
+		return m.enter(f, args)
+
+	case *cps.Builtin:
+		err := f.Call(m, args)
+		if errors.Is(err, cps.ErrSuspend) {
+			// the call is made again once the program is resumed
+			m.Call(f, args)
+		}
+		return err
+	}
+	return fmt.Errorf("%w: %s", errNotFunction, f)
+}
+
+func (m *machine) enter(c *closure, args []prim.Value) error {
+	b := m.prog.Blocks[c.block]
+	if len(args) < len(b.Bound) {
+		return fmt.Errorf("%w: expecting %d, got %d", errWrongArgCount, len(b.Bound), len(args))
+	}
+	m.act = &activation{
+		closure: c,
+		args:    args[:len(b.Bound)],
+		extra:   args[len(b.Bound):],
+		frame:   make([]prim.Value, b.Allocs),
+	}
+	return nil
+}
+
+func (a *activation) push(v prim.Value) {
+	a.frame[a.pos] = v
+	a.pos++
+}
+
+func (a *activation) slice(start, count int) []prim.Value {
+	vs := make([]prim.Value, count)
+	copy(vs, a.frame[start:start+count])
+	return vs
+}
+
+// exec runs the next step of the current block. The last step transfers control elsewhere.
+func (m *machine) exec() error {
+	a := m.act
+	b := m.prog.Blocks[a.closure.block]
+	if a.next == len(b.Steps) {
+		return fmt.Errorf("%w: block %d does not transfer control", errMalformed, a.closure.block)
+	}
+	s := b.Steps[a.next]
+	a.next++
+
+	switch s := s.(type) {
+	case PushBound:
+		a.push(a.args[s.Var])
+
+	case PushFree:
+		a.push(a.closure.free[s.Var])
+
+	case PushGlobal:
+		a.push(m.globals[s.Var])
+
+	case PushBlock:
+		a.push(blockRef{id: s.ID})
+
+	case PushFn:
+		ref, ok := a.frame[s.Start].(blockRef)
+		if !ok {
+			return fmt.Errorf("%w: expecting a block, got %s", errMalformed, a.frame[s.Start])
+		}
+		a.push(&closure{block: ref.id, free: a.slice(s.Start+1, len(m.prog.Blocks[ref.id].Free))})
+
+	case PushInt:
+		a.push(prim.Int(s.Value))
+
+	case PushPrim:
+		v, err := s.Op.Apply(a.slice(s.Start, s.Argc))
+		if err != nil {
+			return err
+		}
+		a.push(v)
+
+	case PushCon:
+		a.push(prim.Con{Tag: s.Tag, Fields: a.slice(s.Start, s.Argc)})
+
+	case PushRec:
+		a.push(recRef{index: s.Var})
+
+	case Tie:
+		for _, v := range a.frame[s.Start : s.Start+s.Count] {
+			f, ok := v.(*closure)
+			if !ok {
+				return fmt.Errorf("%w: cannot tie %s", errMalformed, v)
+			}
+			for i, x := range f.free {
+				if r, ok := x.(recRef); ok {
+					f.free[i] = a.frame[s.Start+r.index]
+				}
+			}
+		}
+
+	case Call:
+		m.act = nil
+		m.Call(a.frame[s.Start], append(a.slice(s.Start+1, s.Argc-1), a.extra...))
+
+	case Switch:
+		con, ok := a.frame[s.Start].(prim.Con)
+		if !ok {
+			return fmt.Errorf("%w: cannot match on %s", prim.ErrType, a.frame[s.Start])
+		}
+		if con.Tag < 0 || con.Tag >= s.Argc-1 {
+			return fmt.Errorf("%w: %s", errNoMatch, con)
+		}
+		m.act = nil
+		m.Call(a.frame[s.Start+1+con.Tag], append(append([]prim.Value(nil), con.Fields...), a.extra...))
+
+	default:
+		return fmt.Errorf("%w: unknown step %#v", errMalformed, s)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package bc
+
+import (
+	"github.com/bobappleyard/goose/irjson"
+	"github.com/bobappleyard/goose/lc"
+)
+
+var codec = irjson.NewCodec(
+	PushBound{},
+	PushFree{},
+	PushGlobal{},
+	PushBlock{},
+	PushFn{},
+	Call{},
+	PushInt{},
+	PushPrim{},
+	PushCon{},
+	Switch{},
+	PushRec{},
+	Tie{},
+	lc.Var{},
+)
+
+func (p Program) MarshalJSON() ([]byte, error) {
+	return codec.Marshal(p)
+}
+
+func (p *Program) UnmarshalJSON(data []byte) error {
+	return codec.Unmarshal(data, p)
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/bobappleyard/goose/lc"
+	"github.com/bobappleyard/goose/prim"
 )
 
 type Step interface {
@@ -54,12 +55,54 @@ type Call struct {
 	Argc  int
 }
 
+type PushInt struct {
+	Value int
+}
+
+type PushPrim struct {
+	Op    prim.Op
+	Start int
+	Argc  int
+}
+
+// PushCon allocates a constructed value with the tag given, taking its fields from the frame.
+type PushCon struct {
+	Tag   int
+	Start int
+	Argc  int
+}
+
+// Switch calls one of a series of functions according to the tag of a constructed value, passing
+// that value's fields as arguments. The value is at Start in the frame, and the functions follow it.
+type Switch struct {
+	Start int
+	Argc  int
+}
+
+// PushRec stands in for one of a group of recursive functions that is still under construction.
+type PushRec struct {
+	Var int
+}
+
+// Tie completes a group of recursive functions at Start in the frame, replacing the placeholders
+// they have captured with the functions themselves.
+type Tie struct {
+	Start int
+	Count int
+}
+
 func (PushBound) s()  {}
 func (PushFree) s()   {}
 func (PushGlobal) s() {}
 func (PushBlock) s()  {}
 func (PushFn) s()     {}
 func (Call) s()       {}
+func (PushInt) s()    {}
+func (PushPrim) s()   {}
+func (PushCon) s()    {}
+func (Switch) s()     {}
+func (PushRec) s()    {}
+func (Tie) s()        {}
 
 func (b Block) String() string {
 	var steps strings.Builder
@@ -71,6 +114,15 @@ func (b Block) String() string {
 	return steps.String()
 }
 
+// Size counts the steps in every block of the program.
+func (p Program) Size() int {
+	n := 0
+	for _, b := range p.Blocks {
+		n += len(b.Steps)
+	}
+	return n
+}
+
 func (p Program) String() string {
 	var prog strings.Builder
 	prog.WriteString("GLOBALS")
@@ -107,3 +159,27 @@ func (s PushFn) String() string {
 func (s Call) String() string {
 	return fmt.Sprintf("CALL\t%d\t%d", s.Start, s.Argc)
 }
+
+func (s PushInt) String() string {
+	return fmt.Sprintf("INT\t%d", s.Value)
+}
+
+func (s PushPrim) String() string {
+	return fmt.Sprintf("PRIM\t%s\t%d\t%d", s.Op, s.Start, s.Argc)
+}
+
+func (s PushCon) String() string {
+	return fmt.Sprintf("CON\t%d\t%d\t%d", s.Tag, s.Start, s.Argc)
+}
+
+func (s Switch) String() string {
+	return fmt.Sprintf("SWITCH\t%d\t%d", s.Start, s.Argc)
+}
+
+func (s PushRec) String() string {
+	return fmt.Sprintf("REC\t%d", s.Var)
+}
+
+func (s Tie) String() string {
+	return fmt.Sprintf("TIE\t%d\t%d", s.Start, s.Count)
+}
@@ -0,0 +1,423 @@
+package bc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errMidBlock = errors.New("cannot suspend in the middle of a block")
+var errThreads = errors.New("cannot suspend a program with more than one thread")
+var errUnsuspendable = errors.New("cannot suspend value")
+var errBadSuspension = errors.New("malformed suspension")
+var errWrongProgram = errors.New("suspension is of a different program")
+
+// Programs are in continuation passing style, so between calls the whole of a program's state is the
+// call that it is about to make and the runtime's meta-continuation. Suspending a program writes
+// these out as JSON, which can be resumed by any process that has the same program. A hash of the
+// program is written with them, so that resuming any other program fails, as is what the scheduler
+// keeps besides the threads: the ids that it has given out, the results of finished threads, and the
+// values waiting on channels.
+//
+// Functions are written as the block that they run and the values of their free variables. They are
+// kept in a table, so that those that refer to one another, as recursive functions do, can be
+// written. Prompts are written as their ids, and builtins as their names.
+
+type suspension struct {
+	Program  string             `json:"program"`
+	Fn       suspendedValue     `json:"fn"`
+	Args     []suspendedValue   `json:"args"`
+	Meta     []suspendedFrame   `json:"meta"`
+	Closures []suspendedClosure `json:"closures,omitempty"`
+
+	// the scheduler's state besides the running thread
+	IDs      int                      `json:"ids,omitempty"`
+	Results  map[int]suspendedValue   `json:"results,omitempty"`
+	Channels map[int][]suspendedValue `json:"channels,omitempty"`
+}
+
+type suspendedClosure struct {
+	Block int              `json:"block"`
+	Free  []suspendedValue `json:"free,omitempty"`
+}
+
+type suspendedFrame struct {
+	Prompt *int            `json:"prompt,omitempty"`
+	K      *suspendedValue `json:"k,omitempty"`
+}
+
+// suspendedValue is written with a kind, saying what sort of value it is, and whichever of the
+// other fields that sort of value uses. Int holds integers, constructor tags, prompt ids and
+// indices into the table of closures. Objects keep their keys apart from their values.
+type suspendedValue struct {
+	Kind   string           `json:"kind"`
+	Int    int              `json:"int,omitempty"`
+	Name   string           `json:"name,omitempty"`
+	Keys   []string         `json:"keys,omitempty"`
+	Fields []suspendedValue `json:"fields,omitempty"`
+	Frames []suspendedFrame `json:"frames,omitempty"`
+}
+
+// Run runs p as EvalHost does, except that host may suspend it by returning cps.ErrSuspend from
+// Handle. The program's state is then returned in place of its result, to be given to Resume.
+func Run(p Program, host cps.Host) (prim.Value, []byte, error) {
+	m, err := newMachine(p, host)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.run()
+}
+
+// Resume continues a program suspended by Run, or by a debugger, as far as Run would. p must be the
+// program that was suspended.
+func Resume(p Program, data []byte, host cps.Host) (prim.Value, []byte, error) {
+	m, err := resume(p, data, host)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.run()
+}
+
+// Suspend writes out the program's state so that it can be resumed later. This can only be done
+// between calls, and while the program has a single thread.
+func (d *Debugger) Suspend() ([]byte, error) {
+	if _, done := d.Done(); done {
+		return nil, errFinished
+	}
+	return d.m.suspend()
+}
+
+// ResumeDebugger reads the state of a suspended program, giving a debugger that continues from where
+// it left off. p must be the program that was suspended.
+func ResumeDebugger(p Program, data []byte, host cps.Host) (*Debugger, error) {
+	m, err := resume(p, data, host)
+	if err != nil {
+		return nil, err
+	}
+	return &Debugger{m: m, breaks: map[int]bool{}, effects: map[string]bool{}}, nil
+}
+
+func (m *machine) run() (prim.Value, []byte, error) {
+	for {
+		if v, done := m.rt.Done(); done {
+			return v, nil, nil
+		}
+		err := m.step()
+		if errors.Is(err, cps.ErrSuspend) {
+			data, err := m.suspend()
+			return nil, data, err
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+func (m *machine) suspend() ([]byte, error) {
+	if m.act != nil {
+		return nil, errMidBlock
+	}
+	if m.rt.Threads() > 1 {
+		return nil, errThreads
+	}
+
+	w := &suspender{closures: map[*closure]int{}}
+	var s suspension
+	var err error
+	if s.Program, err = fingerprint(*m.prog); err != nil {
+		return nil, err
+	}
+	if s.Fn, err = w.value(m.fn); err != nil {
+		return nil, err
+	}
+	if s.Args, err = w.values(m.args); err != nil {
+		return nil, err
+	}
+	if s.Meta, err = w.frames(m.rt.Meta()); err != nil {
+		return nil, err
+	}
+	if err := w.scheduler(&s, m.rt.Scheduler()); err != nil {
+		return nil, err
+	}
+	s.Closures = w.table
+	return json.Marshal(s)
+}
+
+func resume(p Program, data []byte, host cps.Host) (*machine, error) {
+	var s suspension
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %s", errBadSuspension, err)
+	}
+	fp, err := fingerprint(p)
+	if err != nil {
+		return nil, err
+	}
+	if s.Program != fp {
+		return nil, errWrongProgram
+	}
+	m, err := newMachine(p, host)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &resumer{rt: &m.rt, closures: make([]*closure, len(s.Closures))}
+	for i, c := range s.Closures {
+		if c.Block < 0 || c.Block >= len(p.Blocks) {
+			return nil, fmt.Errorf("%w: no block %d", errBadSuspension, c.Block)
+		}
+		r.closures[i] = &closure{block: c.Block}
+	}
+	for i, c := range s.Closures {
+		if r.closures[i].free, err = r.values(c.Free); err != nil {
+			return nil, err
+		}
+	}
+
+	fn, err := r.value(s.Fn)
+	if err != nil {
+		return nil, err
+	}
+	args, err := r.values(s.Args)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := r.frames(s.Meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.rt.Restore(meta); err != nil {
+		return nil, err
+	}
+	sched, err := r.scheduler(s)
+	if err != nil {
+		return nil, err
+	}
+	m.rt.RestoreScheduler(sched)
+	m.Call(fn, args)
+	return m, nil
+}
+
+// fingerprint is a hash of the program's JSON.
+func fingerprint(p Program) (string, error) {
+	bs, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type suspender struct {
+	closures map[*closure]int
+	table    []suspendedClosure
+}
+
+func (w *suspender) value(v prim.Value) (suspendedValue, error) {
+	switch v := v.(type) {
+	case prim.Int:
+		return suspendedValue{Kind: "int", Int: int(v)}, nil
+
+	case prim.Con:
+		fields, err := w.values(v.Fields)
+		return suspendedValue{Kind: "con", Int: v.Tag, Name: v.Name, Fields: fields}, err
+
+	case prim.Object:
+		keys, values := v.Entries()
+		fields, err := w.values(values)
+		return suspendedValue{Kind: "object", Keys: keys, Fields: fields}, err
+
+	case *closure:
+		if i, ok := w.closures[v]; ok {
+			return suspendedValue{Kind: "closure", Int: i}, nil
+		}
+		// enter the closure in the table before its free variables, which may refer back to it
+		i := len(w.table)
+		w.closures[v] = i
+		w.table = append(w.table, suspendedClosure{Block: v.block})
+		free, err := w.values(v.free)
+		w.table[i].Free = free
+		return suspendedValue{Kind: "closure", Int: i}, err
+
+	case *cps.Builtin:
+		return suspendedValue{Kind: "builtin", Name: v.String()}, nil
+	}
+
+	if id, ok := cps.PromptID(v); ok {
+		return suspendedValue{Kind: "prompt", Int: id}, nil
+	}
+	if frames, ok := cps.Captured(v); ok {
+		fs, err := w.frames(frames)
+		return suspendedValue{Kind: "subcont", Frames: fs}, err
+	}
+	return suspendedValue{}, fmt.Errorf("%w: %s", errUnsuspendable, v)
+}
+
+func (w *suspender) values(vs []prim.Value) ([]suspendedValue, error) {
+	res := make([]suspendedValue, len(vs))
+	for i, v := range vs {
+		var err error
+		if res[i], err = w.value(v); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (w *suspender) frames(frames []cps.Frame) ([]suspendedFrame, error) {
+	res := make([]suspendedFrame, len(frames))
+	for i, f := range frames {
+		if f.Prompt != nil {
+			id, _ := cps.PromptID(f.Prompt)
+			res[i].Prompt = &id
+			continue
+		}
+		k, err := w.value(f.K)
+		if err != nil {
+			return nil, err
+		}
+		res[i].K = &k
+	}
+	return res, nil
+}
+
+// scheduler writes out the results and channels in order of id, so that the closures that they hold
+// are always entered in the table in the same order.
+func (w *suspender) scheduler(s *suspension, sched cps.Scheduler) error {
+	s.IDs = sched.IDs
+	var results, channels []int
+	for id := range sched.Results {
+		results = append(results, id)
+	}
+	for id := range sched.Channels {
+		channels = append(channels, id)
+	}
+	sort.Ints(results)
+	sort.Ints(channels)
+
+	for _, id := range results {
+		v, err := w.value(sched.Results[id])
+		if err != nil {
+			return err
+		}
+		if s.Results == nil {
+			s.Results = map[int]suspendedValue{}
+		}
+		s.Results[id] = v
+	}
+	for _, id := range channels {
+		vs, err := w.values(sched.Channels[id])
+		if err != nil {
+			return err
+		}
+		if s.Channels == nil {
+			s.Channels = map[int][]suspendedValue{}
+		}
+		s.Channels[id] = vs
+	}
+	return nil
+}
+
+type resumer struct {
+	rt       *cps.Runtime
+	closures []*closure
+}
+
+func (r *resumer) value(v suspendedValue) (prim.Value, error) {
+	switch v.Kind {
+	case "int":
+		return prim.Int(v.Int), nil
+
+	case "con":
+		fields, err := r.values(v.Fields)
+		return prim.Con{Tag: v.Int, Name: v.Name, Fields: fields}, err
+
+	case "object":
+		if len(v.Keys) != len(v.Fields) {
+			return nil, fmt.Errorf("%w: object has %d keys and %d values", errBadSuspension, len(v.Keys), len(v.Fields))
+		}
+		values, err := r.values(v.Fields)
+		if err != nil {
+			return nil, err
+		}
+		var o prim.Object
+		for i := len(v.Keys) - 1; i >= 0; i-- {
+			o = o.Extend(v.Keys[i], values[i])
+		}
+		return o, nil
+
+	case "closure":
+		if v.Int < 0 || v.Int >= len(r.closures) {
+			return nil, fmt.Errorf("%w: no closure %d", errBadSuspension, v.Int)
+		}
+		return r.closures[v.Int], nil
+
+	case "builtin":
+		return r.rt.Global(v.Name)
+
+	case "prompt":
+		return r.rt.Prompt(v.Int), nil
+
+	case "subcont":
+		frames, err := r.frames(v.Frames)
+		if err != nil {
+			return nil, err
+		}
+		return cps.SubCont(frames)
+	}
+	return nil, fmt.Errorf("%w: unknown kind %q", errBadSuspension, v.Kind)
+}
+
+func (r *resumer) values(vs []suspendedValue) ([]prim.Value, error) {
+	res := make([]prim.Value, len(vs))
+	for i, v := range vs {
+		var err error
+		if res[i], err = r.value(v); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *resumer) scheduler(s suspension) (cps.Scheduler, error) {
+	sched := cps.Scheduler{IDs: s.IDs, Results: map[int]prim.Value{}, Channels: map[int][]prim.Value{}}
+	for id, v := range s.Results {
+		res, err := r.value(v)
+		if err != nil {
+			return cps.Scheduler{}, err
+		}
+		sched.Results[id] = res
+	}
+	for id, vs := range s.Channels {
+		values, err := r.values(vs)
+		if err != nil {
+			return cps.Scheduler{}, err
+		}
+		sched.Channels[id] = values
+	}
+	return sched, nil
+}
+
+func (r *resumer) frames(frames []suspendedFrame) ([]cps.Frame, error) {
+	res := make([]cps.Frame, len(frames))
+	for i, f := range frames {
+		switch {
+		case f.Prompt != nil:
+			res[i].Prompt = r.rt.Prompt(*f.Prompt)
+		case f.K != nil:
+			k, err := r.value(*f.K)
+			if err != nil {
+				return nil, err
+			}
+			res[i].K = k
+		default:
+			return nil, fmt.Errorf("%w: empty frame", errBadSuspension)
+		}
+	}
+	return res, nil
+}
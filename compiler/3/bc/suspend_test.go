@@ -0,0 +1,100 @@
+package bc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestSuspend(t *testing.T) {
+	p := addOne()
+	d, err := NewDebugger(p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Break(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Suspend(); !errors.Is(err, errMidBlock) {
+		t.Errorf("got %v, expecting %v", err, errMidBlock)
+	}
+
+	// finish the block, so that the continuation is about to be called with the result
+	for i := 0; i < 5; i++ {
+		if err := d.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := d.Suspend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Suspend(); !errors.Is(err, errFinished) {
+		t.Errorf("got %v, expecting %v", err, errFinished)
+	}
+
+	other := p
+	other.Blocks = p.Blocks[:1]
+	if _, err := ResumeDebugger(other, data, nil); !errors.Is(err, errWrongProgram) {
+		t.Errorf("got %v, expecting %v", err, errWrongProgram)
+	}
+
+	r, err := ResumeDebugger(p, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Continue(); err != nil {
+		t.Fatal(err)
+	}
+	if v, done := r.Done(); !done || v != prim.Int(42) {
+		t.Errorf("got %v, %v, expecting 42", v, done)
+	}
+}
+
+func TestResumeErrors(t *testing.T) {
+	p := addOne()
+	fp, err := fingerprint(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "notJSON",
+			in:   "{",
+		},
+		{
+			name: "unknownKind",
+			in:   `{"program": "$program", "fn": {"kind": "float"}}`,
+		},
+		{
+			name: "noClosure",
+			in:   `{"program": "$program", "fn": {"kind": "closure", "int": 3}}`,
+		},
+		{
+			name: "noBlock",
+			in:   `{"program": "$program", "fn": {"kind": "closure"}, "closures": [{"block": 7}]}`,
+		},
+		{
+			name: "emptyFrame",
+			in:   `{"program": "$program", "fn": {"kind": "int"}, "meta": [{}]}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ResumeDebugger(p, []byte(strings.ReplaceAll(test.in, "$program", fp)), nil)
+			if !errors.Is(err, errBadSuspension) {
+				t.Errorf("got %v, expecting %v", err, errBadSuspension)
+			}
+		})
+	}
+}
@@ -10,9 +10,16 @@ import (
 
 var errUnsupportedSyntax = errors.New("unsupported syntax")
 
+// ConvertExpr translates e into continuation passing style, producing a function that takes the
+// continuation of the whole program.
+//
+// The translation is done in one pass. Continuations that are known while converting are applied
+// during the conversion rather than in the result, so the result does not contain the administrative
+// redexes that a naive translation would produce, and does not need reducing.
 func ConvertExpr(e cont.Expr) (lc.Expr, error) {
 	c := new(converter)
-	res := c.convertExpr(e)
+	k := c.gensym("k")
+	res := lambda(k, c.convertExpr(e, dynamic(k)))
 	if c.err != nil {
 		return nil, c.err
 	}
@@ -24,7 +31,39 @@ type converter struct {
 	err     error
 }
 
-func (c *converter) convertExpr(e cont.Expr) lc.Expr {
+// continuation is what happens to the value of an expression. A static continuation is known during
+// the conversion, and is applied by building the code that it stands for around the value. A dynamic
+// continuation is only known when the program runs, and is applied by calling it.
+type continuation struct {
+	static  func(v lc.Expr) lc.Expr
+	dynamic lc.Expr
+}
+
+func static(k func(v lc.Expr) lc.Expr) continuation {
+	return continuation{static: k}
+}
+
+func dynamic(k lc.Expr) continuation {
+	return continuation{dynamic: k}
+}
+
+func (k continuation) apply(v lc.Expr) lc.Expr {
+	if k.static != nil {
+		return k.static(v)
+	}
+	return apply(k.dynamic, v)
+}
+
+// reify produces a value for k, to be passed to a function.
+func (c *converter) reify(k continuation) lc.Expr {
+	if k.static == nil {
+		return k.dynamic
+	}
+	v := c.gensym("v")
+	return lambda(v, k.static(v))
+}
+
+func (c *converter) convertExpr(e cont.Expr, k continuation) lc.Expr {
 	if c.err != nil {
 		return nil
 	}
@@ -32,25 +71,55 @@ func (c *converter) convertExpr(e cont.Expr) lc.Expr {
 	switch e := e.(type) {
 
 	case cont.Var:
-		return c.convertVar(e)
+		return c.convertVar(e, k)
 
 	case cont.Apply:
-		return c.convertApply(e)
+		return c.convertApply(e, k)
 
 	case cont.Lambda:
-		return c.convertLambda(e)
+		return c.convertLambda(e, k)
 
 	case cont.NewPrompt:
-		return c.convertNewPrompt(e)
+		return c.convertNewPrompt(e, k)
 
 	case cont.PushPrompt:
-		return c.convertPushPrompt(e)
+		return c.convertPushPrompt(e, k)
 
 	case cont.WithSubCont:
-		return c.convertWithSubCont(e)
+		return c.convertWithSubCont(e, k)
 
 	case cont.PushSubCont:
-		return c.convertPushSubCont(e)
+		return c.convertPushSubCont(e, k)
+
+	case cont.Reset:
+		return c.convertPushPrompt(cont.PushPrompt{Prompt: e.Prompt, Scope: e.Body}, k)
+
+	case cont.Prompt0:
+		return c.convertPushPrompt(cont.PushPrompt{Prompt: e.Prompt, Scope: e.Body}, k)
+
+	case cont.Shift:
+		return c.convertShift(e, k)
+
+	case cont.Control0:
+		return c.convertControl0(e, k)
+
+	case cont.Abort:
+		return c.convertAbort(e, k)
+
+	case cont.Int:
+		return c.convertInt(e, k)
+
+	case cont.Prim:
+		return c.convertPrim(e, k)
+
+	case cont.Construct:
+		return c.convertConstruct(e, k)
+
+	case cont.Match:
+		return c.convertMatch(e, k)
+
+	case cont.LetRec:
+		return c.convertLetRec(e, k)
 
 	}
 
@@ -81,73 +150,216 @@ func lambda(arg lc.Var, body lc.Expr) lc.Expr {
 	return lc.Abs{Var: arg, Body: body}
 }
 
-func (c *converter) convertVar(e cont.Var) lc.Expr {
-	k := c.gensym("k")
+func (c *converter) convertVar(e cont.Var, k continuation) lc.Expr {
+	return k.apply(lc.Var{Name: e.Name})
+}
 
-	v := lc.Var{Name: e.Name}
+func (c *converter) convertInt(e cont.Int, k continuation) lc.Expr {
+	return k.apply(lc.Int{Value: e.Value})
+}
 
-	return lambda(k, apply(k, v))
+// convertPrim passes the result of the operation directly to the continuation.
+func (c *converter) convertPrim(e cont.Prim, k continuation) lc.Expr {
+	return c.evalArgs(e.Args, func(args []lc.Expr) lc.Expr {
+		return k.apply(lc.Prim{Op: e.Op, Args: args})
+	})
 }
 
-func (c *converter) convertApply(e cont.Apply) lc.Expr {
-	f := c.gensym("f")
-	x := c.gensym("x")
-	k := c.gensym("k")
+func (c *converter) convertConstruct(e cont.Construct, k continuation) lc.Expr {
+	return c.evalArgs(e.Args, func(args []lc.Expr) lc.Expr {
+		return k.apply(lc.Con{Tag: e.Tag, Args: args})
+	})
+}
 
-	pf := c.convertExpr(e.Fn)
-	px := c.convertExpr(e.Arg)
+// convertMatch passes the continuation on to whichever arm is selected. A static continuation would
+// be copied into every arm, so it is bound to a variable first.
+func (c *converter) convertMatch(e cont.Match, k continuation) lc.Expr {
+	return c.convertExpr(e.On, static(func(on lc.Expr) lc.Expr {
+		if k.static == nil {
+			return c.convertArms(on, e.Arms, k)
+		}
+		j := c.gensym("k")
+		return apply(lambda(j, c.convertArms(on, e.Arms, dynamic(j))), c.reify(k))
+	}))
+}
 
-	return lambda(k, apply(pf, lambda(f, apply(px, lambda(x, apply(f, x, k))))))
+func (c *converter) convertArms(on lc.Expr, arms []cont.Arm, k continuation) lc.Expr {
+	res := make([]lc.Arm, len(arms))
+	for i, a := range arms {
+		var vars []lc.Var
+		for _, x := range a.Vars {
+			vars = append(vars, lc.Var{Name: x.Name})
+		}
+		res[i] = lc.Arm{Vars: vars, Body: c.convertExpr(a.Body, k)}
+	}
+	return lc.Case{On: on, Arms: res}
 }
 
-func (c *converter) convertLambda(e cont.Lambda) lc.Expr {
-	k := c.gensym("k")
+// evalArgs evaluates args from left to right and then passes their values on to body.
+func (c *converter) evalArgs(args []cont.Expr, body func([]lc.Expr) lc.Expr) lc.Expr {
+	vals := make([]lc.Expr, len(args))
+
+	var eval func(i int) lc.Expr
+	eval = func(i int) lc.Expr {
+		if i == len(args) {
+			return body(vals)
+		}
+		return c.convertExpr(args[i], static(func(v lc.Expr) lc.Expr {
+			vals[i] = v
+			return eval(i + 1)
+		}))
+	}
+
+	return eval(0)
+}
+
+// convertApply passes all of the arguments at once, followed by the continuation, so that l2b can
+// make a single call.
+func (c *converter) convertApply(e cont.Apply, k continuation) lc.Expr {
+	return c.evalArgs(append([]cont.Expr{e.Fn}, e.Args...), func(args []lc.Expr) lc.Expr {
+		args = append(args, c.reify(k))
+		return apply(args[0], args[1], args[2:]...)
+	})
+}
+
+func (c *converter) convertLambda(e cont.Lambda, k continuation) lc.Expr {
+	return k.apply(c.convertFn(e))
+}
+
+// convertFn produces the value of a lambda, which takes its continuation after its arguments.
+func (c *converter) convertFn(e cont.Lambda) lc.Abs {
 	kk := c.gensym("k")
-	v := lc.Var{Name: e.Var.Name}
-	body := c.convertExpr(e.Body)
 
-	return lambda(k, apply(k, lambda(v, lambda(kk, apply(body, kk)))))
+	fn := lc.Abs{Var: kk, Body: c.convertExpr(e.Body, dynamic(kk))}
+	for i := len(e.Vars) - 1; i >= 0; i-- {
+		fn = lc.Abs{Var: lc.Var{Name: e.Vars[i].Name}, Body: fn}
+	}
+
+	return fn
 }
 
-func (c *converter) convertNewPrompt(e cont.NewPrompt) lc.Expr {
+// convertScope produces a function that takes a continuation and then evaluates e, for the runtime
+// to call once it has arranged the continuation.
+func (c *converter) convertScope(e cont.Expr) lc.Expr {
 	k := c.gensym("k")
 
-	newPrompt := lc.Var{Name: "runtime.newPrompt"}
+	return lambda(k, c.convertExpr(e, dynamic(k)))
+}
 
-	return lambda(k, apply(newPrompt, k))
+// convertLetRec binds a static continuation to a variable first, as it may refer to variables that the
+// bindings would shadow.
+func (c *converter) convertLetRec(e cont.LetRec, k continuation) lc.Expr {
+	if k.static != nil {
+		j := c.gensym("k")
+		return apply(lambda(j, c.convertLetRec(e, dynamic(j))), c.reify(k))
+	}
+
+	vars := make([]lc.Var, len(e.Bindings))
+	fns := make([]lc.Abs, len(e.Bindings))
+	for i, b := range e.Bindings {
+		vars[i] = lc.Var{Name: b.Var.Name}
+		fns[i] = c.convertFn(b.Fn)
+	}
+
+	return lc.Fix{Vars: vars, Fns: fns, Body: c.convertExpr(e.Body, k)}
 }
 
-func (c *converter) convertPushPrompt(e cont.PushPrompt) lc.Expr {
-	k := c.gensym("k")
-	p := c.gensym("p")
-	pr := c.convertExpr(e.Prompt)
-	sc := c.convertExpr(e.Scope)
+func (c *converter) convertNewPrompt(e cont.NewPrompt, k continuation) lc.Expr {
+	newPrompt := lc.Var{Name: "runtime.newPrompt"}
+
+	return apply(newPrompt, c.reify(k))
+}
 
+func (c *converter) convertPushPrompt(e cont.PushPrompt, k continuation) lc.Expr {
 	pushPrompt := lc.Var{Name: "runtime.pushPrompt"}
 
-	return lambda(k, apply(pr, lambda(p, apply(pushPrompt, p, sc, k))))
+	return c.convertExpr(e.Prompt, static(func(p lc.Expr) lc.Expr {
+		return apply(pushPrompt, p, c.convertScope(e.Scope), c.reify(k))
+	}))
 }
 
-func (c *converter) convertWithSubCont(e cont.WithSubCont) lc.Expr {
-	k := c.gensym("k")
-	p := c.gensym("p")
-	f := c.gensym("f")
-
-	pr := c.convertExpr(e.Prompt)
-	fn := c.convertExpr(e.Fn)
+func (c *converter) convertWithSubCont(e cont.WithSubCont, k continuation) lc.Expr {
 	withSubCont := lc.Var{Name: "runtime.withSubCont"}
 
-	return lambda(k, apply(pr, lambda(p, apply(fn, lambda(f, apply(withSubCont, p, f, k))))))
+	return c.evalArgs([]cont.Expr{e.Prompt, e.Fn}, func(args []lc.Expr) lc.Expr {
+		return apply(withSubCont, args[0], args[1], c.reify(k))
+	})
 }
 
-func (c *converter) convertPushSubCont(e cont.PushSubCont) lc.Expr {
-	k := c.gensym("k")
-	m := c.gensym("meta")
+func (c *converter) convertPushSubCont(e cont.PushSubCont, k continuation) lc.Expr {
+	psc := lc.Var{Name: "runtime.pushSubCont"}
 
-	km := c.convertExpr(e.Cont)
-	sc := c.convertExpr(e.Scope)
+	return c.convertExpr(e.Cont, static(func(m lc.Expr) lc.Expr {
+		return apply(psc, m, c.convertScope(e.Scope), c.reify(k))
+	}))
+}
 
-	psc := lc.Var{Name: "runtime.pushSubCont"}
+// The other control operators are defined in terms of the ones above.
+
+// convertShift reinstates the prompt around the call and the captured continuation.
+func (c *converter) convertShift(e cont.Shift, k continuation) lc.Expr {
+	return c.convertDerived([]cont.Expr{e.Prompt, e.Fn}, k, func(vs []cont.Var) cont.Expr {
+		p, f := vs[0], vs[1]
+		sub, v := c.fresh("sub"), c.fresh("v")
+
+		return cont.WithSubCont{Prompt: p, Fn: cont.Lambda{
+			Vars: []cont.Var{sub},
+			Body: cont.PushPrompt{Prompt: p, Scope: cont.Apply{Fn: f, Args: []cont.Expr{cont.Lambda{
+				Vars: []cont.Var{v},
+				Body: cont.PushPrompt{Prompt: p, Scope: cont.PushSubCont{Cont: sub, Scope: v}},
+			}}}},
+		}}
+	})
+}
+
+func (c *converter) convertControl0(e cont.Control0, k continuation) lc.Expr {
+	return c.convertDerived([]cont.Expr{e.Prompt, e.Fn}, k, func(vs []cont.Var) cont.Expr {
+		p, f := vs[0], vs[1]
+		sub, v := c.fresh("sub"), c.fresh("v")
+
+		return cont.WithSubCont{Prompt: p, Fn: cont.Lambda{
+			Vars: []cont.Var{sub},
+			Body: cont.Apply{Fn: f, Args: []cont.Expr{cont.Lambda{
+				Vars: []cont.Var{v},
+				Body: cont.PushSubCont{Cont: sub, Scope: v},
+			}}},
+		}}
+	})
+}
+
+// convertAbort leaves the continuation to the runtime, which discards it without capturing anything.
+func (c *converter) convertAbort(e cont.Abort, k continuation) lc.Expr {
+	abort := lc.Var{Name: "runtime.abort"}
+
+	return c.evalArgs([]cont.Expr{e.Prompt, e.Value}, func(args []lc.Expr) lc.Expr {
+		return apply(abort, args[0], args[1])
+	})
+}
+
+// convertDerived evaluates args and names their values, so that the expression produced by def can
+// refer to them more than once. Values that are already variables keep their names, while the others
+// are given fresh ones. Definitions only bind fresh names of their own, so they cannot capture these.
+func (c *converter) convertDerived(args []cont.Expr, k continuation, def func(vs []cont.Var) cont.Expr) lc.Expr {
+	return c.evalArgs(args, func(vals []lc.Expr) lc.Expr {
+		vs := make([]cont.Var, len(vals))
+		for i, v := range vals {
+			if v, ok := v.(lc.Var); ok {
+				vs[i] = cont.Var{Name: v.Name}
+				continue
+			}
+			vs[i] = c.fresh("x")
+		}
+
+		res := c.convertExpr(def(vs), k)
+		for i := len(vals) - 1; i >= 0; i-- {
+			if _, ok := vals[i].(lc.Var); !ok {
+				res = apply(lambda(lc.Var{Name: vs[i].Name}, res), vals[i])
+			}
+		}
+		return res
+	})
+}
 
-	return lambda(k, apply(km, lambda(m, apply(psc, m, sc, k))))
+func (c *converter) fresh(base string) cont.Var {
+	return cont.Var{Name: c.gensym(base).Name}
 }
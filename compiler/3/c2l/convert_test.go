@@ -0,0 +1,156 @@
+package c2l
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/cont"
+	"github.com/bobappleyard/goose/lc"
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestConvertExpr(t *testing.T) {
+	v := func(name string) lc.Var {
+		return lc.Var{Name: name}
+	}
+
+	for _, test := range []struct {
+		name string
+		in   cont.Expr
+		out  lc.Expr
+	}{
+		{
+			name: "var",
+			in:   cont.Var{Name: "x"},
+			out:  lambda(v("#k1"), apply(v("#k1"), v("x"))),
+		},
+		{
+			name: "prim",
+			in: cont.Prim{Op: prim.Add, Args: []cont.Expr{
+				cont.Var{Name: "x"},
+				cont.Prim{Op: prim.Mul, Args: []cont.Expr{cont.Int{Value: 2}, cont.Var{Name: "y"}}},
+			}},
+			out: lambda(v("#k1"), apply(v("#k1"), lc.Prim{Op: prim.Add, Args: []lc.Expr{
+				v("x"),
+				lc.Prim{Op: prim.Mul, Args: []lc.Expr{lc.Int{Value: 2}, v("y")}},
+			}})),
+		},
+		{
+			name: "lambda",
+			in:   cont.Lambda{Vars: []cont.Var{{Name: "x"}, {Name: "y"}}, Body: cont.Var{Name: "y"}},
+			out: lambda(v("#k1"), apply(v("#k1"), lambda(v("x"), lambda(v("y"),
+				lambda(v("#k2"), apply(v("#k2"), v("y"))),
+			)))),
+		},
+		{
+			name: "apply",
+			in: cont.Apply{Fn: cont.Var{Name: "f"}, Args: []cont.Expr{
+				cont.Apply{Fn: cont.Var{Name: "g"}, Args: []cont.Expr{cont.Var{Name: "x"}}},
+				cont.Int{Value: 1},
+			}},
+			out: lambda(v("#k1"), apply(v("g"), v("x"), lambda(v("#v2"),
+				apply(v("f"), v("#v2"), lc.Int{Value: 1}, v("#k1")),
+			))),
+		},
+		{
+			name: "matchInTail",
+			in: cont.Match{On: cont.Var{Name: "b"}, Arms: []cont.Arm{
+				{Body: cont.Int{Value: 0}},
+				{Vars: []cont.Var{{Name: "x"}}, Body: cont.Var{Name: "x"}},
+			}},
+			out: lambda(v("#k1"), lc.Case{On: v("b"), Arms: []lc.Arm{
+				{Body: apply(v("#k1"), lc.Int{Value: 0})},
+				{Vars: []lc.Var{v("x")}, Body: apply(v("#k1"), v("x"))},
+			}}),
+		},
+		{
+			name: "matchInArgument",
+			in: cont.Prim{Op: prim.Add, Args: []cont.Expr{
+				cont.Match{On: cont.Var{Name: "b"}, Arms: []cont.Arm{
+					{Body: cont.Int{Value: 0}},
+					{Body: cont.Int{Value: 1}},
+				}},
+				cont.Int{Value: 1},
+			}},
+			out: lambda(v("#k1"), apply(
+				lambda(v("#k2"), lc.Case{On: v("b"), Arms: []lc.Arm{
+					{Body: apply(v("#k2"), lc.Int{Value: 0})},
+					{Body: apply(v("#k2"), lc.Int{Value: 1})},
+				}}),
+				lambda(v("#v3"), apply(v("#k1"), lc.Prim{Op: prim.Add, Args: []lc.Expr{v("#v3"), lc.Int{Value: 1}}})),
+			)),
+		},
+		{
+			name: "letRecShadows",
+			in: cont.Prim{Op: prim.Add, Args: []cont.Expr{
+				cont.Var{Name: "f"},
+				cont.LetRec{
+					Bindings: []cont.Binding{{Var: cont.Var{Name: "f"}, Fn: cont.Lambda{Body: cont.Int{Value: 1}}}},
+					Body:     cont.Int{Value: 2},
+				},
+			}},
+			out: lambda(v("#k1"), apply(
+				lambda(v("#k2"), lc.Fix{
+					Vars: []lc.Var{v("f")},
+					Fns:  []lc.Abs{{Var: v("#k3"), Body: apply(v("#k3"), lc.Int{Value: 1})}},
+					Body: apply(v("#k2"), lc.Int{Value: 2}),
+				}),
+				lambda(v("#v4"), apply(v("#k1"), lc.Prim{Op: prim.Add, Args: []lc.Expr{v("f"), v("#v4")}})),
+			)),
+		},
+		{
+			name: "pushPrompt",
+			in:   cont.PushPrompt{Prompt: cont.Var{Name: "p"}, Scope: cont.Var{Name: "x"}},
+			out: lambda(v("#k1"), apply(
+				v("runtime.pushPrompt"),
+				v("p"),
+				lambda(v("#k2"), apply(v("#k2"), v("x"))),
+				v("#k1"),
+			)),
+		},
+		{
+			name: "abort",
+			in:   cont.Abort{Prompt: cont.Var{Name: "p"}, Value: cont.Int{Value: 1}},
+			out:  lambda(v("#k1"), apply(v("runtime.abort"), v("p"), lc.Int{Value: 1})),
+		},
+		{
+			name: "shift",
+			in:   cont.Shift{Prompt: cont.Var{Name: "p"}, Fn: cont.Var{Name: "f"}},
+			out: lambda(v("#k1"), apply(
+				v("runtime.withSubCont"),
+				v("p"),
+				lambda(v("#sub2"), lambda(v("#k4"), apply(
+					v("runtime.pushPrompt"),
+					v("p"),
+					lambda(v("#k5"), apply(
+						v("f"),
+						lambda(v("#v3"), lambda(v("#k6"), apply(
+							v("runtime.pushPrompt"),
+							v("p"),
+							lambda(v("#k7"), apply(
+								v("runtime.pushSubCont"),
+								v("#sub2"),
+								lambda(v("#k8"), apply(v("#k8"), v("#v3"))),
+								v("#k7"),
+							)),
+							v("#k6"),
+						))),
+						v("#k5"),
+					)),
+					v("#k4"),
+				))),
+				v("#k1"),
+			)),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ConvertExpr(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("got %s, expecting %s", out, test.out)
+			}
+		})
+	}
+}
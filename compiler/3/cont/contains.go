@@ -0,0 +1,93 @@
+package cont
+
+// Contains reports the presence of the variable v in the expression e, taking into account possible
+// bindings of a variable with the same name.
+func Contains(v Var, e Expr) bool {
+	switch e := e.(type) {
+	case Var:
+		return e == v
+
+	case Int, NewPrompt:
+		return false
+
+	case Apply:
+		return Contains(v, e.Fn) || containsAny(v, e.Args)
+
+	case Lambda:
+		return !bindsAny(e.Vars, v) && Contains(v, e.Body)
+
+	case PushPrompt:
+		return Contains(v, e.Prompt) || Contains(v, e.Scope)
+
+	case WithSubCont:
+		return Contains(v, e.Prompt) || Contains(v, e.Fn)
+
+	case PushSubCont:
+		return Contains(v, e.Cont) || Contains(v, e.Scope)
+
+	case Reset:
+		return Contains(v, e.Prompt) || Contains(v, e.Body)
+
+	case Shift:
+		return Contains(v, e.Prompt) || Contains(v, e.Fn)
+
+	case Prompt0:
+		return Contains(v, e.Prompt) || Contains(v, e.Body)
+
+	case Control0:
+		return Contains(v, e.Prompt) || Contains(v, e.Fn)
+
+	case Abort:
+		return Contains(v, e.Prompt) || Contains(v, e.Value)
+
+	case Prim:
+		return containsAny(v, e.Args)
+
+	case Construct:
+		return containsAny(v, e.Args)
+
+	case Match:
+		if Contains(v, e.On) {
+			return true
+		}
+		for _, a := range e.Arms {
+			if !bindsAny(a.Vars, v) && Contains(v, a.Body) {
+				return true
+			}
+		}
+		return false
+
+	case LetRec:
+		for _, b := range e.Bindings {
+			if b.Var == v {
+				return false
+			}
+		}
+		for _, b := range e.Bindings {
+			if Contains(v, b.Fn) {
+				return true
+			}
+		}
+		return Contains(v, e.Body)
+	}
+
+	panic("unreachable")
+}
+
+func containsAny(v Var, es []Expr) bool {
+	for _, e := range es {
+		if Contains(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func bindsAny(vs []Var, v Var) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
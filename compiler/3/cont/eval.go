@@ -0,0 +1,429 @@
+package cont
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errUnbound = errors.New("unbound variable")
+var errNotFunction = errors.New("not a function")
+var errNoPrompt = errors.New("prompt not found")
+var errNoMatch = errors.New("no matching arm")
+var errWrongArgCount = errors.New("wrong number of arguments")
+var errUnsupported = errors.New("unsupported syntax")
+
+// Eval evaluates e on an abstract machine that implements prompts and subcontinuations directly.
+//
+// The runtime provides the handler object at the top level, along with the selectors and object
+// operations used by converted handlers.
+func Eval(e Expr) (prim.Value, error) {
+	m := &machine{expr: e}
+	return m.run()
+}
+
+type machine struct {
+	stack   []frame
+	prompts int
+	expr    Expr
+	env     *binding
+	value   prim.Value
+	err     error
+}
+
+// frame receives the value of a computation. Frames are never modified once pushed, as a
+// subcontinuation may be pushed more than once.
+type frame struct {
+	prompt *prompt
+	ret    func(m *machine, v prim.Value)
+}
+
+type binding struct {
+	name  string
+	value prim.Value
+	next  *binding
+}
+
+type prompt struct {
+	id int
+}
+
+type subCont struct {
+	frames []frame
+}
+
+// continuation is a captured continuation that can be called like a function. Calling it reinstates
+// the prompt as well, if there is one.
+type continuation struct {
+	prompt *prompt
+	frames []frame
+}
+
+type closure struct {
+	fn  Lambda
+	env *binding
+}
+
+// selector looks up an entry in an object.
+type selector struct {
+	name string
+}
+
+// builtin is a function provided by the runtime.
+type builtin struct {
+	name  string
+	arity int
+	fn    func(args []prim.Value) (prim.Value, error)
+}
+
+func (p *prompt) String() string {
+	return fmt.Sprintf("<prompt %d>", p.id)
+}
+
+func (k *subCont) String() string {
+	return "<subcont>"
+}
+
+func (k *continuation) String() string {
+	return "<continuation>"
+}
+
+func (c *closure) String() string {
+	return "<function>"
+}
+
+func (s selector) String() string {
+	return s.name
+}
+
+func (b *builtin) String() string {
+	return b.name
+}
+
+func (m *machine) run() (prim.Value, error) {
+	for m.err == nil {
+		if m.expr != nil {
+			e := m.expr
+			m.expr = nil
+			m.eval(e)
+			continue
+		}
+		if len(m.stack) == 0 {
+			return m.value, nil
+		}
+		f := m.stack[len(m.stack)-1]
+		m.stack = m.stack[:len(m.stack)-1]
+		f.ret(m, m.value)
+	}
+	return nil, m.err
+}
+
+func (m *machine) fail(err error) {
+	m.err = err
+}
+
+func (m *machine) push(ret func(m *machine, v prim.Value)) {
+	m.stack = append(m.stack, frame{ret: ret})
+}
+
+func (m *machine) evalIn(e Expr, env *binding) {
+	m.expr = e
+	m.env = env
+}
+
+func (m *machine) returnValue(v prim.Value) {
+	m.value = v
+}
+
+// evalAll evaluates es from left to right before passing their values on.
+func (m *machine) evalAll(es []Expr, then func(m *machine, vs []prim.Value)) {
+	m.evalRest(es, nil, m.env, then)
+}
+
+func (m *machine) evalRest(es []Expr, done []prim.Value, env *binding, then func(m *machine, vs []prim.Value)) {
+	if len(es) == 0 {
+		then(m, done)
+		return
+	}
+	m.push(func(m *machine, v prim.Value) {
+		next := make([]prim.Value, len(done), len(done)+1)
+		copy(next, done)
+		m.evalRest(es[1:], append(next, v), env, then)
+	})
+	m.evalIn(es[0], env)
+}
+
+func (m *machine) eval(e Expr) {
+	switch e := e.(type) {
+	case Var:
+		v, err := lookup(m.env, e.Name)
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		m.returnValue(v)
+
+	case Lambda:
+		m.returnValue(&closure{fn: e, env: m.env})
+
+	case Apply:
+		m.evalAll(append([]Expr{e.Fn}, e.Args...), func(m *machine, vs []prim.Value) {
+			m.call(vs[0], vs[1:])
+		})
+
+	case NewPrompt:
+		m.prompts++
+		m.returnValue(&prompt{id: m.prompts})
+
+	case PushPrompt:
+		m.pushPrompt(e.Prompt, e.Scope)
+
+	case Reset:
+		m.pushPrompt(e.Prompt, e.Body)
+
+	case Prompt0:
+		m.pushPrompt(e.Prompt, e.Body)
+
+	case WithSubCont:
+		m.evalAll([]Expr{e.Prompt, e.Fn}, func(m *machine, vs []prim.Value) {
+			m.withSubCont(vs[0], vs[1])
+		})
+
+	case Shift:
+		m.evalAll([]Expr{e.Prompt, e.Fn}, func(m *machine, vs []prim.Value) {
+			p, frames, ok := m.capture(vs[0])
+			if !ok {
+				return
+			}
+			m.stack = append(m.stack, frame{prompt: p, ret: (*machine).returnValue})
+			m.call(vs[1], []prim.Value{&continuation{prompt: p, frames: frames}})
+		})
+
+	case Control0:
+		m.evalAll([]Expr{e.Prompt, e.Fn}, func(m *machine, vs []prim.Value) {
+			_, frames, ok := m.capture(vs[0])
+			if !ok {
+				return
+			}
+			m.call(vs[1], []prim.Value{&continuation{frames: frames}})
+		})
+
+	case Abort:
+		m.evalAll([]Expr{e.Prompt, e.Value}, func(m *machine, vs []prim.Value) {
+			if _, _, ok := m.capture(vs[0]); ok {
+				m.returnValue(vs[1])
+			}
+		})
+
+	case PushSubCont:
+		env := m.env
+		m.push(func(m *machine, v prim.Value) {
+			k, ok := v.(*subCont)
+			if !ok {
+				m.fail(fmt.Errorf("%w: expecting a subcontinuation, got %s", prim.ErrType, v))
+				return
+			}
+			m.stack = append(m.stack, k.frames...)
+			m.evalIn(e.Scope, env)
+		})
+		m.evalIn(e.Cont, env)
+
+	case Int:
+		m.returnValue(prim.Int(e.Value))
+
+	case Prim:
+		m.evalAll(e.Args, func(m *machine, vs []prim.Value) {
+			v, err := e.Op.Apply(vs)
+			if err != nil {
+				m.fail(err)
+				return
+			}
+			m.returnValue(v)
+		})
+
+	case Construct:
+		m.evalAll(e.Args, func(m *machine, vs []prim.Value) {
+			m.returnValue(prim.Con{Tag: e.Tag, Fields: vs})
+		})
+
+	case Match:
+		env := m.env
+		m.push(func(m *machine, v prim.Value) {
+			m.match(e, env, v)
+		})
+		m.evalIn(e.On, env)
+
+	case LetRec:
+		env := m.env
+		bound := make([]*binding, len(e.Bindings))
+		for i, b := range e.Bindings {
+			env = &binding{name: b.Var.Name, next: env}
+			bound[i] = env
+		}
+		for i, b := range e.Bindings {
+			bound[i].value = &closure{fn: b.Fn, env: env}
+		}
+		m.evalIn(e.Body, env)
+
+	default:
+		m.fail(fmt.Errorf("%w: %#v", errUnsupported, e))
+	}
+}
+
+func (m *machine) pushPrompt(pr, scope Expr) {
+	env := m.env
+	m.push(func(m *machine, v prim.Value) {
+		p, ok := v.(*prompt)
+		if !ok {
+			m.fail(fmt.Errorf("%w: expecting a prompt, got %s", prim.ErrType, v))
+			return
+		}
+		m.stack = append(m.stack, frame{prompt: p, ret: (*machine).returnValue})
+		m.evalIn(scope, env)
+	})
+	m.evalIn(pr, env)
+}
+
+func (m *machine) call(f prim.Value, args []prim.Value) {
+	switch f := f.(type) {
+	case *closure:
+		if len(args) != len(f.fn.Vars) {
+			m.fail(fmt.Errorf("%w: expecting %d, got %d", errWrongArgCount, len(f.fn.Vars), len(args)))
+			return
+		}
+		env := f.env
+		for i, x := range f.fn.Vars {
+			env = &binding{name: x.Name, value: args[i], next: env}
+		}
+		m.evalIn(f.fn.Body, env)
+
+	case selector:
+		if len(args) != 1 {
+			m.fail(fmt.Errorf("%w: expecting 1, got %d", errWrongArgCount, len(args)))
+			return
+		}
+		o, ok := args[0].(prim.Object)
+		if !ok {
+			m.fail(fmt.Errorf("%w: cannot select %s from %s", prim.ErrType, f.name, args[0]))
+			return
+		}
+		v, err := o.Select(f.name)
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		m.returnValue(v)
+
+	case *continuation:
+		if len(args) != 1 {
+			m.fail(fmt.Errorf("%w: expecting 1, got %d", errWrongArgCount, len(args)))
+			return
+		}
+		if f.prompt != nil {
+			m.stack = append(m.stack, frame{prompt: f.prompt, ret: (*machine).returnValue})
+		}
+		m.stack = append(m.stack, f.frames...)
+		m.returnValue(args[0])
+
+	case *builtin:
+		if len(args) != f.arity {
+			m.fail(fmt.Errorf("%w: expecting %d, got %d", errWrongArgCount, f.arity, len(args)))
+			return
+		}
+		v, err := f.fn(args)
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		m.returnValue(v)
+
+	default:
+		m.fail(fmt.Errorf("%w: %s", errNotFunction, f))
+	}
+}
+
+// withSubCont captures the frames above the nearest instance of the prompt, removing them and the
+// prompt from the stack, and passes them on to fn.
+func (m *machine) withSubCont(v, fn prim.Value) {
+	_, frames, ok := m.capture(v)
+	if !ok {
+		return
+	}
+	m.call(fn, []prim.Value{&subCont{frames: frames}})
+}
+
+// capture removes the frames above the nearest instance of the prompt v, and the prompt itself, from
+// the stack, returning the frames.
+func (m *machine) capture(v prim.Value) (*prompt, []frame, bool) {
+	p, ok := v.(*prompt)
+	if !ok {
+		m.fail(fmt.Errorf("%w: expecting a prompt, got %s", prim.ErrType, v))
+		return nil, nil, false
+	}
+	for i := len(m.stack) - 1; i >= 0; i-- {
+		if m.stack[i].prompt != p {
+			continue
+		}
+		frames := make([]frame, len(m.stack)-i-1)
+		copy(frames, m.stack[i+1:])
+		m.stack = m.stack[:i]
+		return p, frames, true
+	}
+	m.fail(fmt.Errorf("%w: %s", errNoPrompt, p))
+	return nil, nil, false
+}
+
+func (m *machine) match(e Match, env *binding, v prim.Value) {
+	con, ok := v.(prim.Con)
+	if !ok {
+		m.fail(fmt.Errorf("%w: cannot match on %s", prim.ErrType, v))
+		return
+	}
+	if con.Tag < 0 || con.Tag >= len(e.Arms) || len(e.Arms[con.Tag].Vars) != len(con.Fields) {
+		m.fail(fmt.Errorf("%w: %s", errNoMatch, v))
+		return
+	}
+	arm := e.Arms[con.Tag]
+	for i, x := range arm.Vars {
+		env = &binding{name: x.Name, value: con.Fields[i], next: env}
+	}
+	m.evalIn(arm.Body, env)
+}
+
+func lookup(env *binding, name string) (prim.Value, error) {
+	for b := env; b != nil; b = b.next {
+		if b.name == name {
+			return b.value, nil
+		}
+	}
+	return global(name)
+}
+
+// global provides the names that the runtime defines.
+func global(name string) (prim.Value, error) {
+	switch {
+	case strings.HasPrefix(name, "."):
+		return selector{name: name}, nil
+
+	case name == "#handler", name == "runtime.emptyObject":
+		return prim.Object{}, nil
+
+	case name == "runtime.extendObject":
+		return &builtin{name: name, arity: 3, fn: extendObject}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errUnbound, name)
+}
+
+func extendObject(args []prim.Value) (prim.Value, error) {
+	s, ok := args[0].(selector)
+	if !ok {
+		return nil, fmt.Errorf("%w: expecting a selector, got %s", prim.ErrType, args[0])
+	}
+	o, ok := args[1].(prim.Object)
+	if !ok {
+		return nil, fmt.Errorf("%w: expecting an object, got %s", prim.ErrType, args[1])
+	}
+	return o.Extend(s.name, args[2]), nil
+}
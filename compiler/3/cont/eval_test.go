@@ -0,0 +1,107 @@
+package cont
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestControl(t *testing.T) {
+	p := Var{Name: "p"}
+	q := Var{Name: "q"}
+	k := Var{Name: "k"}
+	num := func(n int) Expr {
+		return Int{Value: n}
+	}
+	add := func(x, y Expr) Expr {
+		return Prim{Op: prim.Add, Args: []Expr{x, y}}
+	}
+	call := func(f, arg Expr) Expr {
+		return Apply{Fn: f, Args: []Expr{arg}}
+	}
+	fn := func(x Var, body Expr) Expr {
+		return Lambda{Vars: []Var{x}, Body: body}
+	}
+	withPrompts := func(body Expr) Expr {
+		return Apply{
+			Fn:   Lambda{Vars: []Var{p, q}, Body: body},
+			Args: []Expr{NewPrompt{}, NewPrompt{}},
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		in   Expr
+		out  prim.Value
+	}{
+		{
+			name: "shift",
+			in: withPrompts(Reset{Prompt: p, Body: add(num(1), Shift{
+				Prompt: p,
+				Fn:     fn(k, call(k, call(k, num(10)))),
+			})}),
+			out: prim.Int(12),
+		},
+		{
+			name: "shiftDelimitsCall",
+			in: withPrompts(Reset{Prompt: p, Body: add(num(1000), Reset{Prompt: p, Body: add(num(10), Shift{
+				Prompt: p,
+				Fn:     fn(k, call(k, Shift{Prompt: p, Fn: fn(Var{Name: "k2"}, num(100))})),
+			})})}),
+			out: prim.Int(1100),
+		},
+		{
+			name: "control0DoesNotDelimitCall",
+			in: withPrompts(Prompt0{Prompt: p, Body: add(num(1000), Prompt0{Prompt: p, Body: add(num(10), Control0{
+				Prompt: p,
+				Fn:     fn(k, call(k, Control0{Prompt: p, Fn: fn(Var{Name: "k2"}, num(100))})),
+			})})}),
+			out: prim.Int(100),
+		},
+		{
+			name: "control0",
+			in: withPrompts(Prompt0{Prompt: p, Body: add(num(1), Control0{
+				Prompt: p,
+				Fn:     fn(k, add(call(k, num(2)), num(10))),
+			})}),
+			out: prim.Int(13),
+		},
+		{
+			name: "abort",
+			in:   withPrompts(Reset{Prompt: p, Body: add(num(1), Abort{Prompt: p, Value: num(5)})}),
+			out:  prim.Int(5),
+		},
+		{
+			name: "abortInner",
+			in: withPrompts(Reset{Prompt: p, Body: add(num(1), Reset{Prompt: q, Body: add(num(2),
+				Abort{Prompt: q, Value: num(5)},
+			)})}),
+			out: prim.Int(6),
+		},
+		{
+			name: "abortOuter",
+			in: withPrompts(Reset{Prompt: p, Body: add(num(1), Reset{Prompt: q, Body: add(num(2),
+				Abort{Prompt: p, Value: num(5)},
+			)})}),
+			out: prim.Int(5),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Eval(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("got %s, expecting %s", out, test.out)
+			}
+		})
+	}
+}
+
+func TestAbortNoPrompt(t *testing.T) {
+	_, err := Eval(Abort{Prompt: NewPrompt{}, Value: Int{Value: 1}})
+	if !errors.Is(err, errNoPrompt) {
+		t.Errorf("got %v, expecting %v", err, errNoPrompt)
+	}
+}
@@ -0,0 +1,50 @@
+package cont
+
+import "github.com/bobappleyard/goose/irjson"
+
+var codec = irjson.NewCodec(
+	Var{},
+	Apply{},
+	Lambda{},
+	NewPrompt{},
+	PushPrompt{},
+	WithSubCont{},
+	PushSubCont{},
+	Reset{},
+	Shift{},
+	Prompt0{},
+	Control0{},
+	Abort{},
+	Int{},
+	Prim{},
+	Construct{},
+	Match{},
+	LetRec{},
+)
+
+func (e Var) MarshalJSON() ([]byte, error)         { return codec.Marshal(e) }
+func (e Apply) MarshalJSON() ([]byte, error)       { return codec.Marshal(e) }
+func (e Lambda) MarshalJSON() ([]byte, error)      { return codec.Marshal(e) }
+func (e NewPrompt) MarshalJSON() ([]byte, error)   { return codec.Marshal(e) }
+func (e PushPrompt) MarshalJSON() ([]byte, error)  { return codec.Marshal(e) }
+func (e WithSubCont) MarshalJSON() ([]byte, error) { return codec.Marshal(e) }
+func (e PushSubCont) MarshalJSON() ([]byte, error) { return codec.Marshal(e) }
+func (e Reset) MarshalJSON() ([]byte, error)       { return codec.Marshal(e) }
+func (e Shift) MarshalJSON() ([]byte, error)       { return codec.Marshal(e) }
+func (e Prompt0) MarshalJSON() ([]byte, error)     { return codec.Marshal(e) }
+func (e Control0) MarshalJSON() ([]byte, error)    { return codec.Marshal(e) }
+func (e Abort) MarshalJSON() ([]byte, error)       { return codec.Marshal(e) }
+func (e Int) MarshalJSON() ([]byte, error)         { return codec.Marshal(e) }
+func (e Prim) MarshalJSON() ([]byte, error)        { return codec.Marshal(e) }
+func (e Construct) MarshalJSON() ([]byte, error)   { return codec.Marshal(e) }
+func (e Match) MarshalJSON() ([]byte, error)       { return codec.Marshal(e) }
+func (e LetRec) MarshalJSON() ([]byte, error)      { return codec.Marshal(e) }
+
+// UnmarshalExpr reads an expression written as JSON.
+func UnmarshalExpr(data []byte) (Expr, error) {
+	var e Expr
+	if err := codec.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
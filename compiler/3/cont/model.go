@@ -1,5 +1,7 @@
 package cont
 
+import "github.com/bobappleyard/goose/prim"
+
 type Expr interface {
 	expr()
 }
@@ -9,12 +11,12 @@ type Var struct {
 }
 
 type Apply struct {
-	Fn  Expr
-	Arg Expr
+	Fn   Expr
+	Args []Expr
 }
 
 type Lambda struct {
-	Var  Var
+	Vars []Var
 	Body Expr
 }
 
@@ -36,6 +38,74 @@ type PushSubCont struct {
 	Scope Expr
 }
 
+// Reset delimits the continuation captured by Shift with the same prompt.
+type Reset struct {
+	Prompt Expr
+	Body   Expr
+}
+
+// Shift captures the continuation up to the nearest Reset with the prompt, removing it, and calls Fn
+// with a function that reinstates it. Both the call and the reinstated continuation are delimited by
+// the prompt again.
+type Shift struct {
+	Prompt Expr
+	Fn     Expr
+}
+
+// Prompt0 delimits the continuation captured by Control0 with the same prompt.
+type Prompt0 struct {
+	Prompt Expr
+	Body   Expr
+}
+
+// Control0 is like Shift, except that neither the call nor the reinstated continuation are delimited.
+type Control0 struct {
+	Prompt Expr
+	Fn     Expr
+}
+
+// Abort discards the continuation up to and including the nearest instance of the prompt, returning
+// Value from there. Nothing is captured.
+type Abort struct {
+	Prompt Expr
+	Value  Expr
+}
+
+type Int struct {
+	Value int
+}
+
+type Prim struct {
+	Op   prim.Op
+	Args []Expr
+}
+
+type Construct struct {
+	Tag  int
+	Args []Expr
+}
+
+// Match selects the arm corresponding to the tag of the constructed value, binding its fields.
+type Match struct {
+	On   Expr
+	Arms []Arm
+}
+
+type Arm struct {
+	Vars []Var
+	Body Expr
+}
+
+type LetRec struct {
+	Bindings []Binding
+	Body     Expr
+}
+
+type Binding struct {
+	Var Var
+	Fn  Lambda
+}
+
 func (Var) expr()         {}
 func (Apply) expr()       {}
 func (Lambda) expr()      {}
@@ -43,3 +113,13 @@ func (NewPrompt) expr()   {}
 func (PushPrompt) expr()  {}
 func (WithSubCont) expr() {}
 func (PushSubCont) expr() {}
+func (Reset) expr()       {}
+func (Shift) expr()       {}
+func (Prompt0) expr()     {}
+func (Control0) expr()    {}
+func (Abort) expr()       {}
+func (Int) expr()         {}
+func (Prim) expr()        {}
+func (Construct) expr()   {}
+func (Match) expr()       {}
+func (LetRec) expr()      {}
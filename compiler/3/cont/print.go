@@ -0,0 +1,192 @@
+package cont
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+// Expressions print in the notation of the handler language where the two have constructs in
+// common. Constructed values and match arms are written with their tags, as in lc, and the control
+// operators are written as keywords. Blocks that do not fit comfortably on one line are broken over
+// several, indented to show their nesting.
+
+func (e Var) String() string         { return format(e, 0, precAny) }
+func (e Apply) String() string       { return format(e, 0, precAny) }
+func (e Lambda) String() string      { return format(e, 0, precAny) }
+func (e NewPrompt) String() string   { return format(e, 0, precAny) }
+func (e PushPrompt) String() string  { return format(e, 0, precAny) }
+func (e WithSubCont) String() string { return format(e, 0, precAny) }
+func (e PushSubCont) String() string { return format(e, 0, precAny) }
+func (e Reset) String() string       { return format(e, 0, precAny) }
+func (e Shift) String() string       { return format(e, 0, precAny) }
+func (e Prompt0) String() string     { return format(e, 0, precAny) }
+func (e Control0) String() string    { return format(e, 0, precAny) }
+func (e Abort) String() string       { return format(e, 0, precAny) }
+func (e Int) String() string         { return format(e, 0, precAny) }
+func (e Prim) String() string        { return format(e, 0, precAny) }
+func (e Construct) String() string   { return format(e, 0, precAny) }
+func (e Match) String() string       { return format(e, 0, precAny) }
+func (e LetRec) String() string      { return format(e, 0, precAny) }
+
+// Operator precedence, from loosest to tightest. Recursive bindings extend as far to the right as
+// they can, so they bind loosest of all.
+const (
+	precAny = iota
+	precCompare
+	precAdd
+	precMul
+)
+
+var infix = map[prim.Op]struct {
+	symbol string
+	prec   int
+}{
+	prim.Add: {"+", precAdd},
+	prim.Sub: {"-", precAdd},
+	prim.Mul: {"*", precMul},
+	prim.Eq:  {"==", precCompare},
+	prim.Lt:  {"<", precCompare},
+}
+
+const lineWidth = 40
+
+func indent(depth int) string {
+	return strings.Repeat("    ", depth)
+}
+
+// block puts braces around a body that has been formatted at depth+1, keeping it on one line if it
+// is short enough.
+func block(body string, depth int) string {
+	if !strings.Contains(body, "\n") && len(body) <= lineWidth {
+		return fmt.Sprintf("{ %s }", body)
+	}
+	return fmt.Sprintf("{\n%s%s\n%s}", indent(depth+1), body, indent(depth))
+}
+
+func formatAll(es []Expr, depth int) string {
+	strs := make([]string, len(es))
+	for i, e := range es {
+		strs[i] = format(e, depth, precAny)
+	}
+	return strings.Join(strs, ", ")
+}
+
+func formatVars(vs []Var) string {
+	strs := make([]string, len(vs))
+	for i, v := range vs {
+		strs[i] = v.Name
+	}
+	return strings.Join(strs, ", ")
+}
+
+// format writes e at the given depth of indentation, within a context that needs an expression of
+// at least precedence min.
+func format(e Expr, depth, min int) string {
+	switch e := e.(type) {
+	case Var:
+		return e.Name
+
+	case Int:
+		return fmt.Sprint(e.Value)
+
+	case Apply:
+		fn := format(e.Fn, depth, precAny)
+		if _, ok := e.Fn.(Var); !ok {
+			fn = fmt.Sprintf("(%s)", fn)
+		}
+		return fmt.Sprintf("%s(%s)", fn, formatAll(e.Args, depth))
+
+	case Lambda:
+		return fmt.Sprintf("fun(%s) %s", formatVars(e.Vars), block(format(e.Body, depth+1, precAny), depth))
+
+	case Prim:
+		op, ok := infix[e.Op]
+		if !ok || len(e.Args) != 2 {
+			return fmt.Sprintf("%s(%s)", e.Op, formatAll(e.Args, depth))
+		}
+		left := op.prec
+		if op.prec == precCompare {
+			left++
+		}
+		s := fmt.Sprintf("%s %s %s", format(e.Args[0], depth, left), op.symbol, format(e.Args[1], depth, op.prec+1))
+		if op.prec < min {
+			return fmt.Sprintf("(%s)", s)
+		}
+		return s
+
+	case Construct:
+		if len(e.Args) == 0 {
+			return fmt.Sprintf("#%d", e.Tag)
+		}
+		return fmt.Sprintf("#%d(%s)", e.Tag, formatAll(e.Args, depth))
+
+	case Match:
+		var b strings.Builder
+		fmt.Fprintf(&b, "match %s {\n", format(e.On, depth, precAny))
+		for i, a := range e.Arms {
+			pat := fmt.Sprintf("#%d", i)
+			if len(a.Vars) != 0 {
+				pat = fmt.Sprintf("#%d(%s)", i, formatVars(a.Vars))
+			}
+			fmt.Fprintf(&b, "%s%s -> %s", indent(depth+1), pat, format(a.Body, depth+1, precAny))
+			if i < len(e.Arms)-1 {
+				b.WriteString(";")
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s}", indent(depth))
+		return b.String()
+
+	case LetRec:
+		var b strings.Builder
+		b.WriteString("letrec\n")
+		for i, x := range e.Bindings {
+			fmt.Fprintf(&b, "%s%s(%s) = %s", indent(depth+1), x.Var.Name, formatVars(x.Fn.Vars), format(x.Fn.Body, depth+1, precAny))
+			if i < len(e.Bindings)-1 {
+				b.WriteString(";")
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%sin %s", indent(depth), format(e.Body, depth, precAny))
+		if min > precAny {
+			return fmt.Sprintf("(%s)", b.String())
+		}
+		return b.String()
+
+	case NewPrompt:
+		return "newPrompt()"
+
+	case PushPrompt:
+		return formatDelimit("pushPrompt", e.Prompt, e.Scope, depth)
+
+	case Reset:
+		return formatDelimit("reset", e.Prompt, e.Body, depth)
+
+	case Prompt0:
+		return formatDelimit("prompt0", e.Prompt, e.Body, depth)
+
+	case PushSubCont:
+		return formatDelimit("pushSubCont", e.Cont, e.Scope, depth)
+
+	case WithSubCont:
+		return fmt.Sprintf("withSubCont(%s)", formatAll([]Expr{e.Prompt, e.Fn}, depth))
+
+	case Shift:
+		return fmt.Sprintf("shift(%s)", formatAll([]Expr{e.Prompt, e.Fn}, depth))
+
+	case Control0:
+		return fmt.Sprintf("control0(%s)", formatAll([]Expr{e.Prompt, e.Fn}, depth))
+
+	case Abort:
+		return fmt.Sprintf("abort(%s)", formatAll([]Expr{e.Prompt, e.Value}, depth))
+	}
+
+	return fmt.Sprintf("%#v", e)
+}
+
+// formatDelimit writes an operator that evaluates body within the delimiter given.
+func formatDelimit(op string, delimiter, body Expr, depth int) string {
+	return fmt.Sprintf("%s %s %s", op, format(delimiter, depth, precAny), block(format(body, depth+1, precAny), depth))
+}
@@ -0,0 +1,57 @@
+package cont
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestString(t *testing.T) {
+	p, k := Var{Name: "#prompt"}, Var{Name: "k"}
+
+	for _, test := range []struct {
+		name string
+		in   Expr
+		out  string
+	}{
+		{
+			name: "construct",
+			in:   Construct{Tag: 1, Args: []Expr{Prim{Op: prim.Add, Args: []Expr{Int{Value: 1}, Int{Value: 2}}}}},
+			out:  "#1(1 + 2)",
+		},
+		{
+			name: "prompts",
+			in: Apply{
+				Fn: Lambda{Vars: []Var{p}, Body: PushPrompt{Prompt: p, Scope: WithSubCont{
+					Prompt: p,
+					Fn:     Lambda{Vars: []Var{k}, Body: PushSubCont{Cont: k, Scope: Int{Value: 1}}},
+				}}},
+				Args: []Expr{NewPrompt{}},
+			},
+			out: "(fun(#prompt) {\n" +
+				"    pushPrompt #prompt {\n" +
+				"        withSubCont(#prompt, fun(k) { pushSubCont k { 1 } })\n" +
+				"    }\n" +
+				"})(newPrompt())",
+		},
+		{
+			name: "match",
+			in: Match{On: Var{Name: "o"}, Arms: []Arm{
+				{Body: Abort{Prompt: p, Value: Int{Value: 0}}},
+				{Vars: []Var{{Name: "x"}}, Body: Var{Name: "x"}},
+			}},
+			out: "match o {\n" +
+				"    #0 -> abort(#prompt, 0);\n" +
+				"    #1(x) -> x\n" +
+				"}",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out := fmt.Sprint(test.in)
+			if out != test.out {
+				t.Errorf("got\n%s\nexpecting\n%s", out, test.out)
+			}
+		})
+	}
+}
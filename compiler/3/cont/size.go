@@ -0,0 +1,69 @@
+package cont
+
+// Size counts the nodes in e.
+func Size(e Expr) int {
+	switch e := e.(type) {
+	case Var, Int, NewPrompt:
+		return 1
+
+	case Apply:
+		return 1 + Size(e.Fn) + sizeAll(e.Args)
+
+	case Lambda:
+		return 1 + Size(e.Body)
+
+	case PushPrompt:
+		return 1 + Size(e.Prompt) + Size(e.Scope)
+
+	case WithSubCont:
+		return 1 + Size(e.Prompt) + Size(e.Fn)
+
+	case PushSubCont:
+		return 1 + Size(e.Cont) + Size(e.Scope)
+
+	case Reset:
+		return 1 + Size(e.Prompt) + Size(e.Body)
+
+	case Shift:
+		return 1 + Size(e.Prompt) + Size(e.Fn)
+
+	case Prompt0:
+		return 1 + Size(e.Prompt) + Size(e.Body)
+
+	case Control0:
+		return 1 + Size(e.Prompt) + Size(e.Fn)
+
+	case Abort:
+		return 1 + Size(e.Prompt) + Size(e.Value)
+
+	case Prim:
+		return 1 + sizeAll(e.Args)
+
+	case Construct:
+		return 1 + sizeAll(e.Args)
+
+	case Match:
+		n := 1 + Size(e.On)
+		for _, a := range e.Arms {
+			n += Size(a.Body)
+		}
+		return n
+
+	case LetRec:
+		n := 1 + Size(e.Body)
+		for _, b := range e.Bindings {
+			n += Size(b.Fn)
+		}
+		return n
+	}
+
+	panic("unreachable")
+}
+
+func sizeAll(es []Expr) int {
+	n := 0
+	for _, e := range es {
+		n += Size(e)
+	}
+	return n
+}
@@ -0,0 +1,153 @@
+package cps
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errNotData = errors.New("cannot log value")
+var errDiverged = errors.New("replay diverged from log")
+var errBadLog = errors.New("malformed log")
+
+// A log has a line for each effect handled by the host, in the order that they were signalled. Each
+// line is a JSON object giving the effect, its arguments and the value that the program was resumed
+// with. Only integers and constructed values can be logged, as functions and objects do not mean
+// anything outside of the run that made them.
+
+type logEntry struct {
+	Effect string        `json:"effect"`
+	Args   []loggedValue `json:"args,omitempty"`
+	Value  loggedValue   `json:"value"`
+}
+
+// loggedValue is an integer if Int is set, and a constructed value otherwise.
+type loggedValue struct {
+	Int    *int          `json:"int,omitempty"`
+	Tag    int           `json:"tag,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Fields []loggedValue `json:"fields,omitempty"`
+}
+
+// Recorder passes effects on to another host, writing each of them to a log along with the value
+// that the program was resumed with.
+type Recorder struct {
+	host Host
+	log  *json.Encoder
+}
+
+// Replayer stands in for a host, resuming the program with the values from a log written by a
+// Recorder. Signalling anything other than what was logged, in the same order, is an error.
+type Replayer struct {
+	effects []string
+	log     []logEntry
+	next    int
+}
+
+func NewRecorder(host Host, log io.Writer) *Recorder {
+	return &Recorder{host: host, log: json.NewEncoder(log)}
+}
+
+func (r *Recorder) Effects() []string {
+	return r.host.Effects()
+}
+
+func (r *Recorder) Handle(effect string, args []prim.Value) (prim.Value, error) {
+	v, err := r.host.Handle(effect, args)
+	if err != nil {
+		return nil, err
+	}
+	e := logEntry{Effect: effect}
+	if e.Args, err = logValues(args); err != nil {
+		return nil, err
+	}
+	if e.Value, err = logValue(v); err != nil {
+		return nil, err
+	}
+	return v, r.log.Encode(e)
+}
+
+// NewReplayer reads a log, to replay a run that handled effects with host. The host itself is not
+// called.
+func NewReplayer(host Host, log io.Reader) (*Replayer, error) {
+	r := &Replayer{effects: host.Effects()}
+	lines := bufio.NewScanner(log)
+	for lines.Scan() {
+		var e logEntry
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %s", errBadLog, len(r.log)+1, err)
+		}
+		r.log = append(r.log, e)
+	}
+	return r, lines.Err()
+}
+
+func (r *Replayer) Effects() []string {
+	return r.effects
+}
+
+func (r *Replayer) Handle(effect string, args []prim.Value) (prim.Value, error) {
+	logged, err := logValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if r.next == len(r.log) {
+		return nil, fmt.Errorf("%w: %s signalled after the end of the log", errDiverged, effect)
+	}
+	e := r.log[r.next]
+	r.next++
+	if e.Effect != effect || !reflect.DeepEqual(e.Args, logged) {
+		return nil, fmt.Errorf("%w: entry %d: expecting %s%v, got %s%v", errDiverged, r.next, e.Effect, e.Args, effect, logged)
+	}
+	return e.Value.value(), nil
+}
+
+// Finished reports whether every entry in the log has been replayed.
+func (r *Replayer) Finished() bool {
+	return r.next == len(r.log)
+}
+
+func logValue(v prim.Value) (loggedValue, error) {
+	switch v := v.(type) {
+	case prim.Int:
+		i := int(v)
+		return loggedValue{Int: &i}, nil
+
+	case prim.Con:
+		fields, err := logValues(v.Fields)
+		return loggedValue{Tag: v.Tag, Name: v.Name, Fields: fields}, err
+	}
+	return loggedValue{}, fmt.Errorf("%w: %s", errNotData, v)
+}
+
+func logValues(vs []prim.Value) ([]loggedValue, error) {
+	var res []loggedValue
+	for _, v := range vs {
+		l, err := logValue(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+func (l loggedValue) value() prim.Value {
+	if l.Int != nil {
+		return prim.Int(*l.Int)
+	}
+	var fields []prim.Value
+	for _, f := range l.Fields {
+		fields = append(fields, f.value())
+	}
+	return prim.Con{Tag: l.Tag, Name: l.Name, Fields: fields}
+}
+
+func (l loggedValue) String() string {
+	return l.value().String()
+}
@@ -0,0 +1,117 @@
+package cps
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+// counter resumes next with successive integers and wrap with its argument in a constructor.
+type counter struct {
+	n int
+}
+
+func (c *counter) Effects() []string {
+	return []string{"next", "wrap"}
+}
+
+func (c *counter) Handle(effect string, args []prim.Value) (prim.Value, error) {
+	if effect == "wrap" {
+		return prim.Con{Tag: 1, Name: "some", Fields: args}, nil
+	}
+	c.n++
+	return prim.Int(c.n), nil
+}
+
+type signal struct {
+	effect string
+	args   []prim.Value
+}
+
+func TestRecordReplay(t *testing.T) {
+	run := []signal{
+		{effect: "next"},
+		{effect: "wrap", args: []prim.Value{prim.Int(7)}},
+		{effect: "next"},
+	}
+	var log strings.Builder
+	rec := NewRecorder(&counter{n: 40}, &log)
+	var recorded []prim.Value
+	for _, s := range run {
+		v, err := rec.Handle(s.effect, s.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorded = append(recorded, v)
+	}
+	want := `{"effect":"next","value":{"int":41}}
+{"effect":"wrap","args":[{"int":7}],"value":{"tag":1,"name":"some","fields":[{"int":7}]}}
+{"effect":"next","value":{"int":42}}
+`
+	if log.String() != want {
+		t.Errorf("got\n%s\nexpecting\n%s", log.String(), want)
+	}
+
+	// the host's own state makes no difference on replay
+	rep, err := NewReplayer(&counter{}, strings.NewReader(log.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range run {
+		v, err := rep.Handle(s.effect, s.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(v, recorded[i]) {
+			t.Errorf("got %s, expecting %s", v, recorded[i])
+		}
+	}
+	if !rep.Finished() {
+		t.Error("log not finished")
+	}
+	if _, err := rep.Handle("next", nil); !errors.Is(err, errDiverged) {
+		t.Errorf("got %v, expecting %v", err, errDiverged)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	log := `{"effect":"wrap","args":[{"int":7}],"value":{"tag":1,"name":"some","fields":[{"int":7}]}}`
+	for _, test := range []struct {
+		name string
+		in   signal
+		err  error
+	}{
+		{
+			name: "otherEffect",
+			in:   signal{effect: "next"},
+			err:  errDiverged,
+		},
+		{
+			name: "otherArgs",
+			in:   signal{effect: "wrap", args: []prim.Value{prim.Int(8)}},
+			err:  errDiverged,
+		},
+		{
+			name: "notData",
+			in:   signal{effect: "wrap", args: []prim.Value{prim.Object{}}},
+			err:  errNotData,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rep, err := NewReplayer(&counter{}, strings.NewReader(log))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rep.Handle(test.in.effect, test.in.args); !errors.Is(err, test.err) {
+				t.Errorf("got %v, expecting %v", err, test.err)
+			}
+		})
+	}
+
+	if _, err := NewReplayer(&counter{}, strings.NewReader("{")); !errors.Is(err, errBadLog) {
+		t.Errorf("got %v, expecting %v", err, errBadLog)
+	}
+}
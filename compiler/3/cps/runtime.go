@@ -0,0 +1,409 @@
+// The runtime for programs in continuation passing style, as produced by c2l.
+//
+// Such programs never return from a call, so there is no stack. Instead, the continuation up to each
+// prompt is kept by the runtime in a meta-continuation: pushing a prompt saves the continuation of
+// the scope there, and the scope is given a continuation that returns to whatever was saved.
+package cps
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errUnbound = errors.New("unbound variable")
+var errNoPrompt = errors.New("prompt not found")
+var errWrongArgCount = errors.New("wrong number of arguments")
+var errNoHost = errors.New("no host to handle effect")
+
+// ErrSuspend is returned by a host's Handle to suspend the program before the effect is handled. The
+// effect is signalled to the host again when the program is resumed.
+var ErrSuspend = errors.New("suspended by host")
+
+// Caller calls functions on behalf of the runtime. Calls are made in tail position, so an
+// evaluator should make the call once the builtin making it has finished.
+type Caller interface {
+	Call(f prim.Value, args []prim.Value)
+}
+
+// Host handles the effects that a program leaves to its outermost handler, resuming the program with
+// the value returned.
+type Host interface {
+	Effects() []string
+	Handle(effect string, args []prim.Value) (prim.Value, error)
+}
+
+// Runtime is the state of the runtime for one run of a program.
+type Runtime struct {
+	// Host, if set, handles effects that the program does not. It must be set before any globals are
+	// looked up.
+	Host Host
+
+	meta    []frame
+	prompts int
+	done    bool
+	result  prim.Value
+
+	sched scheduler
+
+	// restored maps the ids of prompts from a suspended program to the prompts recreated for them
+	restored map[int]*prompt
+}
+
+// frame is either a prompt or a continuation saved beneath one.
+type frame struct {
+	prompt *prompt
+	k      prim.Value
+}
+
+// Builtin is a function provided by the runtime. Builtins with a negative arity take any number of
+// arguments.
+type Builtin struct {
+	name  string
+	arity int
+	fn    func(c Caller, args []prim.Value) error
+}
+
+type prompt struct {
+	id int
+}
+
+type subCont struct {
+	frames []frame
+}
+
+func (b *Builtin) String() string {
+	return b.name
+}
+
+func (p *prompt) String() string {
+	return fmt.Sprintf("<prompt %d>", p.id)
+}
+
+func (k *subCont) String() string {
+	return "<subcont>"
+}
+
+// Call applies b to args.
+func (b *Builtin) Call(c Caller, args []prim.Value) error {
+	if b.arity >= 0 && len(args) != b.arity {
+		return fmt.Errorf("%w: %s expects %d, got %d", errWrongArgCount, b.name, b.arity, len(args))
+	}
+	return b.fn(c, args)
+}
+
+// Done reports whether the program has finished, and if so what its result was.
+func (r *Runtime) Done() (prim.Value, bool) {
+	return r.result, r.done
+}
+
+// Return is the continuation of a program, or of the scope of a prompt. It passes its argument on to
+// the continuation saved by the most recent prompt. If there is none, it finishes the running thread,
+// which for the main thread finishes the program.
+func (r *Runtime) Return() prim.Value {
+	return &Builtin{name: "runtime.return", arity: 1, fn: r.ret}
+}
+
+func (r *Runtime) ret(c Caller, args []prim.Value) error {
+	for len(r.meta) != 0 {
+		f := r.meta[len(r.meta)-1]
+		r.meta = r.meta[:len(r.meta)-1]
+		if f.k != nil {
+			c.Call(f.k, args)
+			return nil
+		}
+	}
+	if r.sched.current != 0 {
+		return r.finish(c, args[0])
+	}
+	r.done = true
+	r.result = args[0]
+	return nil
+}
+
+// Global provides the names that the runtime defines.
+func (r *Runtime) Global(name string) (prim.Value, error) {
+	switch {
+	case strings.HasPrefix(name, "."):
+		return &Builtin{name: name, arity: 2, fn: func(c Caller, args []prim.Value) error {
+			return selectFrom(name, c, args)
+		}}, nil
+
+	case name == "runtime.return":
+		return r.Return(), nil
+
+	case name == "#handler":
+		return r.handlerObject(), nil
+
+	case name == "runtime.emptyObject":
+		return prim.Object{}, nil
+
+	case strings.HasPrefix(name, "host."):
+		return r.hostHandler(strings.TrimPrefix(name, "host.")), nil
+
+	case name == "runtime.extendObject":
+		return &Builtin{name: name, arity: 4, fn: extendObject}, nil
+
+	case name == "runtime.newPrompt":
+		return &Builtin{name: name, arity: 1, fn: r.newPrompt}, nil
+
+	case name == "runtime.pushPrompt":
+		return &Builtin{name: name, arity: 3, fn: r.pushPrompt}, nil
+
+	case name == "runtime.withSubCont":
+		return &Builtin{name: name, arity: 3, fn: r.withSubCont}, nil
+
+	case name == "runtime.pushSubCont":
+		return &Builtin{name: name, arity: 3, fn: r.pushSubCont}, nil
+
+	case name == "runtime.abort":
+		return &Builtin{name: name, arity: 2, fn: r.abort}, nil
+	}
+	if b, ok := r.concurrency(name); ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errUnbound, name)
+}
+
+// handlerObject is the outermost handler object, with an entry for each effect that the scheduler
+// or the host handles. The host's take precedence.
+func (r *Runtime) handlerObject() prim.Object {
+	var o prim.Object
+	for _, effect := range Concurrency {
+		b, _ := r.concurrency("runtime." + effect)
+		o = o.Extend("."+effect, b)
+	}
+	if r.Host == nil {
+		return o
+	}
+	for _, effect := range r.Host.Effects() {
+		o = o.Extend("."+effect, r.hostHandler(effect))
+	}
+	return o
+}
+
+// hostHandler is called like a tail resumptive effect handler, with the effect's arguments followed
+// by the continuation.
+func (r *Runtime) hostHandler(effect string) prim.Value {
+	return &Builtin{name: "host." + effect, arity: -1, fn: func(c Caller, args []prim.Value) error {
+		if len(args) == 0 {
+			return fmt.Errorf("%w: %s expects a continuation", errWrongArgCount, effect)
+		}
+		if r.Host == nil {
+			return fmt.Errorf("%w: %s", errNoHost, effect)
+		}
+		v, err := r.Host.Handle(effect, args[:len(args)-1])
+		if err != nil {
+			return fmt.Errorf("%s: %w", effect, err)
+		}
+		c.Call(args[len(args)-1], []prim.Value{v})
+		return nil
+	}}
+}
+
+func (r *Runtime) newPrompt(c Caller, args []prim.Value) error {
+	r.prompts++
+	c.Call(args[0], []prim.Value{&prompt{id: r.prompts}})
+	return nil
+}
+
+func (r *Runtime) pushPrompt(c Caller, args []prim.Value) error {
+	p, ok := args[0].(*prompt)
+	if !ok {
+		return fmt.Errorf("%w: expecting a prompt, got %s", prim.ErrType, args[0])
+	}
+	r.pushK(args[2])
+	r.meta = append(r.meta, frame{prompt: p})
+	c.Call(args[1], []prim.Value{r.Return()})
+	return nil
+}
+
+// withSubCont captures the continuation up to the nearest instance of the prompt, including the
+// current one, and passes it on.
+func (r *Runtime) withSubCont(c Caller, args []prim.Value) error {
+	frames, err := r.capture(args[0])
+	if err != nil {
+		return err
+	}
+	if !isReturn(args[2]) {
+		frames = append(frames, frame{k: args[2]})
+	}
+	c.Call(args[1], []prim.Value{&subCont{frames: frames}, r.Return()})
+	return nil
+}
+
+func (r *Runtime) pushSubCont(c Caller, args []prim.Value) error {
+	k, ok := args[0].(*subCont)
+	if !ok {
+		return fmt.Errorf("%w: expecting a subcontinuation, got %s", prim.ErrType, args[0])
+	}
+	r.pushK(args[2])
+	r.meta = append(r.meta, k.frames...)
+	c.Call(args[1], []prim.Value{r.Return()})
+	return nil
+}
+
+// pushK saves the continuation k beneath whatever is pushed next. A continuation that returns would
+// only pass its argument on to the frame beneath it, so it is left out, just as a call in tail
+// position does not grow the stack. Otherwise handlers that resume repeatedly, such as those of
+// generators, would build up frames that have to be copied each time the continuation is captured.
+func (r *Runtime) pushK(k prim.Value) {
+	if !isReturn(k) {
+		r.meta = append(r.meta, frame{k: k})
+	}
+}
+
+func isReturn(v prim.Value) bool {
+	b, ok := v.(*Builtin)
+	return ok && b.name == "runtime.return"
+}
+
+func (r *Runtime) abort(c Caller, args []prim.Value) error {
+	if _, err := r.capture(args[0]); err != nil {
+		return err
+	}
+	c.Call(r.Return(), args[1:])
+	return nil
+}
+
+// capture removes the frames above the nearest instance of the prompt v, and the prompt itself,
+// returning the frames. Frames are never modified, so they may be shared.
+func (r *Runtime) capture(v prim.Value) ([]frame, error) {
+	p, ok := v.(*prompt)
+	if !ok {
+		return nil, fmt.Errorf("%w: expecting a prompt, got %s", prim.ErrType, v)
+	}
+	for i := len(r.meta) - 1; i >= 0; i-- {
+		if r.meta[i].prompt != p {
+			continue
+		}
+		frames := make([]frame, len(r.meta)-i-1, len(r.meta)-i)
+		copy(frames, r.meta[i+1:])
+		r.meta = r.meta[:i]
+		return frames, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errNoPrompt, p)
+}
+
+// selectFrom looks up an entry in an object.
+func selectFrom(name string, c Caller, args []prim.Value) error {
+	o, ok := args[0].(prim.Object)
+	if !ok {
+		return fmt.Errorf("%w: cannot select %s from %s", prim.ErrType, name, args[0])
+	}
+	v, err := o.Select(name)
+	if err != nil {
+		return err
+	}
+	c.Call(args[1], []prim.Value{v})
+	return nil
+}
+
+func extendObject(c Caller, args []prim.Value) error {
+	s, ok := args[0].(*Builtin)
+	if !ok || !strings.HasPrefix(s.name, ".") {
+		return fmt.Errorf("%w: expecting a selector, got %s", prim.ErrType, args[0])
+	}
+	o, ok := args[1].(prim.Object)
+	if !ok {
+		return fmt.Errorf("%w: expecting an object, got %s", prim.ErrType, args[1])
+	}
+	c.Call(args[3], []prim.Value{o.Extend(s.name, args[2])})
+	return nil
+}
+
+// Frame describes an entry in the meta-continuation for a debugger. Either Prompt is set, or K is the
+// continuation saved beneath a prompt.
+type Frame struct {
+	Prompt prim.Value
+	K      prim.Value
+}
+
+// Meta lists the frames of the meta-continuation, the most recent last.
+func (r *Runtime) Meta() []Frame {
+	return describe(r.meta)
+}
+
+// Captured lists the frames of a captured subcontinuation, the most recent last, reporting whether
+// v is one.
+func Captured(v prim.Value) ([]Frame, bool) {
+	k, ok := v.(*subCont)
+	if !ok {
+		return nil, false
+	}
+	return describe(k.frames), true
+}
+
+// PromptID reports the identity of v, if it is a prompt, for writing a suspended program out.
+func PromptID(v prim.Value) (int, bool) {
+	p, ok := v.(*prompt)
+	if !ok {
+		return 0, false
+	}
+	return p.id, true
+}
+
+// Prompt recreates the prompt from a suspended program with the id given. Asking for the same id
+// twice gives the same prompt, and prompts made afterwards will not share its id.
+func (r *Runtime) Prompt(id int) prim.Value {
+	if p, ok := r.restored[id]; ok {
+		return p
+	}
+	if r.restored == nil {
+		r.restored = map[int]*prompt{}
+	}
+	p := &prompt{id: id}
+	r.restored[id] = p
+	if id > r.prompts {
+		r.prompts = id
+	}
+	return p
+}
+
+// SubCont recreates a captured subcontinuation from its frames, as listed by Captured.
+func SubCont(frames []Frame) (prim.Value, error) {
+	fs, err := restore(frames)
+	if err != nil {
+		return nil, err
+	}
+	return &subCont{frames: fs}, nil
+}
+
+// Restore replaces the meta-continuation with the frames given, as listed by Meta.
+func (r *Runtime) Restore(meta []Frame) error {
+	fs, err := restore(meta)
+	if err != nil {
+		return err
+	}
+	r.meta = fs
+	return nil
+}
+
+func restore(frames []Frame) ([]frame, error) {
+	res := make([]frame, len(frames))
+	for i, f := range frames {
+		if f.Prompt == nil {
+			res[i].k = f.K
+			continue
+		}
+		p, ok := f.Prompt.(*prompt)
+		if !ok {
+			return nil, fmt.Errorf("%w: expecting a prompt, got %s", prim.ErrType, f.Prompt)
+		}
+		res[i].prompt = p
+	}
+	return res, nil
+}
+
+func describe(frames []frame) []Frame {
+	res := make([]Frame, len(frames))
+	for i, f := range frames {
+		if f.prompt != nil {
+			res[i].Prompt = f.prompt
+		}
+		res[i].K = f.k
+	}
+	return res
+}
@@ -0,0 +1,48 @@
+package cps
+
+import (
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+// lastCall keeps the most recent call made by the runtime rather than making it.
+type lastCall struct {
+	f    prim.Value
+	args []prim.Value
+}
+
+func (c *lastCall) Call(f prim.Value, args []prim.Value) {
+	c.f, c.args = f, args
+}
+
+func TestResumeRepeatedly(t *testing.T) {
+	r := &Runtime{}
+	var c lastCall
+	call := func(name string, args ...prim.Value) {
+		t.Helper()
+		f, err := r.Global(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.(*Builtin).Call(&c, args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	body := prim.Int(0)
+
+	call("runtime.newPrompt", body)
+	p := c.args[0]
+	call("runtime.pushPrompt", p, body, r.Return())
+
+	// a handler that resumes in tail position each time, as a consumer of a generator does
+	for i := 0; i < 100; i++ {
+		call("runtime.withSubCont", p, body, r.Return())
+		k := c.args[0]
+		call("runtime.pushPrompt", p, body, r.Return())
+		call("runtime.pushSubCont", k, body, r.Return())
+	}
+	if n := len(r.Meta()); n != 1 {
+		t.Errorf("got %d frames, expecting just the prompt", n)
+	}
+}
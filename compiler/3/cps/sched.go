@@ -0,0 +1,254 @@
+package cps
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errDeadlock = errors.New("deadlock: every thread is blocked")
+var errNoThread = errors.New("no such thread")
+var errNoChannel = errors.New("no such channel")
+
+// Concurrency lists the effects handled by the runtime's scheduler. They are handled outside of the
+// program, like those of the host.
+//
+//	thread.fork(f)     runs f() in a new thread, resuming with the thread's id
+//	thread.yield()     lets other threads run, resuming with 0
+//	thread.await(t)    waits for thread t to finish, resuming with its result
+//	thread.channel()   makes a channel, resuming with its id
+//	thread.send(c, v)  sends v on channel c, resuming with 0
+//	thread.recv(c)     waits for a value on channel c, resuming with it
+//
+// They are named apart from the effects of programs, such as the yield of a generator.
+//
+// Threads are cooperative, switching only when one yields or blocks. Each thread has its own
+// meta-continuation, so handlers installed by one do not affect the others, and a new thread starts
+// with only the outermost handler. Channels are buffered without limit, so sending never blocks. The
+// program finishes when its main thread does, whether or not the others have.
+var Concurrency = []string{"thread.fork", "thread.yield", "thread.await", "thread.channel", "thread.send", "thread.recv"}
+
+// scheduler holds the threads that are not running. Threads and channels share a series of ids, with
+// the main thread as 0.
+type scheduler struct {
+	ids      int
+	current  int
+	ready    []*thread
+	results  map[int]prim.Value
+	awaiting map[int][]*thread
+	channels map[int]*channel
+}
+
+// thread is a thread that is not running, which continues by calling fn with args.
+type thread struct {
+	id   int
+	fn   prim.Value
+	args []prim.Value
+	meta []frame
+}
+
+type channel struct {
+	values    []prim.Value
+	receivers []*thread
+}
+
+func (r *Runtime) concurrency(name string) (prim.Value, bool) {
+	switch name {
+	case "runtime.thread.fork":
+		return &Builtin{name: name, arity: 2, fn: r.fork}, true
+	case "runtime.thread.yield":
+		return &Builtin{name: name, arity: 1, fn: r.yield}, true
+	case "runtime.thread.await":
+		return &Builtin{name: name, arity: 2, fn: r.await}, true
+	case "runtime.thread.channel":
+		return &Builtin{name: name, arity: 1, fn: r.channel}, true
+	case "runtime.thread.send":
+		return &Builtin{name: name, arity: 3, fn: r.send}, true
+	case "runtime.thread.recv":
+		return &Builtin{name: name, arity: 2, fn: r.recv}, true
+	}
+	return nil, false
+}
+
+// Threads reports the number of threads that are not finished, including the running one.
+func (r *Runtime) Threads() int {
+	n := 1 + len(r.sched.ready)
+	for _, ts := range r.sched.awaiting {
+		n += len(ts)
+	}
+	for _, c := range r.sched.channels {
+		n += len(c.receivers)
+	}
+	return n
+}
+
+// Scheduler describes what the scheduler keeps besides the threads, for writing out a suspended
+// program: the last id given to a thread or channel, the results of finished threads by id, and the
+// values waiting to be received on each channel by id.
+type Scheduler struct {
+	IDs      int
+	Results  map[int]prim.Value
+	Channels map[int][]prim.Value
+}
+
+// Scheduler describes the scheduler. Only when the program has a single thread is this all of its
+// state.
+func (r *Runtime) Scheduler() Scheduler {
+	s := Scheduler{IDs: r.sched.ids, Results: map[int]prim.Value{}, Channels: map[int][]prim.Value{}}
+	for id, v := range r.sched.results {
+		s.Results[id] = v
+	}
+	for id, c := range r.sched.channels {
+		s.Channels[id] = append([]prim.Value(nil), c.values...)
+	}
+	return s
+}
+
+// RestoreScheduler replaces the scheduler's state with that described, as given by Scheduler, leaving
+// the running thread as the only one.
+func (r *Runtime) RestoreScheduler(s Scheduler) {
+	r.sched = scheduler{
+		ids:      s.IDs,
+		results:  map[int]prim.Value{},
+		awaiting: map[int][]*thread{},
+		channels: map[int]*channel{},
+	}
+	for id, v := range s.Results {
+		r.sched.results[id] = v
+	}
+	for id, vs := range s.Channels {
+		r.sched.channels[id] = &channel{values: append([]prim.Value(nil), vs...)}
+	}
+}
+
+// park stops the running thread, so that calling fn continues it.
+func (r *Runtime) park(fn prim.Value) *thread {
+	return &thread{id: r.sched.current, fn: fn, meta: r.meta}
+}
+
+// schedule runs the next thread that is ready.
+func (r *Runtime) schedule(c Caller) error {
+	s := &r.sched
+	if len(s.ready) == 0 {
+		return errDeadlock
+	}
+	t := s.ready[0]
+	s.ready = s.ready[1:]
+	s.current = t.id
+	r.meta = t.meta
+	c.Call(t.fn, t.args)
+	return nil
+}
+
+func (r *Runtime) wake(t *thread, v prim.Value) {
+	t.args = []prim.Value{v}
+	r.sched.ready = append(r.sched.ready, t)
+}
+
+// finish records the result of a thread other than the main one, waking those waiting for it.
+func (r *Runtime) finish(c Caller, v prim.Value) error {
+	s := &r.sched
+	s.results[s.current] = v
+	for _, t := range s.awaiting[s.current] {
+		r.wake(t, v)
+	}
+	delete(s.awaiting, s.current)
+	return r.schedule(c)
+}
+
+func (r *Runtime) newID() int {
+	s := &r.sched
+	if s.results == nil {
+		s.results = map[int]prim.Value{}
+		s.awaiting = map[int][]*thread{}
+		s.channels = map[int]*channel{}
+	}
+	s.ids++
+	return s.ids
+}
+
+// fork starts f with the outermost handler object, and a continuation that finishes the thread.
+func (r *Runtime) fork(c Caller, args []prim.Value) error {
+	id := r.newID()
+	r.sched.awaiting[id] = nil
+	r.sched.ready = append(r.sched.ready, &thread{
+		id:   id,
+		fn:   args[0],
+		args: []prim.Value{r.handlerObject(), r.Return()},
+	})
+	c.Call(args[1], []prim.Value{prim.Int(id)})
+	return nil
+}
+
+func (r *Runtime) yield(c Caller, args []prim.Value) error {
+	r.wake(r.park(args[0]), prim.Int(0))
+	return r.schedule(c)
+}
+
+func (r *Runtime) await(c Caller, args []prim.Value) error {
+	id, ok := args[0].(prim.Int)
+	if !ok {
+		return fmt.Errorf("%w: expecting a thread, got %s", prim.ErrType, args[0])
+	}
+	s := &r.sched
+	if v, ok := s.results[int(id)]; ok {
+		c.Call(args[1], []prim.Value{v})
+		return nil
+	}
+	waiting, ok := s.awaiting[int(id)]
+	if !ok {
+		return fmt.Errorf("%w: %d", errNoThread, id)
+	}
+	s.awaiting[int(id)] = append(waiting, r.park(args[1]))
+	return r.schedule(c)
+}
+
+func (r *Runtime) channel(c Caller, args []prim.Value) error {
+	id := r.newID()
+	r.sched.channels[id] = &channel{}
+	c.Call(args[0], []prim.Value{prim.Int(id)})
+	return nil
+}
+
+func (r *Runtime) lookupChannel(v prim.Value) (*channel, error) {
+	id, ok := v.(prim.Int)
+	if !ok {
+		return nil, fmt.Errorf("%w: expecting a channel, got %s", prim.ErrType, v)
+	}
+	ch, ok := r.sched.channels[int(id)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", errNoChannel, id)
+	}
+	return ch, nil
+}
+
+func (r *Runtime) send(c Caller, args []prim.Value) error {
+	ch, err := r.lookupChannel(args[0])
+	if err != nil {
+		return err
+	}
+	if len(ch.receivers) != 0 {
+		r.wake(ch.receivers[0], args[1])
+		ch.receivers = ch.receivers[1:]
+	} else {
+		ch.values = append(ch.values, args[1])
+	}
+	c.Call(args[2], []prim.Value{prim.Int(0)})
+	return nil
+}
+
+func (r *Runtime) recv(c Caller, args []prim.Value) error {
+	ch, err := r.lookupChannel(args[0])
+	if err != nil {
+		return err
+	}
+	if len(ch.values) != 0 {
+		v := ch.values[0]
+		ch.values = ch.values[1:]
+		c.Call(args[1], []prim.Value{v})
+		return nil
+	}
+	ch.receivers = append(ch.receivers, r.park(args[1]))
+	return r.schedule(c)
+}
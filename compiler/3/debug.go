@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/host"
+	"github.com/bobappleyard/goose/prim"
+)
+
+var (
+	errUsage    = errors.New("usage: goose debug [-break breakpoints] [-resume suspension] file")
+	errNoTarget = errors.New("needs a block or an effect")
+	errNoFile   = errors.New("needs a file")
+)
+
+const debugHelp = `step [n]     run the next n steps, or one
+continue     run until a breakpoint or the end of the program
+break n      stop on entering block n
+break name   stop when the effect name is signalled
+clear n      remove the breakpoint on block n, or on the effect name
+breaks       list the breakpoints
+suspend file write the state of the program to file, to be resumed with -resume
+list         show the current block
+frame        show the arguments, free variables and values pushed by the current block
+globals      show the globals
+prompts      show the prompt stack and any subcontinuations that the current block can see
+help         show this message
+quit         leave
+`
+
+func runDebug(args []string) {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	breaks := flags.String("break", "", "comma-separated blocks to stop on entering, or effects to stop on signalling")
+	resume := flags.String("resume", "", "a file written by suspend, to continue the program from")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fail(errUsage)
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	effects := host.Standard(os.Stdout, time.Now)
+	s, err := newDebugSession(os.Stdout, src, effects)
+	if err != nil {
+		fail(err)
+	}
+	if *resume != "" {
+		data, err := ioutil.ReadFile(*resume)
+		if err != nil {
+			fail(err)
+		}
+		if s.d, err = bc.ResumeDebugger(s.prog, data, effects); err != nil {
+			fail(err)
+		}
+	}
+	if *breaks != "" {
+		for _, b := range strings.Split(*breaks, ",") {
+			s.breakpoint(false, b)
+		}
+	}
+	if err := s.run(os.Stdin); err != nil {
+		fail(err)
+	}
+}
+
+// debugSession reads commands for a debugger running a program.
+type debugSession struct {
+	out  io.Writer
+	prog bc.Program
+	d    *bc.Debugger
+}
+
+func newDebugSession(out io.Writer, src string, effects cps.Host) (*debugSession, error) {
+	p, err := host.CompileForDebugger(src, append(effects.Effects(), cps.Concurrency...)...)
+	if err != nil {
+		return nil, err
+	}
+	d, err := bc.NewDebugger(p, effects)
+	if err != nil {
+		return nil, err
+	}
+	return &debugSession{out: out, prog: p, d: d}, nil
+}
+
+func (s *debugSession) run(in io.Reader) error {
+	s.where()
+	lines := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, "(debug) ")
+		if !lines.Scan() {
+			fmt.Fprintln(s.out)
+			return lines.Err()
+		}
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "q" {
+			return nil
+		}
+		s.command(fields)
+	}
+}
+
+func (s *debugSession) report(err error) {
+	fmt.Fprintf(s.out, "error: %v\n", err)
+}
+
+func (s *debugSession) command(fields []string) {
+	switch fields[0] {
+	case "step", "s":
+		n := 1
+		if len(fields) > 1 {
+			var err error
+			if n, err = strconv.Atoi(fields[1]); err != nil {
+				s.report(err)
+				return
+			}
+		}
+		for i := 0; i < n; i++ {
+			if err := s.d.Step(); err != nil {
+				s.report(err)
+				return
+			}
+		}
+		s.where()
+
+	case "continue", "c":
+		if err := s.d.Continue(); err != nil {
+			s.report(err)
+			return
+		}
+		s.where()
+
+	case "break", "b", "clear":
+		if len(fields) != 2 {
+			s.report(fmt.Errorf("%s %w", fields[0], errNoTarget))
+			return
+		}
+		s.breakpoint(fields[0] == "clear", fields[1])
+
+	case "breaks":
+		fmt.Fprintln(s.out, s.d.Breakpoints(), s.d.EffectBreakpoints())
+
+	case "suspend":
+		if len(fields) != 2 {
+			s.report(fmt.Errorf("suspend %w", errNoFile))
+			return
+		}
+		data, err := s.d.Suspend()
+		if err == nil {
+			err = ioutil.WriteFile(fields[1], data, 0666)
+		}
+		if err != nil {
+			s.report(err)
+		}
+
+	case "list", "l":
+		s.list()
+
+	case "frame", "f":
+		s.frame()
+
+	case "globals", "g":
+		for i, v := range s.d.State().Globals {
+			fmt.Fprintf(s.out, "%s = %s\n", s.prog.Globals[i].Name, bc.Describe(v))
+		}
+
+	case "prompts", "p":
+		s.prompts()
+
+	case "help", "h":
+		fmt.Fprint(s.out, debugHelp)
+
+	default:
+		s.report(fmt.Errorf("%w %s, try help", errUnknownCommand, fields[0]))
+	}
+}
+
+// breakpoint sets or clears a breakpoint on a block, given by its number, or on an effect.
+func (s *debugSession) breakpoint(clear bool, at string) {
+	b, err := strconv.Atoi(at)
+	switch {
+	case err != nil && clear:
+		s.d.ClearEffect(at)
+	case err != nil:
+		s.d.BreakEffect(at)
+	case clear:
+		s.d.Clear(b)
+	default:
+		if err := s.d.Break(b); err != nil {
+			s.report(err)
+		}
+	}
+}
+
+// where shows what happens next.
+func (s *debugSession) where() {
+	if v, done := s.d.Done(); done {
+		fmt.Fprintf(s.out, "finished: %s\n", v)
+		return
+	}
+	st := s.d.State()
+	if st.Block == -1 {
+		fmt.Fprintf(s.out, "call %s(%s)\n", bc.Describe(st.Fn), describeAll(st.Args))
+		return
+	}
+	step := s.prog.Blocks[st.Block].Steps[st.Next]
+	fmt.Fprintf(s.out, "block %d, step %d: %s\n", st.Block, st.Next, strings.ReplaceAll(fmt.Sprint(step), "\t", " "))
+}
+
+func (s *debugSession) list() {
+	st := s.d.State()
+	if st.Block == -1 {
+		s.where()
+		return
+	}
+	b := s.prog.Blocks[st.Block]
+	fmt.Fprintf(s.out, "block %d: free %v, bound %v\n", st.Block, b.Free, b.Bound)
+	for i, step := range b.Steps {
+		mark := "  "
+		if i == st.Next {
+			mark = "=>"
+		}
+		fmt.Fprintf(s.out, "%s %d: %s\n", mark, i, strings.ReplaceAll(fmt.Sprint(step), "\t", " "))
+	}
+}
+
+func (s *debugSession) frame() {
+	st := s.d.State()
+	if st.Block == -1 {
+		s.where()
+		return
+	}
+	b := s.prog.Blocks[st.Block]
+	for i, v := range st.Args {
+		fmt.Fprintf(s.out, "bound %s = %s\n", b.Bound[i].Name, bc.Describe(v))
+	}
+	for _, v := range st.Extra {
+		fmt.Fprintf(s.out, "extra %s\n", bc.Describe(v))
+	}
+	for i, v := range st.Free {
+		fmt.Fprintf(s.out, "free %s = %s\n", b.Free[i].Name, bc.Describe(v))
+	}
+	for i, v := range st.Frame {
+		fmt.Fprintf(s.out, "frame %d = %s\n", i, bc.Describe(v))
+	}
+}
+
+// prompts shows the meta-continuation, most recent first, followed by the frames of any captured
+// subcontinuations among the values that the current block can see.
+func (s *debugSession) prompts() {
+	st := s.d.State()
+	writeFrames(s.out, st.Meta, "")
+
+	seen := append(append(append(append([]prim.Value{st.Fn}, st.Args...), st.Extra...), st.Free...), st.Frame...)
+	for _, v := range seen {
+		if frames, ok := cps.Captured(v); ok {
+			fmt.Fprintln(s.out, "subcont:")
+			writeFrames(s.out, frames, "    ")
+		}
+	}
+}
+
+func writeFrames(w io.Writer, frames []cps.Frame, indent string) {
+	if len(frames) == 0 {
+		fmt.Fprintf(w, "%s(empty)\n", indent)
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		if f.Prompt != nil {
+			fmt.Fprintf(w, "%sprompt %s\n", indent, f.Prompt)
+		} else {
+			fmt.Fprintf(w, "%sreturn to %s\n", indent, bc.Describe(f.K))
+		}
+	}
+}
+
+func describeAll(vs []prim.Value) string {
+	strs := make([]string, len(vs))
+	for i, v := range vs {
+		strs[i] = bc.Describe(v)
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/host"
+)
+
+func TestDebugSession(t *testing.T) {
+	var out strings.Builder
+	s, err := newDebugSession(&out, "handle { 1 + signal ask() } with { ask() -> 2 * resume(20) }", host.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(strings.NewReader("break 5\ncontinue\nprompts\nframe\ncontinue\nstep\nquit\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"call <closure 0>(<builtin runtime.return>)",
+		"(debug) (debug) block 5, step 0: BLOCK 6",
+		"(debug) prompt <prompt 1>",
+		"return to <closure 7>",
+		"subcont:",
+		"    return to <closure 10>",
+		"(debug) bound #k75 = <builtin runtime.return>",
+		"free #promptK = <subcont>",
+		"(debug) finished: 42",
+		"(debug) error: program has finished",
+		"(debug) ",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("got\n%s\nexpecting\n%s", out.String(), want)
+	}
+}
+
+// TestDebugSessionEffect stops where an effect is signalled, even though its clause is known where it
+// is signalled and could be called directly.
+func TestDebugSessionEffect(t *testing.T) {
+	var out strings.Builder
+	s, err := newDebugSession(&out, "handle { 1 + signal ask() } with { ask() -> resume(2) }", host.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(strings.NewReader("break ask\ncontinue\ncontinue\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"call <closure 0>(<builtin runtime.return>)",
+		"(debug) (debug) call <builtin .ask>({.ask .thread.recv .thread.send .thread.channel .thread.await .thread.yield .thread.fork}, <closure 3>)",
+		"(debug) finished: 3",
+		"(debug) \n",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("got\n%s\nexpecting\n%s", out.String(), want)
+	}
+}
+
+func TestDebugSessionHost(t *testing.T) {
+	var out strings.Builder
+	s, err := newDebugSession(&out, "signal console.print(1) + 1", host.Standard(&out, time.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(strings.NewReader("continue\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := "(debug) 1\nfinished: 1\n(debug) \n"
+	if got := out.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("got\n%s\nexpecting it to end with\n%s", got, want)
+	}
+}
+
+func TestDebugSessionTypes(t *testing.T) {
+	if _, err := newDebugSession(io.Discard, "(fun(x) { x + 1 })(true)", host.New()); err == nil || err.Error() != "type mismatch: int and bool" {
+		t.Errorf("got %v, expecting a type error", err)
+	}
+}
+
+// TestSuspendGenerated suspends generated programs between calls and resumes them from what was
+// written, checking that they give the same result as the reference interpreter.
+func TestSuspendGenerated(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		h := handler.Generate(rand.New(rand.NewSource(seed)), 30)
+		want, err := handler.Eval(h)
+		if err != nil {
+			t.Fatalf("reference: %v\n%s", err, h)
+		}
+		m := host.Pipeline()
+		m.StopAfter = "l2b"
+		ir, err := m.Run(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := ir.(bc.Program)
+		d, err := bc.NewDebugger(p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		calls := 0
+		for {
+			if _, done := d.Done(); done {
+				break
+			}
+			if d.State().Block == -1 {
+				calls++
+				if calls%5 == 0 {
+					data, err := d.Suspend()
+					if err != nil {
+						t.Fatalf("%v\n%s", err, h)
+					}
+					if d, err = bc.ResumeDebugger(p, data, nil); err != nil {
+						t.Fatalf("%v\n%s", err, h)
+					}
+				}
+			}
+			if err := d.Step(); err != nil {
+				t.Fatalf("%v\n%s", err, h)
+			}
+		}
+		if got, _ := d.Done(); got.String() != want.String() {
+			t.Errorf("got %s, expecting %s\n%s", got, want, h)
+		}
+	}
+}
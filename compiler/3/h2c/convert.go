@@ -6,199 +6,812 @@ import (
 
 	"github.com/bobappleyard/goose/cont"
 	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/prim"
 )
 
 var errUnsupportedSyntax = errors.New("unsupported syntax")
 var errNotInHandler = errors.New("not in a handler")
+var errWrongArgCount = errors.New("wrong number of arguments")
+var errUnknownConstructor = errors.New("unknown constructor")
+var errBadMatch = errors.New("bad match")
 
 var (
 	handlerVariable = cont.Var{Name: "#handler"}
 	promptVariable  = cont.Var{Name: "#prompt"}
-	scopeVariable   = cont.Var{Name: "#scope"}
 	promptKVariable = cont.Var{Name: "#promptK"}
-	scopeKVariable  = cont.Var{Name: "#scopeK"}
+	resumeVariable  = cont.Var{Name: "#resume"}
+	valueVariable   = cont.Var{Name: "#value"}
+	siteVariable    = cont.Var{Name: "#site"}
+	forwardVariable = cont.Var{Name: "#forward"}
+	replyVariable   = cont.Var{Name: "#reply"}
+	selfVariable    = cont.Var{Name: "#self"}
+	resultVariable  = cont.Var{Name: "#result"}
+	emptyObject     = cont.Var{Name: "runtime.emptyObject"}
 )
 
+const returnEffect = "#return"
+
+// ConvertExpr translates e into the continuation calculus. Functions that are known never to signal an
+// effect are left without the handler object, as are the calls made to them.
 func ConvertExpr(e handler.Expr, inHandler bool) (cont.Expr, error) {
+	return convertExpr(handler.MarkPure(e), scope{inHandler: inHandler})
+}
+
+// ConvertExprForDebugger translates e as ConvertExpr does, except that every signal looks its clause
+// up in the handler object, rather than calling those of enclosing handle expressions directly. A
+// debugger sees the lookup, so it can stop wherever an effect is signalled.
+func ConvertExprForDebugger(e handler.Expr) (cont.Expr, error) {
+	return convertExpr(handler.MarkPure(e), scope{lookup: true})
+}
+
+// scope tracks what is visible at a point in the program being converted.
+type scope struct {
+	inHandler    bool
+	shallow      bool
+	tailResume   bool
+	pure         bool
+	constructors map[string]constructor
+
+	// clauses holds the handler clauses known to be in effect, by effect. These are the clauses of the
+	// deep handle expressions that enclose this point without an intervening function, and they are
+	// bound to variables so that signals can call them directly.
+	clauses map[string]cont.Var
+
+	// lookup leaves clauses empty, so that every signal looks its clause up in the handler object.
+	lookup bool
+}
+
+type constructor struct {
+	data     string
+	tag      int
+	arity    int
+	siblings int
+}
+
+func (s scope) enterHandler(shallow bool) scope {
+	s.inHandler = true
+	s.shallow = shallow
+	s.tailResume = false
+	return s
+}
+
+func (s scope) enterTailResumptive() scope {
+	s = s.enterHandler(false)
+	s.tailResume = true
+	return s
+}
+
+// handlerObject is the handler object to pass on to functions that are not pure. Pure functions do not
+// have one, but nor do they signal, so anything they call does without.
+func (s scope) handlerObject() cont.Expr {
+	if s.pure {
+		return emptyObject
+	}
+	return handlerVariable
+}
+
+// handle makes the clauses known within the handled expression, in place of any for the same effects.
+func (s scope) handle(cs []clause) scope {
+	if s.lookup {
+		return s
+	}
+	clauses := map[string]cont.Var{}
+	for effect, v := range s.clauses {
+		clauses[effect] = v
+	}
+	for _, c := range cs {
+		clauses[c.effect] = c.v
+	}
+	s.clauses = clauses
+	return s
+}
+
+// forget removes the clauses for effects that a shallow handle expression handles, as they are no
+// longer the ones in effect once the computation is resumed.
+func (s scope) forget(hs []handler.EffectHandler) scope {
+	clauses := map[string]cont.Var{}
+	for effect, v := range s.clauses {
+		clauses[effect] = v
+	}
+	for _, h := range hs {
+		delete(clauses, h.Effect)
+	}
+	s.clauses = clauses
+	return s
+}
+
+func (s scope) declare(d handler.Data) scope {
+	constructors := map[string]constructor{}
+	for name, c := range s.constructors {
+		constructors[name] = c
+	}
+	for i, c := range d.Constructors {
+		constructors[c.Name] = constructor{
+			data:     d.Name,
+			tag:      i,
+			arity:    len(c.Fields),
+			siblings: len(d.Constructors),
+		}
+	}
+	s.constructors = constructors
+	return s
+}
+
+func convertExpr(e handler.Expr, s scope) (cont.Expr, error) {
 	switch e := e.(type) {
 
 	case handler.Var:
-		return convertVariable(e, inHandler)
+		return convertVariable(e, s)
 
 	case handler.Apply:
-		return convertApply(e, inHandler)
+		return convertApply(e, s)
 
 	case handler.Lambda:
-		return convertLambda(e, inHandler)
+		return convertLambda(e, s)
 
 	case handler.Handle:
-		return convertHandle(e, inHandler)
+		return convertHandle(e, s)
 
 	case handler.Signal:
-		return convertSignal(e, inHandler)
+		return convertSignal(e, s)
 
 	case handler.Resume:
-		return convertResume(e, inHandler)
+		return convertResume(e, s)
+
+	case handler.Int:
+		return convertInt(e, s)
+
+	case handler.Prim:
+		return convertPrim(e, s)
+
+	case handler.Bool:
+		return convertBool(e, s)
+
+	case handler.If:
+		return convertIf(e, s)
+
+	case handler.Data:
+		return convertData(e, s)
+
+	case handler.Construct:
+		return convertConstruct(e, s)
+
+	case handler.Match:
+		return convertMatch(e, s)
+
+	case handler.LetRec:
+		return convertLetRec(e, s)
 
 	}
 
 	return nil, fmt.Errorf("%w: %s", errUnsupportedSyntax, e)
 }
 
-func convertVariable(e handler.Var, inHandler bool) (cont.Expr, error) {
+func convertVariable(e handler.Var, s scope) (cont.Expr, error) {
 	return cont.Var{Name: e.Name}, nil
 }
 
-func convertApply(e handler.Apply, inHandler bool) (cont.Expr, error) {
-	arg, err := ConvertExpr(e.Arg, inHandler)
+func convertInt(e handler.Int, s scope) (cont.Expr, error) {
+	return cont.Int{Value: e.Value}, nil
+}
+
+func convertPrim(e handler.Prim, s scope) (cont.Expr, error) {
+	if len(e.Args) != e.Op.Arity() {
+		return nil, fmt.Errorf("%w: %s takes %d, got %d", errWrongArgCount, e.Op, e.Op.Arity(), len(e.Args))
+	}
+
+	args, err := convertExprs(e.Args, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return cont.Prim{Op: e.Op, Args: args}, nil
+}
+
+func convertExprs(es []handler.Expr, s scope) ([]cont.Expr, error) {
+	res := make([]cont.Expr, len(es))
+	for i, e := range es {
+		c, err := convertExpr(e, s)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = c
+	}
+	return res, nil
+}
+
+// Booleans are constructors of a built-in data type, so conditionals become matches on that type.
+
+func convertBool(e handler.Bool, s scope) (cont.Expr, error) {
+	if e.Value {
+		return cont.Construct{Tag: prim.True}, nil
+	}
+	return cont.Construct{Tag: prim.False}, nil
+}
+
+func convertIf(e handler.If, s scope) (cont.Expr, error) {
+	cond, err := convertExpr(e.Cond, s)
+	if err != nil {
+		return nil, err
+	}
+
+	then, err := convertExpr(e.Then, s)
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := ConvertExpr(e.Fn, inHandler)
+	els, err := convertExpr(e.Else, s)
 	if err != nil {
 		return nil, err
 	}
 
+	arms := make([]cont.Arm, 2)
+	arms[prim.False] = cont.Arm{Body: els}
+	arms[prim.True] = cont.Arm{Body: then}
+
+	return cont.Match{On: cond, Arms: arms}, nil
+}
+
+func convertData(e handler.Data, s scope) (cont.Expr, error) {
+	return convertExpr(e.Body, s.declare(e))
+}
+
+func convertConstruct(e handler.Construct, s scope) (cont.Expr, error) {
+	c, ok := s.constructors[e.Constructor]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownConstructor, e.Constructor)
+	}
+	if len(e.Args) != c.arity {
+		return nil, fmt.Errorf("%w: %s takes %d, got %d", errWrongArgCount, e.Constructor, c.arity, len(e.Args))
+	}
+
+	args, err := convertExprs(e.Args, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return cont.Construct{Tag: c.tag, Args: args}, nil
+}
+
+// convertMatch orders the cases by tag. Every constructor of the type must be covered exactly once.
+func convertMatch(e handler.Match, s scope) (cont.Expr, error) {
+	on, err := convertExpr(e.On, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.Cases) == 0 {
+		return nil, fmt.Errorf("%w: no cases", errBadMatch)
+	}
+	first, ok := s.constructors[e.Cases[0].Constructor]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownConstructor, e.Cases[0].Constructor)
+	}
+
+	arms := make([]cont.Arm, first.siblings)
+	seen := make([]bool, first.siblings)
+	for _, m := range e.Cases {
+		c, ok := s.constructors[m.Constructor]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnknownConstructor, m.Constructor)
+		}
+		if c.data != first.data || c.siblings != first.siblings {
+			return nil, fmt.Errorf("%w: %s is not a constructor of %s", errBadMatch, m.Constructor, first.data)
+		}
+		if seen[c.tag] {
+			return nil, fmt.Errorf("%w: %s is matched more than once", errBadMatch, m.Constructor)
+		}
+		if len(m.Vars) != c.arity {
+			return nil, fmt.Errorf("%w: %s takes %d, got %d", errWrongArgCount, m.Constructor, c.arity, len(m.Vars))
+		}
+
+		body, err := convertExpr(m.Body, s)
+		if err != nil {
+			return nil, err
+		}
+
+		var vars []cont.Var
+		for _, v := range m.Vars {
+			vars = append(vars, cont.Var{Name: v})
+		}
+
+		seen[c.tag] = true
+		arms[c.tag] = cont.Arm{Vars: vars, Body: body}
+	}
+
+	for _, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("%w: not every constructor of %s is matched", errBadMatch, first.data)
+		}
+	}
+
+	return cont.Match{On: on, Arms: arms}, nil
+}
+
+// convertApply passes the handler object after the arguments, unless the function is pure.
+func convertApply(e handler.Apply, s scope) (cont.Expr, error) {
+	f, err := convertExpr(e.Fn, s)
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := convertExprs(e.Args, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.Pure {
+		args = append(args, s.handlerObject())
+	}
+
 	return cont.Apply{
-		Fn:  cont.Apply{Fn: f, Arg: arg},
-		Arg: handlerVariable,
+		Fn:   f,
+		Args: args,
 	}, nil
 }
 
-func convertLambda(e handler.Lambda, inHandler bool) (cont.Expr, error) {
-	body, err := ConvertExpr(e.Body, inHandler)
+func convertLambda(e handler.Lambda, s scope) (cont.Expr, error) {
+	fn, err := convertFn(e, s)
 	if err != nil {
 		return nil, err
 	}
+	return fn, nil
+}
+
+// convertFn converts a function, which is given the handler object of wherever it is called from, so
+// the clauses in effect where it is defined are not necessarily in effect within it.
+func convertFn(e handler.Lambda, s scope) (cont.Lambda, error) {
+	s.pure = e.Pure
+	s.clauses = nil
+	body, err := convertExpr(e.Body, s)
+	if err != nil {
+		return cont.Lambda{}, err
+	}
+
+	vars := convertVars(e.Vars)
+	if !e.Pure {
+		vars = append(vars, handlerVariable)
+	}
 
 	return cont.Lambda{
-		Var:  cont.Var{Name: e.Var},
-		Body: cont.Lambda{Var: handlerVariable, Body: body},
+		Vars: vars,
+		Body: body,
 	}, nil
 }
 
-func convertHandle(e handler.Handle, inHandler bool) (cont.Expr, error) {
-	eval, err := ConvertExpr(e.Eval, inHandler)
+func convertVars(names []string) []cont.Var {
+	var vars []cont.Var
+	for _, name := range names {
+		vars = append(vars, cont.Var{Name: name})
+	}
+	return vars
+}
+
+func convertLetRec(e handler.LetRec, s scope) (cont.Expr, error) {
+	bindings := make([]cont.Binding, len(e.Bindings))
+	for i, b := range e.Bindings {
+		fn, err := convertFn(b.Fn, s)
+		if err != nil {
+			return nil, err
+		}
+		bindings[i] = cont.Binding{Var: cont.Var{Name: b.Name}, Fn: fn}
+	}
+
+	body, err := convertExpr(e.Body, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return cont.LetRec{Bindings: bindings, Body: body}, nil
+}
+
+// convertHandle binds the clauses of the handler to variables, so that signals within the handled
+// expression may call them directly. The handler object is only built when the handled expression needs
+// it, to pass on to functions or to find the handlers of other effects. Likewise, the prompt is only
+// pushed if a clause captures the computation up to it.
+func convertHandle(e handler.Handle, s scope) (cont.Expr, error) {
+	if e.Shallow {
+		return convertShallowHandle(e, s)
+	}
+
+	clauses, err := convertHandlers(e.Handlers, s)
 	if err != nil {
 		return nil, err
 	}
 
-	handlerObj, err := convertHandlers(e.Handlers)
+	scope, err := convertExpr(e.Eval, s.handle(clauses))
 	if err != nil {
 		return nil, err
 	}
 
+	// Clauses are bound if they are called. If any are, the handler object refers to all of them by
+	// their variables, as a clause given directly would be within the scope of the others.
+	bound := make([]bool, len(clauses))
+	anyBound := false
+	for i, c := range clauses {
+		bound[i] = cont.Contains(c.v, scope)
+		anyBound = anyBound || bound[i]
+	}
+
+	if cont.Contains(handlerVariable, scope) {
+		var handlerObj cont.Expr = handlerVariable
+		for i, c := range clauses {
+			if anyBound {
+				bound[i] = true
+				handlerObj = extend(handlerObj, c.effect, c.v)
+				continue
+			}
+			handlerObj = extend(handlerObj, c.effect, c.fn)
+		}
+		scope = let(handlerVariable, handlerObj, scope)
+	}
+
+	var vars []cont.Var
+	var fns []cont.Expr
+	for i, c := range clauses {
+		if bound[i] {
+			vars = append(vars, c.v)
+			fns = append(fns, c.fn)
+		}
+	}
+	if len(vars) != 0 {
+		scope = apply(cont.Lambda{Vars: vars, Body: scope}, fns...)
+	}
+
+	// The return clause is within the prompt, so resuming the computation also resumes the clause.
+	if e.Return != nil {
+		ret, err := convertExpr(e.Return.Body, s)
+		if err != nil {
+			return nil, err
+		}
+		scope = let(cont.Var{Name: e.Return.Var}, scope, ret)
+	}
+
+	if !cont.Contains(promptVariable, scope) {
+		return scope, nil
+	}
+
 	return let(promptVariable, cont.NewPrompt{}, cont.PushPrompt{
 		Prompt: promptVariable,
-		Scope: cont.Apply{
-			Fn: cont.Lambda{
-				Var:  handlerVariable,
-				Body: eval,
-			},
-			Arg: handlerObj,
-		},
+		Scope:  scope,
 	}), nil
 }
 
 func let(n cont.Var, v cont.Expr, in cont.Expr) cont.Expr {
 	return cont.Apply{
 		Fn: cont.Lambda{
-			Var:  n,
+			Vars: []cont.Var{n},
 			Body: in,
 		},
-		Arg: v,
+		Args: []cont.Expr{v},
 	}
 }
 
 func apply(f cont.Expr, args ...cont.Expr) cont.Expr {
-	var res cont.Expr = f
-	for _, a := range args {
-		res = cont.Apply{
-			Fn:  res,
-			Arg: a,
+	return cont.Apply{
+		Fn:   f,
+		Args: args,
+	}
+}
+
+// clause is the function that handles an effect within a handle expression, and the variable that it
+// is bound to.
+type clause struct {
+	effect string
+	v      cont.Var
+	fn     cont.Expr
+}
+
+// convertHandlers converts the clauses of a deep handler. Any effects not handled here are passed on
+// to the enclosing handler object. Where an effect has more than one clause, the last is the one in
+// effect, as it is when the handler object is extended with each in turn.
+func convertHandlers(handlers []handler.EffectHandler, s scope) ([]clause, error) {
+	var res []clause
+	for i, h := range handlers {
+		if shadowed(h.Effect, handlers[i+1:]) {
+			continue
+		}
+
+		c := clause{effect: h.Effect, v: cont.Var{Name: "#clause." + h.Effect}}
+		if tailResumptive(h.Body) {
+			b, err := convertExpr(h.Body, s.enterTailResumptive())
+			if err != nil {
+				return nil, err
+			}
+			c.fn = cont.Lambda{Vars: convertVars(h.Vars), Body: b}
+		} else {
+			b, err := convertExpr(h.Body, s.enterHandler(false))
+			if err != nil {
+				return nil, err
+			}
+			c.fn = convertHandler(convertVars(h.Vars), b)
 		}
+		res = append(res, c)
 	}
-	return res
+
+	return res, nil
 }
 
-func convertHandlers(handlers []handler.EffectHandler) (cont.Expr, error) {
-	var res cont.Expr = cont.Var{Name: "runtime.emptyObject"}
+func shadowed(effect string, handlers []handler.EffectHandler) bool {
 	for _, h := range handlers {
-		b, err := ConvertExpr(h.Body, true)
-		if err != nil {
-			return nil, err
+		if h.Effect == effect {
+			return true
 		}
+	}
+	return false
+}
+
+func extend(obj cont.Expr, effect string, fn cont.Expr) cont.Expr {
+	return apply(cont.Var{Name: "runtime.extendObject"}, cont.Var{Name: "." + effect}, obj, fn)
+}
 
-		res = apply(
-			cont.Var{Name: "runtime.extendObject"},
-			cont.Var{Name: "." + h.Effect},
-			res,
-			convertHandler(cont.Var{Name: h.Var}, b),
-		)
+// tailResumptive checks whether every way through b ends by resuming, with no other resumes. Such
+// a handler has no need of the rest of the computation beyond returning to it, so it can run in place
+// without capturing it.
+func tailResumptive(b handler.Expr) bool {
+	switch b := b.(type) {
+	case handler.Resume:
+		return !containsResume(b.With)
+
+	case handler.If:
+		return !containsResume(b.Cond) && tailResumptive(b.Then) && tailResumptive(b.Else)
+
+	case handler.Match:
+		if containsResume(b.On) {
+			return false
+		}
+		for _, c := range b.Cases {
+			if !tailResumptive(c.Body) {
+				return false
+			}
+		}
+		return true
+
+	case handler.Data:
+		return tailResumptive(b.Body)
+
+	case handler.LetRec:
+		for _, x := range b.Bindings {
+			if containsResume(x.Fn) {
+				return false
+			}
+		}
+		return tailResumptive(b.Body)
 	}
 
-	return res, nil
+	return false
 }
 
-func convertHandler(v cont.Var, b cont.Expr) cont.Expr {
+// containsResume checks whether e resumes the computation suspended by the enclosing handler. Resume
+// expressions within the handlers of a nested handle expression refer to that instead.
+func containsResume(e handler.Expr) bool {
+	switch e := e.(type) {
+	case handler.Resume:
+		return true
+
+	case handler.Apply:
+		return containsResume(e.Fn) || anyContainsResume(e.Args)
+
+	case handler.Lambda:
+		return containsResume(e.Body)
+
+	case handler.Handle:
+		return containsResume(e.Eval) || e.Return != nil && containsResume(e.Return.Body)
+
+	case handler.Signal:
+		return anyContainsResume(e.Args)
+
+	case handler.Prim:
+		return anyContainsResume(e.Args)
+
+	case handler.If:
+		return containsResume(e.Cond) || containsResume(e.Then) || containsResume(e.Else)
+
+	case handler.Data:
+		return containsResume(e.Body)
+
+	case handler.Construct:
+		return anyContainsResume(e.Args)
+
+	case handler.Match:
+		if containsResume(e.On) {
+			return true
+		}
+		for _, c := range e.Cases {
+			if containsResume(c.Body) {
+				return true
+			}
+		}
+		return false
+
+	case handler.LetRec:
+		for _, b := range e.Bindings {
+			if containsResume(b.Fn) {
+				return true
+			}
+		}
+		return containsResume(e.Body)
+	}
+
+	return false
+}
+
+func anyContainsResume(es []handler.Expr) bool {
+	for _, e := range es {
+		if containsResume(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// convertHandler captures the computation up to the prompt, so that the handler body runs outside of
+// it. Resuming the computation reinstates the prompt along with it. This is bound to a variable
+// rather than referring to the prompt directly, as a handle expression within the body would
+// otherwise shadow it.
+func convertHandler(vs []cont.Var, b cont.Expr) cont.Expr {
 	return cont.Lambda{
-		Var: v,
+		Vars: vs,
 		Body: cont.WithSubCont{
 			Prompt: promptVariable,
 			Fn: cont.Lambda{
-				Var: promptKVariable,
-				Body: cont.PushPrompt{
-					Prompt: promptVariable,
-					Scope: let(scopeVariable, cont.NewPrompt{}, cont.PushPrompt{
-						Prompt: scopeVariable,
-						Scope:  b,
-					}),
-				},
+				Vars: []cont.Var{promptKVariable},
+				Body: let(resumeVariable, cont.Lambda{
+					Vars: []cont.Var{valueVariable},
+					Body: cont.PushPrompt{
+						Prompt: promptVariable,
+						Scope: cont.PushSubCont{
+							Cont:  promptKVariable,
+							Scope: valueVariable,
+						},
+					},
+				}, b),
 			},
 		},
 	}
 }
 
-func convertSignal(e handler.Signal, inHandler bool) (cont.Expr, error) {
-	arg, err := ConvertExpr(e.Arg, inHandler)
+// convertShallowHandle translates a handle expression that is not reinstated when the computation is
+// resumed. Every way out of the prompt produces a reply, a function that is given an object saying
+// what to do next. Returning from the handled expression replies with the value, while signalling one
+// of the handled effects replies with the effect's arguments and the captured computation.
+//
+// The handle expression gives the reply an object containing the effect handlers and the return
+// clause. Resuming gives it an object that instead passes the effects on to the handlers in effect
+// where the computation was resumed, and returns values unchanged.
+func convertShallowHandle(e handler.Handle, s scope) (cont.Expr, error) {
+	eval, err := convertExpr(e.Eval, s.forget(e.Handlers))
+	if err != nil {
+		return nil, err
+	}
+
+	identity := cont.Lambda{Vars: []cont.Var{resultVariable}, Body: resultVariable}
+	var handlerObj cont.Expr = handlerVariable
+	forwardObj := extend(emptyObject, returnEffect, identity)
+	replyObj := extend(emptyObject, returnEffect, identity)
+	if e.Return != nil {
+		ret, err := convertExpr(e.Return.Body, s)
+		if err != nil {
+			return nil, err
+		}
+		replyObj = extend(emptyObject, returnEffect, cont.Lambda{
+			Vars: []cont.Var{{Name: e.Return.Var}},
+			Body: ret,
+		})
+	}
+
+	for _, h := range e.Handlers {
+		b, err := convertExpr(h.Body, s.enterHandler(true))
+		if err != nil {
+			return nil, err
+		}
+		vars := convertVars(h.Vars)
+		args := make([]cont.Expr, len(vars))
+		for i, v := range vars {
+			args[i] = v
+		}
+		clauseVars := append(append([]cont.Var{selfVariable}, vars...), promptKVariable)
+
+		handlerObj = extend(handlerObj, h.Effect, cont.Lambda{
+			Vars: vars,
+			Body: cont.WithSubCont{
+				Prompt: promptVariable,
+				Fn: cont.Lambda{
+					Vars: []cont.Var{promptKVariable},
+					Body: cont.Lambda{
+						Vars: []cont.Var{replyVariable},
+						Body: apply(
+							apply(cont.Var{Name: "." + h.Effect}, replyVariable),
+							append(append([]cont.Expr{replyVariable}, args...), promptKVariable)...,
+						),
+					},
+				},
+			},
+		})
+
+		replyObj = extend(replyObj, h.Effect, cont.Lambda{
+			Vars: clauseVars,
+			Body: let(resumeVariable, cont.Lambda{
+				Vars: []cont.Var{valueVariable, siteVariable},
+				Body: apply(
+					cont.PushPrompt{
+						Prompt: promptVariable,
+						Scope: cont.PushSubCont{
+							Cont:  promptKVariable,
+							Scope: valueVariable,
+						},
+					},
+					apply(forwardVariable, siteVariable),
+				),
+			}, b),
+		})
+
+		forwardObj = extend(forwardObj, h.Effect, cont.Lambda{
+			Vars: clauseVars,
+			Body: apply(
+				cont.PushPrompt{
+					Prompt: promptVariable,
+					Scope: cont.PushSubCont{
+						Cont:  promptKVariable,
+						Scope: apply(apply(cont.Var{Name: "." + h.Effect}, siteVariable), args...),
+					},
+				},
+				selfVariable,
+			),
+		})
+	}
+
+	scope := let(handlerVariable, handlerObj, let(resultVariable, eval, cont.Lambda{
+		Vars: []cont.Var{replyVariable},
+		Body: apply(apply(cont.Var{Name: "." + returnEffect}, replyVariable), resultVariable),
+	}))
+
+	return let(promptVariable, cont.NewPrompt{}, let(
+		forwardVariable,
+		cont.Lambda{Vars: []cont.Var{siteVariable}, Body: forwardObj},
+		apply(cont.PushPrompt{Prompt: promptVariable, Scope: scope}, replyObj),
+	)), nil
+}
+
+func convertSignal(e handler.Signal, s scope) (cont.Expr, error) {
+	args, err := convertExprs(e.Args, s)
 	if err != nil {
 		return nil, err
 	}
 
+	if c, ok := s.clauses[e.Effect]; ok {
+		return apply(c, args...), nil
+	}
+
 	return cont.Apply{
-		Fn: cont.Apply{
-			Fn:  cont.Var{Name: "." + e.Effect},
-			Arg: handlerVariable,
-		},
-		Arg: arg,
+		Fn:   apply(cont.Var{Name: "." + e.Effect}, handlerVariable),
+		Args: args,
 	}, nil
 }
 
-func convertResume(e handler.Resume, inHandler bool) (cont.Expr, error) {
-	if !inHandler {
-		return nil, errNotInHandler
+func convertResume(e handler.Resume, s scope) (cont.Expr, error) {
+	if !s.inHandler {
+		return nil, fmt.Errorf("%s: %w", e.Pos, errNotInHandler)
 	}
 
-	with, err := ConvertExpr(e.With, inHandler)
+	with, err := convertExpr(e.With, s)
 	if err != nil {
 		return nil, err
 	}
 
-	return cont.WithSubCont{
-		Prompt: scopeVariable,
-		Fn: cont.Lambda{
-			Var: scopeKVariable,
-			Body: cont.PushPrompt{
-				Prompt: scopeVariable,
-				Scope: cont.PushSubCont{
-					Cont: scopeKVariable,
-					Scope: cont.PushSubCont{
-						Cont:  promptKVariable,
-						Scope: with,
-					},
-				},
-			},
-		},
+	// Resuming in tail position returns to where the effect was signalled, which is where the handler
+	// was called from.
+	if s.tailResume {
+		return with, nil
+	}
+
+	// Shallow handlers also need to know which handlers the computation is resumed under.
+	if s.shallow {
+		return apply(resumeVariable, with, handlerVariable), nil
+	}
+
+	return cont.Apply{
+		Fn:   resumeVariable,
+		Args: []cont.Expr{with},
 	}, nil
 }
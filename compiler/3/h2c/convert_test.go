@@ -1,11 +1,15 @@
 package h2c
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/bobappleyard/goose/cont"
 	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/prim"
 )
 
 func TestConvertExpr(t *testing.T) {
@@ -22,164 +26,433 @@ func TestConvertExpr(t *testing.T) {
 		{
 			name: "apply",
 			in: handler.Apply{
-				Fn:  handler.Var{Name: "function"},
-				Arg: handler.Var{Name: "arg"},
+				Fn:   handler.Var{Name: "function"},
+				Args: []handler.Expr{handler.Var{Name: "arg"}},
 			},
 			out: cont.Apply{
-				Fn: cont.Apply{
-					Fn:  cont.Var{Name: "function"},
-					Arg: cont.Var{Name: "arg"},
-				},
-				Arg: cont.Var{Name: "#handler"},
+				Fn:   cont.Var{Name: "function"},
+				Args: []cont.Expr{cont.Var{Name: "arg"}, cont.Var{Name: "#handler"}},
 			},
 		},
 		{
 			name: "lambda",
 			in: handler.Lambda{
-				Var:  "x",
+				Vars: []string{"x"},
 				Body: handler.Var{Name: "x"},
 			},
 			out: cont.Lambda{
-				Var: "x",
-				Body: cont.Lambda{
-					Var:  "#handler",
-					Body: cont.Var{Name: "x"},
+				Vars: []cont.Var{{Name: "x"}, {Name: "#handler"}},
+				Body: cont.Var{Name: "x"},
+			},
+		},
+		{
+			name: "pure",
+			in: handler.Apply{
+				Fn: handler.Lambda{
+					Vars: []string{"x", "y"},
+					Body: handler.Var{Name: "y"},
 				},
+				Args: []handler.Expr{handler.Var{Name: "a"}, handler.Var{Name: "b"}},
+			},
+			out: cont.Apply{
+				Fn: cont.Lambda{
+					Vars: []cont.Var{{Name: "x"}, {Name: "y"}},
+					Body: cont.Var{Name: "y"},
+				},
+				Args: []cont.Expr{cont.Var{Name: "a"}, cont.Var{Name: "b"}},
+			},
+		},
+		{
+			name: "impure",
+			in: handler.Apply{
+				Fn: handler.Lambda{
+					Vars: []string{"x", "y"},
+					Body: handler.Signal{Effect: "effect", Args: []handler.Expr{handler.Var{Name: "y"}}},
+				},
+				Args: []handler.Expr{handler.Var{Name: "a"}, handler.Var{Name: "b"}},
+			},
+			out: cont.Apply{
+				Fn: cont.Lambda{
+					Vars: []cont.Var{{Name: "x"}, {Name: "y"}, {Name: "#handler"}},
+					Body: cont.Apply{
+						Fn: cont.Apply{
+							Fn:   cont.Var{Name: ".effect"},
+							Args: []cont.Expr{cont.Var{Name: "#handler"}},
+						},
+						Args: []cont.Expr{cont.Var{Name: "y"}},
+					},
+				},
+				Args: []cont.Expr{cont.Var{Name: "a"}, cont.Var{Name: "b"}, cont.Var{Name: "#handler"}},
+			},
+		},
+		{
+			name: "pureCallsOut",
+			in: handler.Apply{
+				Fn: handler.Lambda{
+					Vars: []string{"x"},
+					Body: handler.Apply{Fn: handler.Var{Name: "f"}, Args: []handler.Expr{handler.Var{Name: "x"}}},
+				},
+				Args: []handler.Expr{handler.Var{Name: "a"}},
+			},
+			out: cont.Apply{
+				Fn: cont.Lambda{
+					Vars: []cont.Var{{Name: "x"}, {Name: "#handler"}},
+					Body: cont.Apply{
+						Fn:   cont.Var{Name: "f"},
+						Args: []cont.Expr{cont.Var{Name: "x"}, cont.Var{Name: "#handler"}},
+					},
+				},
+				Args: []cont.Expr{cont.Var{Name: "a"}, cont.Var{Name: "#handler"}},
 			},
 		},
 		{
 			name: "signal",
 			in: handler.Signal{
 				Effect: "effect",
-				Arg:    handler.Var{Name: "arg"},
+				Args:   []handler.Expr{handler.Var{Name: "arg"}},
 			},
 			out: cont.Apply{
 				Fn: cont.Apply{
-					Fn:  cont.Var{Name: ".effect"},
-					Arg: cont.Var{Name: "#handler"},
+					Fn:   cont.Var{Name: ".effect"},
+					Args: []cont.Expr{cont.Var{Name: "#handler"}},
+				},
+				Args: []cont.Expr{cont.Var{Name: "arg"}},
+			},
+		},
+		{
+			name: "int",
+			in:   handler.Int{Value: 42},
+			out:  cont.Int{Value: 42},
+		},
+		{
+			name: "prim",
+			in: handler.Prim{
+				Op: prim.Add,
+				Args: []handler.Expr{
+					handler.Var{Name: "x"},
+					handler.Prim{
+						Op:   prim.Mul,
+						Args: []handler.Expr{handler.Int{Value: 2}, handler.Var{Name: "y"}},
+					},
+				},
+			},
+			out: cont.Prim{
+				Op: prim.Add,
+				Args: []cont.Expr{
+					cont.Var{Name: "x"},
+					cont.Prim{
+						Op:   prim.Mul,
+						Args: []cont.Expr{cont.Int{Value: 2}, cont.Var{Name: "y"}},
+					},
+				},
+			},
+		},
+		{
+			name: "if",
+			in: handler.If{
+				Cond: handler.Bool{Value: true},
+				Then: handler.Int{Value: 1},
+				Else: handler.Int{Value: 2},
+			},
+			out: cont.Match{
+				On: cont.Construct{Tag: prim.True},
+				Arms: []cont.Arm{
+					{Body: cont.Int{Value: 2}},
+					{Body: cont.Int{Value: 1}},
 				},
-				Arg: cont.Var{Name: "arg"},
+			},
+		},
+		{
+			name: "match",
+			in: optionData(handler.Match{
+				On: handler.Construct{
+					Constructor: "some",
+					Args:        []handler.Expr{handler.Int{Value: 1}},
+				},
+				Cases: []handler.Case{
+					{
+						Constructor: "some",
+						Vars:        []string{"x"},
+						Body:        handler.Var{Name: "x"},
+					},
+					{
+						Constructor: "none",
+						Body:        handler.Int{Value: 0},
+					},
+				},
+			}),
+			out: cont.Match{
+				On: cont.Construct{
+					Tag:  1,
+					Args: []cont.Expr{cont.Int{Value: 1}},
+				},
+				Arms: []cont.Arm{
+					{Body: cont.Int{Value: 0}},
+					{Vars: []cont.Var{{Name: "x"}}, Body: cont.Var{Name: "x"}},
+				},
+			},
+		},
+		{
+			name: "letrec",
+			in: handler.LetRec{
+				Bindings: []handler.Binding{
+					{
+						Name: "loop",
+						Fn: handler.Lambda{
+							Vars: []string{"x"},
+							Body: handler.Apply{Fn: handler.Var{Name: "loop"}, Args: []handler.Expr{handler.Var{Name: "x"}}},
+						},
+					},
+				},
+				Body: handler.Var{Name: "loop"},
+			},
+			out: cont.LetRec{
+				Bindings: []cont.Binding{
+					{
+						Var: cont.Var{Name: "loop"},
+						Fn: cont.Lambda{
+							Vars: []cont.Var{{Name: "x"}, {Name: "#handler"}},
+							Body: cont.Apply{
+								Fn:   cont.Var{Name: "loop"},
+								Args: []cont.Expr{cont.Var{Name: "x"}, cont.Var{Name: "#handler"}},
+							},
+						},
+					},
+				},
+				Body: cont.Var{Name: "loop"},
 			},
 		},
 		{
 			name: "abortiveHandler",
 			in: handler.Handle{
-				Eval: handler.Apply{Fn: handler.Var{Name: "effectful"}, Arg: handler.Var{Name: "x"}},
+				Eval: handler.Apply{Fn: handler.Var{Name: "effectful"}, Args: []handler.Expr{handler.Var{Name: "x"}}},
 				Handlers: []handler.EffectHandler{
 					{
 						Effect: "effect",
-						Var:    "arg",
+						Vars:   []string{"arg"},
 						Body:   handler.Var{Name: "arg"},
 					},
 				},
 			},
-			out: cont.WithPrompt{
+			out: cont.Apply{
 				Fn: cont.Lambda{
-					Var: "#prompt",
-					Body: cont.Apply{
-						Fn: cont.Lambda{
-							Var: "#handler",
-							Body: cont.Apply{
-								Fn: cont.Apply{
-									Fn:  cont.Var{Name: "effectful"},
-									Arg: cont.Var{Name: "x"},
-								},
-								Arg: cont.Var{Name: "#handler"},
-							},
-						},
-						Arg: cont.Apply{
-							Fn: cont.Apply{
-								Fn: cont.Apply{
-									Fn:  cont.Var{Name: "object#extend"},
-									Arg: cont.Var{Name: ".effect"},
+					Vars: []cont.Var{{Name: "#prompt"}},
+					Body: cont.PushPrompt{
+						Prompt: cont.Var{Name: "#prompt"},
+						Scope: cont.Apply{
+							Fn: cont.Lambda{
+								Vars: []cont.Var{{Name: "#handler"}},
+								Body: cont.Apply{
+									Fn:   cont.Var{Name: "effectful"},
+									Args: []cont.Expr{cont.Var{Name: "x"}, cont.Var{Name: "#handler"}},
 								},
-								Arg: cont.Var{Name: "object#empty"},
 							},
-							Arg: cont.Lambda{
-								Var: "arg",
-								Body: cont.WithSubCont{
-									Prompt: cont.Var{Name: "#prompt"},
-									Fn: cont.Lambda{
-										Var: "#promptK",
-										Body: cont.WithPrompt{
-											Fn: cont.Lambda{
-												Var:  "#scope",
-												Body: cont.Var{Name: "arg"},
+							Args: []cont.Expr{cont.Apply{
+								Fn: cont.Var{Name: "runtime.extendObject"},
+								Args: []cont.Expr{cont.Var{Name: ".effect"}, cont.Var{Name: "#handler"}, cont.Lambda{
+									Vars: []cont.Var{{Name: "arg"}},
+									Body: cont.WithSubCont{
+										Prompt: cont.Var{Name: "#prompt"},
+										Fn: cont.Lambda{
+											Vars: []cont.Var{{Name: "#promptK"}},
+											Body: cont.Apply{
+												Fn: cont.Lambda{
+													Vars: []cont.Var{{Name: "#resume"}},
+													Body: cont.Var{Name: "arg"},
+												},
+												Args: []cont.Expr{cont.Lambda{
+													Vars: []cont.Var{{Name: "#value"}},
+													Body: cont.PushPrompt{
+														Prompt: cont.Var{Name: "#prompt"},
+														Scope: cont.PushSubCont{
+															Cont:  cont.Var{Name: "#promptK"},
+															Scope: cont.Var{Name: "#value"},
+														},
+													},
+												}},
 											},
 										},
 									},
-								},
-							},
+								}},
+							}},
 						},
 					},
 				},
+				Args: []cont.Expr{cont.NewPrompt{}},
 			},
 		},
 		{
 			name: "resumptiveHandler",
 			in: handler.Handle{
-				Eval: handler.Apply{Fn: handler.Var{Name: "effectful"}, Arg: handler.Var{Name: "x"}},
+				Eval: handler.Apply{Fn: handler.Var{Name: "effectful"}, Args: []handler.Expr{handler.Var{Name: "x"}}},
 				Handlers: []handler.EffectHandler{
 					{
 						Effect: "effect",
-						Var:    "arg",
-						Body: handler.Resume{
-							With: handler.Var{Name: "arg"},
+						Vars:   []string{"arg"},
+						Body: handler.Prim{
+							Op: prim.Add,
+							Args: []handler.Expr{
+								handler.Resume{With: handler.Var{Name: "arg"}},
+								handler.Var{Name: "arg"},
+							},
 						},
 					},
 				},
 			},
-			out: cont.WithPrompt{
+			out: cont.Apply{
 				Fn: cont.Lambda{
-					Var: "#prompt",
-					Body: cont.Apply{
-						Fn: cont.Lambda{
-							Var: "#handler",
-							Body: cont.Apply{
-								Fn: cont.Apply{
-									Fn:  cont.Var{Name: "effectful"},
-									Arg: cont.Var{Name: "x"},
-								},
-								Arg: cont.Var{Name: "#handler"},
-							},
-						},
-						Arg: cont.Apply{
-							Fn: cont.Apply{
-								Fn: cont.Apply{
-									Fn:  cont.Var{Name: "object#extend"},
-									Arg: cont.Var{Name: ".effect"},
+					Vars: []cont.Var{{Name: "#prompt"}},
+					Body: cont.PushPrompt{
+						Prompt: cont.Var{Name: "#prompt"},
+						Scope: cont.Apply{
+							Fn: cont.Lambda{
+								Vars: []cont.Var{{Name: "#handler"}},
+								Body: cont.Apply{
+									Fn:   cont.Var{Name: "effectful"},
+									Args: []cont.Expr{cont.Var{Name: "x"}, cont.Var{Name: "#handler"}},
 								},
-								Arg: cont.Var{Name: "object#empty"},
 							},
-							Arg: cont.Lambda{
-								Var: "arg",
-								Body: cont.WithSubCont{
-									Prompt: cont.Var{Name: "#prompt"},
-									Fn: cont.Lambda{
-										Var: "#promptK",
-										Body: cont.WithPrompt{
-											Fn: cont.Lambda{
-												Var: "#scope",
-												Body: cont.WithSubCont{
-													Prompt: cont.Var{Name: "#scope"},
-													Fn: cont.Lambda{
-														Var: "#scopeK",
-														Body: cont.PushSubCont{
-															Cont: cont.Var{Name: "#scopeK"},
-															Scope: cont.PushSubCont{
-																Cont:  cont.Var{Name: "#promptK"},
-																Scope: cont.Var{Name: "arg"},
+							Args: []cont.Expr{cont.Apply{
+								Fn: cont.Var{Name: "runtime.extendObject"},
+								Args: []cont.Expr{cont.Var{Name: ".effect"}, cont.Var{Name: "#handler"}, cont.Lambda{
+									Vars: []cont.Var{{Name: "arg"}},
+									Body: cont.WithSubCont{
+										Prompt: cont.Var{Name: "#prompt"},
+										Fn: cont.Lambda{
+											Vars: []cont.Var{{Name: "#promptK"}},
+											Body: cont.Apply{
+												Fn: cont.Lambda{
+													Vars: []cont.Var{{Name: "#resume"}},
+													Body: cont.Prim{
+														Op: prim.Add,
+														Args: []cont.Expr{
+															cont.Apply{
+																Fn:   cont.Var{Name: "#resume"},
+																Args: []cont.Expr{cont.Var{Name: "arg"}},
 															},
+															cont.Var{Name: "arg"},
 														},
 													},
 												},
+												Args: []cont.Expr{cont.Lambda{
+													Vars: []cont.Var{{Name: "#value"}},
+													Body: cont.PushPrompt{
+														Prompt: cont.Var{Name: "#prompt"},
+														Scope: cont.PushSubCont{
+															Cont:  cont.Var{Name: "#promptK"},
+															Scope: cont.Var{Name: "#value"},
+														},
+													},
+												}},
 											},
 										},
 									},
+								}},
+							}},
+						},
+					},
+				},
+				Args: []cont.Expr{cont.NewPrompt{}},
+			},
+		},
+		{
+			name: "tailResumptiveHandler",
+			in: handler.Handle{
+				Eval: handler.Apply{Fn: handler.Var{Name: "effectful"}, Args: []handler.Expr{handler.Var{Name: "x"}}},
+				Handlers: []handler.EffectHandler{
+					{
+						Effect: "effect",
+						Vars:   []string{"arg"},
+						Body: handler.If{
+							Cond: handler.Var{Name: "arg"},
+							Then: handler.Resume{With: handler.Int{Value: 1}},
+							Else: handler.Resume{With: handler.Int{Value: 2}},
+						},
+					},
+				},
+			},
+			out: cont.Apply{
+				Fn: cont.Lambda{
+					Vars: []cont.Var{{Name: "#handler"}},
+					Body: cont.Apply{
+						Fn:   cont.Var{Name: "effectful"},
+						Args: []cont.Expr{cont.Var{Name: "x"}, cont.Var{Name: "#handler"}},
+					},
+				},
+				Args: []cont.Expr{cont.Apply{
+					Fn: cont.Var{Name: "runtime.extendObject"},
+					Args: []cont.Expr{
+						cont.Var{Name: ".effect"},
+						cont.Var{Name: "#handler"},
+						cont.Lambda{
+							Vars: []cont.Var{{Name: "arg"}},
+							Body: cont.Match{
+								On: cont.Var{Name: "arg"},
+								Arms: []cont.Arm{
+									{Body: cont.Int{Value: 2}},
+									{Body: cont.Int{Value: 1}},
 								},
 							},
 						},
 					},
+				}},
+			},
+		},
+		{
+			name: "returnClause",
+			in: handler.Handle{
+				Eval: handler.Var{Name: "x"},
+				Return: &handler.ReturnClause{
+					Var:  "y",
+					Body: handler.Var{Name: "y"},
+				},
+			},
+			out: cont.Apply{
+				Fn: cont.Lambda{
+					Vars: []cont.Var{{Name: "y"}},
+					Body: cont.Var{Name: "y"},
+				},
+				Args: []cont.Expr{cont.Var{Name: "x"}},
+			},
+		},
+		{
+			name: "knownClause",
+			in: handler.Handle{
+				Eval: handler.Signal{Effect: "effect", Args: []handler.Expr{handler.Var{Name: "x"}}},
+				Handlers: []handler.EffectHandler{
+					{Effect: "effect", Vars: []string{"arg"}, Body: handler.Resume{With: handler.Var{Name: "arg"}}},
+				},
+			},
+			out: cont.Apply{
+				Fn: cont.Lambda{
+					Vars: []cont.Var{{Name: "#clause.effect"}},
+					Body: cont.Apply{
+						Fn:   cont.Var{Name: "#clause.effect"},
+						Args: []cont.Expr{cont.Var{Name: "x"}},
+					},
+				},
+				Args: []cont.Expr{cont.Lambda{
+					Vars: []cont.Var{{Name: "arg"}},
+					Body: cont.Var{Name: "arg"},
+				}},
+			},
+		},
+		{
+			name: "clauseNotKnownInFunction",
+			in: handler.Handle{
+				Eval: handler.Lambda{Body: handler.Signal{Effect: "effect"}},
+				Handlers: []handler.EffectHandler{
+					{Effect: "effect", Body: handler.Resume{With: handler.Int{Value: 1}}},
+				},
+			},
+			out: cont.Lambda{
+				Vars: []cont.Var{{Name: "#handler"}},
+				Body: cont.Apply{
+					Fn: cont.Apply{
+						Fn:   cont.Var{Name: ".effect"},
+						Args: []cont.Expr{cont.Var{Name: "#handler"}},
+					},
+					Args: []cont.Expr{},
 				},
 			},
 		},
@@ -195,3 +468,87 @@ func TestConvertExpr(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertExprForDebugger(t *testing.T) {
+	out, err := ConvertExprForDebugger(handler.Handle{
+		Eval: signal("effect"),
+		Handlers: []handler.EffectHandler{
+			{Effect: "effect", Body: resume(num(1))},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(out); strings.Contains(s, "#clause") || !strings.Contains(s, ".effect") {
+		t.Errorf("got %s, expecting the clause to be looked up in the handler object", s)
+	}
+}
+
+func TestConvertExprErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   handler.Expr
+		err  error
+	}{
+		{
+			name: "resumeOutsideHandler",
+			in:   handler.Resume{With: handler.Var{Name: "x"}},
+			err:  errNotInHandler,
+		},
+		{
+			name: "primArgCount",
+			in:   handler.Prim{Op: prim.Add, Args: []handler.Expr{handler.Int{Value: 1}}},
+			err:  errWrongArgCount,
+		},
+		{
+			name: "constructOutOfScope",
+			in:   handler.Construct{Constructor: "none"},
+			err:  errUnknownConstructor,
+		},
+		{
+			name: "constructArgCount",
+			in:   optionData(handler.Construct{Constructor: "some"}),
+			err:  errWrongArgCount,
+		},
+		{
+			name: "incompleteMatch",
+			in: optionData(handler.Match{
+				On: handler.Var{Name: "x"},
+				Cases: []handler.Case{
+					{Constructor: "none", Body: handler.Int{Value: 0}},
+				},
+			}),
+			err: errBadMatch,
+		},
+		{
+			name: "duplicateCase",
+			in: optionData(handler.Match{
+				On: handler.Var{Name: "x"},
+				Cases: []handler.Case{
+					{Constructor: "none", Body: handler.Int{Value: 0}},
+					{Constructor: "none", Body: handler.Int{Value: 1}},
+				},
+			}),
+			err: errBadMatch,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ConvertExpr(test.in, false)
+			if !errors.Is(err, test.err) {
+				t.Errorf("got %v, expecting %v", err, test.err)
+			}
+		})
+	}
+}
+
+func optionData(body handler.Expr) handler.Expr {
+	return handler.Data{
+		Name:   "option",
+		Params: []string{"a"},
+		Constructors: []handler.Constructor{
+			{Name: "none"},
+			{Name: "some", Fields: []handler.Type{handler.TypeVar{Name: "a"}}},
+		},
+		Body: body,
+	}
+}
@@ -0,0 +1,422 @@
+package h2c
+
+import (
+	"testing"
+
+	"github.com/bobappleyard/goose/cont"
+	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/prim"
+)
+
+func add(x, y handler.Expr) handler.Expr {
+	return handler.Prim{Op: prim.Add, Args: []handler.Expr{x, y}}
+}
+
+func mul(x, y handler.Expr) handler.Expr {
+	return handler.Prim{Op: prim.Mul, Args: []handler.Expr{x, y}}
+}
+
+func num(n int) handler.Expr {
+	return handler.Int{Value: n}
+}
+
+func ref(name string) handler.Expr {
+	return handler.Var{Name: name}
+}
+
+func signal(effect string, args ...handler.Expr) handler.Expr {
+	return handler.Signal{Effect: effect, Args: args}
+}
+
+func resume(with handler.Expr) handler.Expr {
+	return handler.Resume{With: with}
+}
+
+// TestEval checks that converted programs behave as the reference interpreter says they should, with
+// or without clauses being called directly.
+func TestEval(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   handler.Expr
+		out  prim.Value
+	}{
+		{
+			name: "returnClause",
+			in: handler.Handle{
+				Eval: num(1),
+				Return: &handler.ReturnClause{
+					Var:  "x",
+					Body: add(ref("x"), num(10)),
+				},
+			},
+			out: prim.Int(11),
+		},
+		{
+			name: "returnAfterResume",
+			in: handler.Handle{
+				Eval: add(signal("get", num(0)), num(1)),
+				Handlers: []handler.EffectHandler{
+					{Effect: "get", Vars: []string{"x"}, Body: mul(resume(num(5)), num(2))},
+				},
+				Return: &handler.ReturnClause{
+					Var:  "x",
+					Body: add(ref("x"), num(100)),
+				},
+			},
+			out: prim.Int(212),
+		},
+		{
+			name: "abort",
+			in: handler.Handle{
+				Eval: add(signal("fail", num(3)), num(1)),
+				Handlers: []handler.EffectHandler{
+					{Effect: "fail", Vars: []string{"x"}, Body: ref("x")},
+				},
+				Return: &handler.ReturnClause{
+					Var:  "x",
+					Body: num(0),
+				},
+			},
+			out: prim.Int(3),
+		},
+		{
+			name: "resumeOrder",
+			in: handler.Handle{
+				Eval: add(signal("ask", num(1)), mul(signal("ask", num(2)), num(10))),
+				Handlers: []handler.EffectHandler{
+					{Effect: "ask", Vars: []string{"x"}, Body: add(resume(add(ref("x"), num(1))), ref("x"))},
+				},
+			},
+			out: prim.Int(35),
+		},
+		{
+			name: "multiShot",
+			in: handler.Handle{
+				Eval: mul(signal("choose", num(0)), num(10)),
+				Handlers: []handler.EffectHandler{
+					{Effect: "choose", Vars: []string{"x"}, Body: add(resume(num(1)), resume(num(2)))},
+				},
+				Return: &handler.ReturnClause{
+					Var:  "x",
+					Body: add(ref("x"), num(1)),
+				},
+			},
+			out: prim.Int(32),
+		},
+		{
+			name: "forwarding",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: add(signal("outer", num(1)), signal("inner", num(2))),
+					Handlers: []handler.EffectHandler{
+						{Effect: "inner", Vars: []string{"x"}, Body: resume(mul(ref("x"), num(100)))},
+					},
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "outer", Vars: []string{"x"}, Body: resume(mul(ref("x"), num(10)))},
+				},
+			},
+			out: prim.Int(210),
+		},
+		{
+			name: "clauseUsesOuterHandler",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: signal("e", num(1)),
+					Handlers: []handler.EffectHandler{
+						{Effect: "e", Vars: []string{"x"}, Body: add(signal("e", ref("x")), num(1))},
+					},
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "e", Vars: []string{"x"}, Body: resume(mul(ref("x"), num(10)))},
+				},
+			},
+			out: prim.Int(11),
+		},
+		{
+			name: "functionUsesCallerHandler",
+			in: handler.Apply{
+				Fn: handler.Lambda{
+					Vars: []string{"f"},
+					Body: handler.Handle{
+						Eval: handler.Apply{Fn: ref("f"), Args: []handler.Expr{num(1)}},
+						Handlers: []handler.EffectHandler{
+							{Effect: "e", Vars: []string{"x"}, Body: resume(mul(ref("x"), num(7)))},
+						},
+					},
+				},
+				Args: []handler.Expr{handler.Lambda{Vars: []string{"y"}, Body: signal("e", ref("y"))}},
+			},
+			out: prim.Int(7),
+		},
+		{
+			name: "naryLambda",
+			in: handler.Apply{
+				Fn: handler.Lambda{
+					Vars: []string{"x", "y"},
+					Body: handler.Prim{Op: prim.Sub, Args: []handler.Expr{ref("x"), ref("y")}},
+				},
+				Args: []handler.Expr{num(10), num(3)},
+			},
+			out: prim.Int(7),
+		},
+		{
+			name: "naryEffect",
+			in: handler.Handle{
+				Eval: add(signal("pair", num(1), num(2)), num(100)),
+				Handlers: []handler.EffectHandler{
+					{Effect: "pair", Vars: []string{"a", "b"}, Body: resume(add(mul(ref("a"), num(10)), ref("b")))},
+				},
+			},
+			out: prim.Int(112),
+		},
+		{
+			name: "nullaryEffect",
+			in: handler.Handle{
+				Eval: add(signal("get"), num(1)),
+				Handlers: []handler.EffectHandler{
+					{Effect: "get", Body: resume(num(5))},
+				},
+			},
+			out: prim.Int(6),
+		},
+		{
+			name: "shallowReturn",
+			in: handler.Handle{
+				Eval: num(1),
+				Return: &handler.ReturnClause{
+					Var:  "x",
+					Body: add(ref("x"), num(10)),
+				},
+				Shallow: true,
+			},
+			out: prim.Int(11),
+		},
+		{
+			name: "shallowNoReturnAfterResume",
+			in: handler.Handle{
+				Eval: add(signal("get"), num(1)),
+				Handlers: []handler.EffectHandler{
+					{Effect: "get", Body: mul(resume(num(5)), num(2))},
+				},
+				Return: &handler.ReturnClause{
+					Var:  "x",
+					Body: add(ref("x"), num(100)),
+				},
+				Shallow: true,
+			},
+			out: prim.Int(12),
+		},
+		{
+			name: "shallowNotReinstated",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: add(signal("get"), signal("get")),
+					Handlers: []handler.EffectHandler{
+						{Effect: "get", Body: resume(num(1))},
+					},
+					Shallow: true,
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "get", Body: resume(num(10))},
+				},
+			},
+			out: prim.Int(11),
+		},
+		{
+			name: "shallowRehandle",
+			in: handler.LetRec{
+				Bindings: []handler.Binding{
+					{
+						Name: "run",
+						Fn: handler.Lambda{
+							Vars: []string{"th"},
+							Body: handler.Handle{
+								Eval: handler.Apply{Fn: ref("th")},
+								Handlers: []handler.EffectHandler{
+									{Effect: "tick", Vars: []string{"x"}, Body: handler.Apply{
+										Fn: ref("run"),
+										Args: []handler.Expr{handler.Lambda{
+											Body: mul(resume(add(ref("x"), num(1))), num(2)),
+										}},
+									}},
+								},
+								Return: &handler.ReturnClause{
+									Var:  "x",
+									Body: add(ref("x"), num(1000)),
+								},
+								Shallow: true,
+							},
+						},
+					},
+				},
+				Body: handler.Apply{
+					Fn: ref("run"),
+					Args: []handler.Expr{handler.Lambda{
+						Body: add(signal("tick", num(1)), signal("tick", num(10))),
+					}},
+				},
+			},
+			out: prim.Int(1052),
+		},
+		{
+			name: "shallowOtherEffects",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: add(signal("get"), signal("log", num(3))),
+					Handlers: []handler.EffectHandler{
+						{Effect: "get", Body: mul(resume(num(1)), num(2))},
+					},
+					Shallow: true,
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "log", Vars: []string{"x"}, Body: add(resume(num(0)), ref("x"))},
+				},
+			},
+			out: prim.Int(5),
+		},
+		{
+			name: "tailResumeOuterEffect",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: mul(signal("get"), num(2)),
+					Handlers: []handler.EffectHandler{
+						{Effect: "get", Body: resume(add(signal("ask"), num(1)))},
+					},
+					Return: &handler.ReturnClause{Var: "x", Body: add(ref("x"), num(100))},
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "ask", Body: add(resume(num(1)), resume(num(2)))},
+				},
+			},
+			out: prim.Int(210),
+		},
+		{
+			name: "tailResumeOuterAbort",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: mul(signal("get"), num(2)),
+					Handlers: []handler.EffectHandler{
+						{Effect: "get", Body: resume(signal("fail"))},
+					},
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "fail", Body: num(7)},
+				},
+			},
+			out: prim.Int(7),
+		},
+		{
+			name: "knownClausesNested",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: add(signal("get"), signal("ask")),
+					Handlers: []handler.EffectHandler{
+						{Effect: "get", Body: resume(add(num(10), signal("get")))},
+					},
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "get", Body: resume(num(1))},
+					{Effect: "ask", Body: mul(resume(num(100)), num(2))},
+				},
+			},
+			out: prim.Int(222),
+		},
+		{
+			name: "clauseInObjectSignalsOuter",
+			in: handler.Handle{
+				Eval: handler.Handle{
+					Eval: add(signal("get"), handler.Apply{Fn: handler.Lambda{Body: signal("ask")}}),
+					Handlers: []handler.EffectHandler{
+						{Effect: "get", Body: resume(add(num(10), signal("get")))},
+						{Effect: "ask", Body: resume(signal("get"))},
+					},
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "get", Body: resume(num(1))},
+				},
+			},
+			out: prim.Int(12),
+		},
+		{
+			name: "knownClauseAndFunctions",
+			in: handler.Handle{
+				Eval: handler.Apply{
+					Fn: handler.Lambda{
+						Vars: []string{"g"},
+						Body: add(handler.Apply{Fn: ref("g")}, signal("get")),
+					},
+					Args: []handler.Expr{handler.Lambda{Body: mul(signal("get"), num(2))}},
+				},
+				Handlers: []handler.EffectHandler{
+					{Effect: "get", Body: mul(resume(num(3)), num(2))},
+				},
+			},
+			out: prim.Int(36),
+		},
+		{
+			name: "pureFunctions",
+			in: handler.LetRec{
+				Bindings: []handler.Binding{
+					{Name: "double", Fn: handler.Lambda{Vars: []string{"x"}, Body: mul(ref("x"), num(2))}},
+					{Name: "inc", Fn: handler.Lambda{Vars: []string{"x"}, Body: add(ref("x"), num(1))}},
+					{Name: "twice", Fn: handler.Lambda{
+						Vars: []string{"f", "x"},
+						Body: handler.Apply{Fn: ref("f"), Args: []handler.Expr{
+							handler.Apply{Fn: ref("f"), Args: []handler.Expr{ref("x")}},
+						}},
+					}},
+				},
+				Body: handler.Handle{
+					Eval: add(
+						handler.Apply{Fn: ref("twice"), Args: []handler.Expr{ref("double"), signal("get")}},
+						handler.Apply{Fn: ref("inc"), Args: []handler.Expr{
+							handler.Apply{Fn: ref("twice"), Args: []handler.Expr{
+								handler.Lambda{Vars: []string{"y"}, Body: add(ref("y"), signal("get"))},
+								handler.Apply{Fn: ref("inc"), Args: []handler.Expr{num(1)}},
+							}},
+						}},
+					),
+					Handlers: []handler.EffectHandler{
+						{Effect: "get", Body: resume(handler.Apply{Fn: ref("inc"), Args: []handler.Expr{num(9)}})},
+					},
+				},
+			},
+			out: prim.Int(63),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ref, err := handler.Eval(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref != test.out {
+				t.Errorf("reference gave %s, expecting %s", ref, test.out)
+			}
+
+			c, err := ConvertExpr(test.in, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := cont.Eval(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("got %s, expecting %s", out, test.out)
+			}
+
+			c, err = ConvertExprForDebugger(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err = cont.Eval(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("for the debugger: got %s, expecting %s", out, test.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Check looks for effects that may be signalled without a handler to receive them, and for resume
+// expressions outside of an effect handler. Problems are reported with the position of the signal or
+// the resume expression responsible.
+//
+// Functions take on the handlers of whoever calls them, so the analysis follows functions to the
+// places they are called. It is conservative: every function that may reach a call is assumed to
+// be called there.
+//
+// Effects named in host are handled outside of the program, so they may be signalled freely.
+func Check(e Expr, host ...string) []error {
+	a := newAnalysis()
+	_, eff := a.walk(e, flowScope{})
+
+	hosted := map[string]bool{}
+	for _, h := range host {
+		hosted[h] = true
+	}
+	var errs []error
+	for _, s := range eff.signals() {
+		if hosted[s.effect] {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: %w: %s", s.pos, errUnhandled, s.effect))
+	}
+	return append(errs, a.problems...)
+}
+
+// Effects returns the names of the effects that e may signal without handling them.
+func Effects(e Expr) []string {
+	a := newAnalysis()
+	_, eff := a.walk(e, flowScope{})
+
+	seen := map[string]bool{}
+	var res []string
+	for _, s := range eff.signals() {
+		if !seen[s.effect] {
+			seen[s.effect] = true
+			res = append(res, s.effect)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+type analysis struct {
+	sites    int
+	problems []error
+
+	// The functions and calls found, which carry the ids given to their expressions by MarkPure.
+	functions []*function
+	calls     []*call
+
+	// Values passed to effects, resumed with and stored in constructed values are not followed
+	// precisely. Instead they are collected by effect or constructor field.
+	effectArgs    map[string][]*node
+	effectResults map[string]*node
+	fields        map[string][]*node
+}
+
+// node is a set of the functions that an expression may evaluate to, or of the signals that it may
+// pass on. Whatever arrives at a node flows along its edges and into the calls made on it.
+//
+// A node may also hold things that the analysis cannot see, such as functions from outside of the
+// program or the effects of calling them, in which case it is unknown. Whatever arrives at a node
+// that escapes is passed to code outside of the program.
+type node struct {
+	fns     map[*function]bool
+	effects map[*signalSite]bool
+	edges   []edge
+	calls   []*call
+	unknown bool
+	escapes bool
+}
+
+type edge struct {
+	to   *node
+	keep func(s *signalSite) bool
+}
+
+type function struct {
+	id      int
+	params  []*node
+	result  *node
+	effects *node
+	escaped bool
+}
+
+type call struct {
+	id      int
+	fn      *node
+	args    []*node
+	result  *node
+	effects *node
+}
+
+type signalSite struct {
+	id     int
+	effect string
+	pos    Pos
+}
+
+// flowScope tracks the variables in scope and the effect handler, if any, that a resume expression
+// refers to.
+type flowScope struct {
+	vars   *flowVar
+	resume *resumeSite
+}
+
+type flowVar struct {
+	name  string
+	value *node
+	next  *flowVar
+}
+
+// resumeSite describes what happens when the computation suspended by an effect handler is resumed.
+type resumeSite struct {
+	value   *node
+	result  *node
+	effects *node
+}
+
+func newAnalysis() *analysis {
+	return &analysis{
+		effectArgs:    map[string][]*node{},
+		effectResults: map[string]*node{},
+		fields:        map[string][]*node{},
+	}
+}
+
+func newNode() *node {
+	return &node{fns: map[*function]bool{}, effects: map[*signalSite]bool{}}
+}
+
+func (n *node) addFn(f *function) {
+	if n.fns[f] {
+		return
+	}
+	n.fns[f] = true
+	if n.escapes {
+		f.escape()
+	}
+	for _, e := range n.edges {
+		e.to.addFn(f)
+	}
+	for _, c := range n.calls {
+		c.connect(f)
+	}
+}
+
+func (n *node) addEffect(s *signalSite) {
+	if n.effects[s] {
+		return
+	}
+	n.effects[s] = true
+	for _, e := range n.edges {
+		if e.keep == nil || e.keep(s) {
+			e.to.addEffect(s)
+		}
+	}
+}
+
+func (n *node) addUnknown() {
+	if n.unknown {
+		return
+	}
+	n.unknown = true
+	for _, e := range n.edges {
+		e.to.addUnknown()
+	}
+	for _, c := range n.calls {
+		c.connectUnknown()
+	}
+}
+
+func (n *node) escape() {
+	if n.escapes {
+		return
+	}
+	n.escapes = true
+	for f := range n.fns {
+		f.escape()
+	}
+}
+
+// flow makes everything that arrives at n arrive at to as well. If keep is not nil, only the
+// signals that it accepts pass along.
+func (n *node) flow(to *node, keep func(s *signalSite) bool) {
+	n.edges = append(n.edges, edge{to: to, keep: keep})
+	if n.unknown {
+		to.addUnknown()
+	}
+	for f := range n.fns {
+		to.addFn(f)
+	}
+	for s := range n.effects {
+		if keep == nil || keep(s) {
+			to.addEffect(s)
+		}
+	}
+}
+
+func (n *node) addCall(c *call) {
+	n.calls = append(n.calls, c)
+	if n.unknown {
+		c.connectUnknown()
+	}
+	for f := range n.fns {
+		c.connect(f)
+	}
+}
+
+func (n *node) signals() []*signalSite {
+	var res []*signalSite
+	for s := range n.effects {
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].id < res[j].id
+	})
+	return res
+}
+
+func (c *call) connect(f *function) {
+	if len(c.args) != len(f.params) {
+		return
+	}
+	for i, a := range c.args {
+		a.flow(f.params[i], nil)
+	}
+	f.result.flow(c.result, nil)
+	f.effects.flow(c.effects, nil)
+}
+
+// connectUnknown calls a function from outside of the program, which may do anything with its
+// arguments.
+func (c *call) connectUnknown() {
+	for _, a := range c.args {
+		a.escape()
+	}
+	c.result.addUnknown()
+	c.effects.addUnknown()
+}
+
+// escape passes f to code outside of the program, which may call it with anything.
+func (f *function) escape() {
+	if f.escaped {
+		return
+	}
+	f.escaped = true
+	for _, p := range f.params {
+		p.addUnknown()
+	}
+	f.result.escape()
+}
+
+func (s flowScope) lookup(name string) *node {
+	for v := s.vars; v != nil; v = v.next {
+		if v.name == name {
+			return v.value
+		}
+	}
+	return nil
+}
+
+func (s flowScope) bind(name string, value *node) flowScope {
+	s.vars = &flowVar{name: name, value: value, next: s.vars}
+	return s
+}
+
+func (s flowScope) enterHandler(r *resumeSite) flowScope {
+	s.resume = r
+	return s
+}
+
+// Effects may be handled outside of the program, so their arguments escape and their results are
+// unknown.
+
+func (a *analysis) effectArg(effect string, i int) *node {
+	for len(a.effectArgs[effect]) <= i {
+		n := newNode()
+		n.escape()
+		a.effectArgs[effect] = append(a.effectArgs[effect], n)
+	}
+	return a.effectArgs[effect][i]
+}
+
+func (a *analysis) effectResult(effect string) *node {
+	if a.effectResults[effect] == nil {
+		a.effectResults[effect] = newNode()
+		a.effectResults[effect].addUnknown()
+	}
+	return a.effectResults[effect]
+}
+
+func (a *analysis) field(constructor string, i int) *node {
+	for len(a.fields[constructor]) <= i {
+		a.fields[constructor] = append(a.fields[constructor], newNode())
+	}
+	return a.fields[constructor][i]
+}
+
+// walk returns nodes for the value of e and the effects that it may signal.
+func (a *analysis) walk(e Expr, s flowScope) (*node, *node) {
+	val, eff := newNode(), newNode()
+
+	switch e := e.(type) {
+	case Var:
+		if v := s.lookup(e.Name); v != nil {
+			v.flow(val, nil)
+		} else {
+			val.addUnknown()
+		}
+
+	case Lambda:
+		val.addFn(a.function(e, s))
+
+	case Apply:
+		fn, fnEff := a.walk(e.Fn, s)
+		fnEff.flow(eff, nil)
+		c := &call{id: e.id, fn: fn, args: a.walkAll(e.Args, s, eff), result: val, effects: eff}
+		a.calls = append(a.calls, c)
+		fn.addCall(c)
+
+	case Handle:
+		// Installing handlers and resuming need the rest of the computation, which the analysis
+		// treats as unknown.
+		eff.addUnknown()
+		a.handle(e, s, val, eff)
+
+	case Signal:
+		a.sites++
+		eff.addEffect(&signalSite{id: a.sites, effect: e.Effect, pos: e.Pos})
+		for i, v := range a.walkAll(e.Args, s, eff) {
+			v.flow(a.effectArg(e.Effect, i), nil)
+		}
+		a.effectResult(e.Effect).flow(val, nil)
+
+	case Resume:
+		eff.addUnknown()
+		r := s.resume
+		if r == nil {
+			a.problems = append(a.problems, fmt.Errorf("%s: %w", e.Pos, errNotInHandler))
+		}
+		with, withEff := a.walk(e.With, s)
+		withEff.flow(eff, nil)
+		if r != nil {
+			with.flow(r.value, nil)
+			r.result.flow(val, nil)
+			r.effects.flow(eff, nil)
+		}
+
+	case Int, Bool:
+
+	case Prim:
+		a.walkAll(e.Args, s, eff)
+
+	case If:
+		for _, x := range []Expr{e.Cond, e.Then, e.Else} {
+			xVal, xEff := a.walk(x, s)
+			xVal.flow(val, nil)
+			xEff.flow(eff, nil)
+		}
+
+	case Data:
+		return a.walk(e.Body, s)
+
+	case Construct:
+		for i, v := range a.walkAll(e.Args, s, eff) {
+			v.flow(a.field(e.Constructor, i), nil)
+		}
+
+	case Match:
+		_, onEff := a.walk(e.On, s)
+		onEff.flow(eff, nil)
+		for _, c := range e.Cases {
+			cs := s
+			for i, x := range c.Vars {
+				cs = cs.bind(x, a.field(c.Constructor, i))
+			}
+			cVal, cEff := a.walk(c.Body, cs)
+			cVal.flow(val, nil)
+			cEff.flow(eff, nil)
+		}
+
+	case LetRec:
+		fns := make([]*node, len(e.Bindings))
+		for i, b := range e.Bindings {
+			fns[i] = newNode()
+			s = s.bind(b.Name, fns[i])
+		}
+		for i, b := range e.Bindings {
+			fns[i].addFn(a.function(b.Fn, s))
+		}
+		return a.walk(e.Body, s)
+	}
+
+	return val, eff
+}
+
+// walkAll walks es, passing their effects on to eff and returning their values.
+func (a *analysis) walkAll(es []Expr, s flowScope, eff *node) []*node {
+	vals := make([]*node, len(es))
+	for i, x := range es {
+		v, xEff := a.walk(x, s)
+		xEff.flow(eff, nil)
+		vals[i] = v
+	}
+	return vals
+}
+
+func (a *analysis) function(e Lambda, s flowScope) *function {
+	f := &function{id: e.id, result: newNode(), effects: newNode()}
+	a.functions = append(a.functions, f)
+	for _, x := range e.Vars {
+		p := newNode()
+		f.params = append(f.params, p)
+		s = s.bind(x, p)
+	}
+	body, bodyEff := a.walk(e.Body, s)
+	body.flow(f.result, nil)
+	bodyEff.flow(f.effects, nil)
+	return f
+}
+
+// handle removes the effects handled by e from those of the computation it handles. Resuming a
+// deep handler passes on the rest of them, while resuming a shallow handler passes on all of them, as
+// the handler is not reinstated.
+func (a *analysis) handle(e Handle, s flowScope, val, eff *node) {
+	handled := map[string]bool{}
+	for _, h := range e.Handlers {
+		handled[h.Effect] = true
+	}
+	unhandled := func(x *signalSite) bool {
+		return !handled[x.effect]
+	}
+
+	evalVal, evalEff := a.walk(e.Eval, s)
+	evalEff.flow(eff, unhandled)
+
+	if e.Return != nil {
+		retVal, retEff := a.walk(e.Return.Body, s.bind(e.Return.Var, evalVal))
+		retVal.flow(val, nil)
+		retEff.flow(eff, nil)
+	} else {
+		evalVal.flow(val, nil)
+	}
+
+	for _, h := range e.Handlers {
+		r := &resumeSite{value: a.effectResult(h.Effect), result: newNode(), effects: newNode()}
+		if e.Shallow {
+			evalVal.flow(r.result, nil)
+			evalEff.flow(r.effects, nil)
+		} else {
+			val.flow(r.result, nil)
+			evalEff.flow(r.effects, unhandled)
+		}
+
+		hs := s.enterHandler(r)
+		for i, x := range h.Vars {
+			hs = hs.bind(x, a.effectArg(h.Effect, i))
+		}
+		hVal, hEff := a.walk(h.Body, hs)
+		hVal.flow(val, nil)
+		hEff.flow(eff, nil)
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestEffects(t *testing.T) {
+	get := Signal{Effect: "get", Pos: Pos{Line: 1, Col: 1}}
+	handleGet := func(e Expr) Expr {
+		return Handle{
+			Eval:     e,
+			Handlers: []EffectHandler{{Effect: "get", Body: Resume{With: Int{Value: 1}}}},
+		}
+	}
+	thunk := func(e Expr) Expr {
+		return Lambda{Body: e}
+	}
+	call := func(f Expr) Expr {
+		return Apply{Fn: f}
+	}
+
+	for _, test := range []struct {
+		name string
+		in   Expr
+		out  []string
+	}{
+		{
+			name: "pure",
+			in:   Int{Value: 1},
+		},
+		{
+			name: "signal",
+			in:   get,
+			out:  []string{"get"},
+		},
+		{
+			name: "handled",
+			in:   handleGet(get),
+		},
+		{
+			name: "otherEffect",
+			in:   handleGet(Signal{Effect: "put", Args: []Expr{get}}),
+			out:  []string{"put"},
+		},
+		{
+			name: "lambdaNotCalled",
+			in:   thunk(get),
+		},
+		{
+			name: "lambdaCalled",
+			in:   call(thunk(get)),
+			out:  []string{"get"},
+		},
+		{
+			name: "calledUnderHandler",
+			in: Apply{
+				Fn:   Lambda{Vars: []string{"f"}, Body: handleGet(call(Var{Name: "f"}))},
+				Args: []Expr{thunk(get)},
+			},
+		},
+		{
+			name: "escapesHandler",
+			in:   call(handleGet(thunk(get))),
+			out:  []string{"get"},
+		},
+		{
+			name: "recursive",
+			in: LetRec{
+				Bindings: []Binding{
+					{Name: "f", Fn: Lambda{Body: If{Cond: get, Then: call(Var{Name: "f"}), Else: Int{Value: 0}}}},
+				},
+				Body: call(Var{Name: "f"}),
+			},
+			out: []string{"get"},
+		},
+		{
+			name: "clauseEffects",
+			in: Handle{
+				Eval:     get,
+				Handlers: []EffectHandler{{Effect: "get", Body: Signal{Effect: "fail"}}},
+			},
+			out: []string{"fail"},
+		},
+		{
+			name: "shallowResume",
+			in: Handle{
+				Eval:     Prim{Args: []Expr{get, get}},
+				Handlers: []EffectHandler{{Effect: "get", Body: Resume{With: Int{Value: 1}}}},
+				Shallow:  true,
+			},
+			out: []string{"get"},
+		},
+		{
+			name: "deepResume",
+			in: Handle{
+				Eval:     Prim{Args: []Expr{get, get}},
+				Handlers: []EffectHandler{{Effect: "get", Body: Resume{With: Int{Value: 1}}}},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out := Effects(test.in)
+			if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("got %v, expecting %v", out, test.out)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	errs := Check(Apply{
+		Fn: Lambda{
+			Vars: []string{"x"},
+			Body: Resume{With: Var{Name: "x"}, Pos: Pos{Line: 2, Col: 3}},
+		},
+		Args: []Expr{Signal{Effect: "get", Pos: Pos{Line: 1, Col: 5}}},
+	})
+	if len(errs) != 2 {
+		t.Fatalf("got %v, expecting two errors", errs)
+	}
+	if !errors.Is(errs[0], errUnhandled) || errs[0].Error() != "1:5: unhandled effect: get" {
+		t.Errorf("got %v, expecting unhandled get", errs[0])
+	}
+	if !errors.Is(errs[1], errNotInHandler) || errs[1].Error() != "2:3: not in a handler" {
+		t.Errorf("got %v, expecting resume outside of a handler", errs[1])
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	e := Prim{Op: prim.Add, Args: []Expr{
+		Signal{Effect: "get", Pos: Pos{Line: 1, Col: 1}},
+		Signal{Effect: "put", Pos: Pos{Line: 1, Col: 14}},
+	}}
+	errs := Check(e, "get")
+	if len(errs) != 1 || errs[0].Error() != "1:14: unhandled effect: put" {
+		t.Errorf("got %v, expecting unhandled put", errs)
+	}
+}
@@ -0,0 +1,434 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errUnbound = errors.New("unbound variable")
+var errNotFunction = errors.New("not a function")
+var errUnhandled = errors.New("unhandled effect")
+var errNotInHandler = errors.New("not in a handler")
+var errNoMatch = errors.New("no matching case")
+var errWrongArgCount = errors.New("wrong number of arguments")
+var errUnsupported = errors.New("unsupported syntax")
+
+// Eval evaluates e according to the reference semantics of the language.
+//
+// Functions are called with the handlers in effect at the point of the call, while the body of an
+// effect handler runs with the handlers in effect where it was installed. A suspended computation
+// keeps the handlers it was using when it is resumed, except that the effects handled by a shallow
+// handler are handled by the handlers in effect where the computation was resumed.
+func Eval(e Expr) (prim.Value, error) {
+	m := &machine{expr: e}
+	return m.run()
+}
+
+// machine is an abstract machine with an explicit stack, so that computations can be suspended and
+// resumed by copying frames.
+type machine struct {
+	stack []frame
+	h     *installed
+	expr  Expr
+	env   env
+	value prim.Value
+	err   error
+}
+
+// frame receives the value of a computation. The slices within a frame are never modified, as a
+// frame may be resumed more than once.
+type frame struct {
+	h        *installed
+	prompt   *installed
+	redirect *redirection
+	ret      func(m *machine, v prim.Value)
+}
+
+// redirection marks where a computation suspended by a shallow handler was resumed. Effects that
+// would have gone to the handler go to the handlers at the site of the resumption instead.
+type redirection struct {
+	site *installed
+}
+
+// installed is a handler installed by a handle expression. It marks the stack with a prompt, up to
+// which computations are captured when one of its effects is signalled.
+type installed struct {
+	handle Handle
+	env    env
+	parent *installed
+}
+
+type env struct {
+	vars         *binding
+	constructors map[string]conDecl
+	resume       *resumption
+}
+
+type binding struct {
+	name  string
+	value prim.Value
+	next  *binding
+}
+
+type conDecl struct {
+	data  string
+	tag   int
+	arity int
+}
+
+type resumption struct {
+	h       *installed
+	stack   []frame
+	shallow bool
+}
+
+type closure struct {
+	fn  Lambda
+	env env
+}
+
+func (c *closure) String() string {
+	return "<function>"
+}
+
+func (m *machine) run() (prim.Value, error) {
+	for m.err == nil {
+		if m.expr != nil {
+			e := m.expr
+			m.expr = nil
+			m.eval(e)
+			continue
+		}
+		if len(m.stack) == 0 {
+			return m.value, nil
+		}
+		f := m.stack[len(m.stack)-1]
+		m.stack = m.stack[:len(m.stack)-1]
+		m.h = f.h
+		f.ret(m, m.value)
+	}
+	return nil, m.err
+}
+
+func (m *machine) fail(err error) {
+	m.err = err
+}
+
+func (m *machine) push(ret func(m *machine, v prim.Value)) {
+	m.stack = append(m.stack, frame{h: m.h, ret: ret})
+}
+
+func (m *machine) evalIn(e Expr, env env) {
+	m.expr = e
+	m.env = env
+}
+
+func (m *machine) returnValue(v prim.Value) {
+	m.value = v
+}
+
+// evalAll evaluates es from left to right before passing their values on.
+func (m *machine) evalAll(es []Expr, then func(m *machine, vs []prim.Value)) {
+	m.evalRest(es, nil, m.env, then)
+}
+
+func (m *machine) evalRest(es []Expr, done []prim.Value, env env, then func(m *machine, vs []prim.Value)) {
+	if len(es) == 0 {
+		then(m, done)
+		return
+	}
+	m.push(func(m *machine, v prim.Value) {
+		next := make([]prim.Value, len(done), len(done)+1)
+		copy(next, done)
+		m.evalRest(es[1:], append(next, v), env, then)
+	})
+	m.evalIn(es[0], env)
+}
+
+func (m *machine) eval(e Expr) {
+	switch e := e.(type) {
+	case Var:
+		v, ok := m.env.lookup(e.Name)
+		if !ok {
+			m.fail(fmt.Errorf("%w: %s", errUnbound, e.Name))
+			return
+		}
+		m.returnValue(v)
+
+	case Lambda:
+		m.returnValue(&closure{fn: e, env: m.env})
+
+	case Apply:
+		m.evalAll(append([]Expr{e.Fn}, e.Args...), func(m *machine, vs []prim.Value) {
+			m.call(vs[0], vs[1:])
+		})
+
+	case Handle:
+		m.handle(e)
+
+	case Signal:
+		m.evalAll(e.Args, func(m *machine, vs []prim.Value) {
+			m.signal(e.Effect, vs)
+		})
+
+	case Resume:
+		r := m.env.resume
+		if r == nil {
+			m.fail(fmt.Errorf("%s: %w", e.Pos, errNotInHandler))
+			return
+		}
+		m.evalAll([]Expr{e.With}, func(m *machine, vs []prim.Value) {
+			m.resume(r, vs[0])
+		})
+
+	case Int:
+		m.returnValue(prim.Int(e.Value))
+
+	case Prim:
+		m.evalAll(e.Args, func(m *machine, vs []prim.Value) {
+			v, err := e.Op.Apply(vs)
+			if err != nil {
+				m.fail(err)
+				return
+			}
+			m.returnValue(v)
+		})
+
+	case Bool:
+		m.returnValue(prim.Bool(e.Value))
+
+	case If:
+		env := m.env
+		m.push(func(m *machine, v prim.Value) {
+			if v, ok := v.(prim.Con); ok && v.Tag == prim.True {
+				m.evalIn(e.Then, env)
+				return
+			}
+			if v, ok := v.(prim.Con); ok && v.Tag == prim.False {
+				m.evalIn(e.Else, env)
+				return
+			}
+			m.fail(fmt.Errorf("%w: expecting a boolean, got %s", prim.ErrType, v))
+		})
+		m.evalIn(e.Cond, env)
+
+	case Data:
+		m.evalIn(e.Body, m.env.declare(e))
+
+	case Construct:
+		c, ok := m.env.constructors[e.Constructor]
+		if !ok || c.arity != len(e.Args) {
+			m.fail(fmt.Errorf("%w: bad constructor %s", prim.ErrType, e.Constructor))
+			return
+		}
+		m.evalAll(e.Args, func(m *machine, vs []prim.Value) {
+			m.returnValue(prim.Con{Tag: c.tag, Name: e.Constructor, Fields: vs})
+		})
+
+	case Match:
+		env := m.env
+		m.push(func(m *machine, v prim.Value) {
+			m.match(e, env, v)
+		})
+		m.evalIn(e.On, env)
+
+	case LetRec:
+		m.evalIn(e.Body, m.env.bindRec(e.Bindings))
+
+	default:
+		m.fail(fmt.Errorf("%w: %#v", errUnsupported, e))
+	}
+}
+
+func (m *machine) call(f prim.Value, args []prim.Value) {
+	fn, ok := f.(*closure)
+	if !ok {
+		m.fail(fmt.Errorf("%w: %s", errNotFunction, f))
+		return
+	}
+	env, err := fn.env.bindAll(fn.fn.Vars, args)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+	m.evalIn(fn.fn.Body, env)
+}
+
+func (m *machine) match(e Match, env env, v prim.Value) {
+	con, ok := v.(prim.Con)
+	if !ok {
+		m.fail(fmt.Errorf("%w: cannot match on %s", prim.ErrType, v))
+		return
+	}
+	for _, c := range e.Cases {
+		d, ok := env.constructors[c.Constructor]
+		if !ok || d.tag != con.Tag || len(c.Vars) != len(con.Fields) {
+			continue
+		}
+		for i, x := range c.Vars {
+			env = env.bind(x, con.Fields[i])
+		}
+		m.evalIn(c.Body, env)
+		return
+	}
+	m.fail(fmt.Errorf("%w: %s", errNoMatch, v))
+}
+
+// handle installs a handler and marks the stack with its prompt. The return clause of a deep handler
+// goes within the prompt, so that it becomes part of any computation that is captured. That of a
+// shallow handler goes with the prompt, so that it is discarded along with it.
+func (m *machine) handle(e Handle) {
+	h := &installed{handle: e, env: m.env, parent: m.h}
+	if e.Shallow {
+		env := m.env
+		m.stack = append(m.stack, frame{h: m.h, prompt: h, ret: func(m *machine, v prim.Value) {
+			if e.Return == nil {
+				m.returnValue(v)
+				return
+			}
+			m.evalIn(e.Return.Body, env.bind(e.Return.Var, v))
+		}})
+		m.h = h
+		m.evalIn(e.Eval, m.env)
+		return
+	}
+	m.stack = append(m.stack, frame{h: m.h, prompt: h, ret: (*machine).returnValue})
+	if e.Return != nil {
+		env := m.env
+		m.push(func(m *machine, v prim.Value) {
+			m.evalIn(e.Return.Body, env.bind(e.Return.Var, v))
+		})
+	}
+	m.h = h
+	m.evalIn(e.Eval, m.env)
+}
+
+// signal captures the computation up to the prompt of the handler for the effect, and then runs the
+// handler outside of that prompt.
+func (m *machine) signal(effect string, args []prim.Value) {
+	h, clause, p, err := m.dispatch(effect)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+
+	env, err := h.env.bindAll(clause.Vars, args)
+	if err != nil {
+		m.fail(fmt.Errorf("handling %s: %w", effect, err))
+		return
+	}
+
+	k := make([]frame, len(m.stack)-p-1)
+	copy(k, m.stack[p+1:])
+	m.stack = m.stack[:p]
+	m.h = h.parent
+
+	env.resume = &resumption{h: h, stack: k, shallow: h.handle.Shallow}
+	m.evalIn(clause.Body, env)
+}
+
+// dispatch finds the handler for an effect and the position of its prompt, following any
+// redirections left by shallow handlers.
+func (m *machine) dispatch(effect string) (*installed, EffectHandler, int, error) {
+	chain, top := m.h, len(m.stack)
+	for {
+		h, clause := chain.lookup(effect)
+		if h == nil {
+			return nil, EffectHandler{}, -1, fmt.Errorf("%w: %s", errUnhandled, effect)
+		}
+		p := m.findPrompt(h, top)
+		if p == -1 {
+			return nil, EffectHandler{}, -1, fmt.Errorf("%w: %s is not active", errUnhandled, effect)
+		}
+		r := m.stack[p].redirect
+		if r == nil {
+			return h, clause, p, nil
+		}
+		chain, top = r.site, p
+	}
+}
+
+func (m *machine) resume(r *resumption, v prim.Value) {
+	if r.shallow {
+		m.stack = append(m.stack, frame{h: m.h, prompt: r.h, redirect: &redirection{site: m.h}, ret: (*machine).returnValue})
+	} else {
+		m.stack = append(m.stack, frame{h: m.h, prompt: r.h, ret: (*machine).returnValue})
+	}
+	m.stack = append(m.stack, r.stack...)
+	m.returnValue(v)
+}
+
+func (m *machine) findPrompt(h *installed, top int) int {
+	for i := top - 1; i >= 0; i-- {
+		if m.stack[i].prompt == h {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *installed) lookup(effect string) (*installed, EffectHandler) {
+	for ; h != nil; h = h.parent {
+		for _, c := range h.handle.Handlers {
+			if c.Effect == effect {
+				return h, c
+			}
+		}
+	}
+	return nil, EffectHandler{}
+}
+
+func (e env) lookup(name string) (prim.Value, bool) {
+	for b := e.vars; b != nil; b = b.next {
+		if b.name == name {
+			return b.value, true
+		}
+	}
+	return nil, false
+}
+
+func (e env) bind(name string, v prim.Value) env {
+	e.vars = &binding{name: name, value: v, next: e.vars}
+	return e
+}
+
+func (e env) bindAll(names []string, vs []prim.Value) (env, error) {
+	if len(names) != len(vs) {
+		return e, fmt.Errorf("%w: expecting %d, got %d", errWrongArgCount, len(names), len(vs))
+	}
+	for i, name := range names {
+		e = e.bind(name, vs[i])
+	}
+	return e, nil
+}
+
+// bindRec binds a group of recursive functions, each of which closes over the resulting environment.
+func (e env) bindRec(bs []Binding) env {
+	bound := make([]*binding, len(bs))
+	for i, b := range bs {
+		e.vars = &binding{name: b.Name, next: e.vars}
+		bound[i] = e.vars
+	}
+	for i, b := range bs {
+		bound[i].value = &closure{fn: b.Fn, env: e}
+	}
+	return e
+}
+
+func (e env) declare(d Data) env {
+	constructors := map[string]conDecl{}
+	for name, c := range e.constructors {
+		constructors[name] = c
+	}
+	for i, c := range d.Constructors {
+		constructors[c.Name] = conDecl{
+			data:  d.Name,
+			tag:   i,
+			arity: len(c.Fields),
+		}
+	}
+	e.constructors = constructors
+	return e
+}
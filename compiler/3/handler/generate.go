@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"math/rand"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+// Generate produces a random program of roughly the size given, for testing the stages of the
+// compiler against one another. The programs are well scoped and well typed, they handle every effect
+// that they signal and they terminate, producing an integer.
+//
+// Variables are drawn from a small set of names, so that bindings often shadow one another.
+// Recursive functions only call themselves with smaller arguments, and are only called with small
+// ones.
+func Generate(r *rand.Rand, size int) Expr {
+	g := &generator{r: r}
+	return Data{
+		Name: "opt",
+		Constructors: []Constructor{
+			{Name: "none"},
+			{Name: "some", Fields: []Type{TypeName{Name: "int"}}},
+		},
+		Body: g.int(genScope{}, size),
+	}
+}
+
+var (
+	genInts    = []string{"x", "y", "z"}
+	genFns     = []string{"f", "g"}
+	genRecs    = []string{"loop", "count"}
+	genEffects = []string{"ask", "tell", "fail"}
+)
+
+type generator struct {
+	r *rand.Rand
+}
+
+// genScope is what a generated expression may refer to. Functions take and return integers, as do
+// effects.
+type genScope struct {
+	ints    []string
+	fns     []string
+	recs    []string
+	effects []string
+	resume  bool
+}
+
+func (s genScope) bindInt(name string) genScope {
+	s.ints = genAdd(s.ints, name)
+	s.fns = genRemove(s.fns, name)
+	return s
+}
+
+func (s genScope) bindFn(name string) genScope {
+	s.fns = genAdd(s.fns, name)
+	s.ints = genRemove(s.ints, name)
+	return s
+}
+
+func (s genScope) bindRec(name string) genScope {
+	s.recs = genAdd(s.recs, name)
+	return s
+}
+
+func genAdd(names []string, name string) []string {
+	return append(genRemove(names, name), name)
+}
+
+// genRemove returns names without name. It does not modify names, which may be shared.
+func genRemove(names []string, name string) []string {
+	res := make([]string, 0, len(names))
+	for _, n := range names {
+		if n != name {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func (g *generator) pick(names []string) string {
+	return names[g.r.Intn(len(names))]
+}
+
+// split divides what is left of size after a node between n children.
+func (g *generator) split(size, n int) []int {
+	sizes := make([]int, n)
+	for i := 1; i < size; i++ {
+		sizes[g.r.Intn(n)]++
+	}
+	return sizes
+}
+
+func (g *generator) int(s genScope, size int) Expr {
+	if size <= 1 {
+		if len(s.ints) != 0 && g.r.Intn(2) == 0 {
+			return Var{Name: g.pick(s.ints)}
+		}
+		return Int{Value: g.r.Intn(10)}
+	}
+
+	for {
+		switch g.r.Intn(11) {
+		case 0, 1:
+			ops := []prim.Op{prim.Add, prim.Sub, prim.Mul}
+			sz := g.split(size, 2)
+			return Prim{Op: ops[g.r.Intn(len(ops))], Args: []Expr{g.int(s, sz[0]), g.int(s, sz[1])}}
+
+		case 2:
+			sz := g.split(size, 3)
+			return If{Cond: g.bool(s, sz[0]), Then: g.int(s, sz[1]), Else: g.int(s, sz[2])}
+
+		case 3:
+			if len(s.fns) == 0 {
+				continue
+			}
+			return Apply{Fn: Var{Name: g.pick(s.fns)}, Args: []Expr{g.int(s, size-1)}}
+
+		case 4:
+			if len(s.recs) == 0 {
+				continue
+			}
+			return Apply{Fn: Var{Name: g.pick(s.recs)}, Args: []Expr{Int{Value: g.r.Intn(4)}}}
+
+		case 5:
+			x := g.pick(genInts)
+			sz := g.split(size, 2)
+			return Apply{
+				Fn:   Lambda{Vars: []string{x}, Body: g.int(s.bindInt(x), sz[0])},
+				Args: []Expr{g.int(s, sz[1])},
+			}
+
+		case 6:
+			f, x := g.pick(genFns), g.pick(genInts)
+			sz := g.split(size, 2)
+			return Apply{
+				Fn:   Lambda{Vars: []string{f}, Body: g.int(s.bindFn(f), sz[0])},
+				Args: []Expr{Lambda{Vars: []string{x}, Body: g.int(s.bindInt(x), sz[1])}},
+			}
+
+		case 7:
+			if len(s.effects) == 0 {
+				continue
+			}
+			return Signal{Effect: g.pick(s.effects), Args: []Expr{g.int(s, size-1)}}
+
+		case 8:
+			if !s.resume {
+				continue
+			}
+			return Resume{With: g.int(s, size-1)}
+
+		case 9:
+			return g.handle(s, size)
+
+		case 10:
+			if g.r.Intn(2) == 0 {
+				return g.match(s, size)
+			}
+			return g.letRec(s, size)
+		}
+	}
+}
+
+func (g *generator) bool(s genScope, size int) Expr {
+	if size <= 1 {
+		return Bool{Value: g.r.Intn(2) == 0}
+	}
+	ops := []prim.Op{prim.Eq, prim.Lt}
+	sz := g.split(size, 2)
+	return Prim{Op: ops[g.r.Intn(len(ops))], Args: []Expr{g.int(s, sz[0]), g.int(s, sz[1])}}
+}
+
+// handle handles one or two effects. Handlers are only shallow when the effect is also handled
+// further out, as that is where the effect goes once the computation is resumed.
+func (g *generator) handle(s genScope, size int) Expr {
+	n := 1 + g.r.Intn(2)
+	sz := g.split(size, n+2)
+
+	var effects []string
+	for _, i := range g.r.Perm(len(genEffects))[:n] {
+		effects = append(effects, genEffects[i])
+	}
+	shallow := false
+	if n == 1 && g.r.Intn(3) == 0 {
+		for _, e := range s.effects {
+			shallow = shallow || e == effects[0]
+		}
+	}
+
+	eval := s
+	for _, e := range effects {
+		eval.effects = genAdd(eval.effects, e)
+	}
+	clause := s
+	clause.resume = true
+
+	res := Handle{Eval: g.int(eval, sz[0]), Shallow: shallow}
+	for i, e := range effects {
+		x := g.pick(genInts)
+		res.Handlers = append(res.Handlers, EffectHandler{
+			Effect: e,
+			Vars:   []string{x},
+			Body:   g.int(clause.bindInt(x), sz[i+1]),
+		})
+	}
+	if g.r.Intn(2) == 0 {
+		x := g.pick(genInts)
+		res.Return = &ReturnClause{Var: x, Body: g.int(s.bindInt(x), sz[n+1])}
+	}
+	return res
+}
+
+func (g *generator) match(s genScope, size int) Expr {
+	sz := g.split(size, 3)
+	on := Construct{Constructor: "none"}
+	if g.r.Intn(3) != 0 {
+		on = Construct{Constructor: "some", Args: []Expr{g.int(s, sz[0])}}
+	}
+	x := g.pick(genInts)
+	return Match{On: on, Cases: []Case{
+		{Constructor: "none", Body: g.int(s, sz[1])},
+		{Constructor: "some", Vars: []string{x}, Body: g.int(s.bindInt(x), sz[2])},
+	}}
+}
+
+// letRec defines a function that counts its argument down to zero.
+func (g *generator) letRec(s genScope, size int) Expr {
+	f, n := g.pick(genRecs), g.pick(genInts)
+	sz := g.split(size, 3)
+	inner := s.bindInt(n)
+	inner.recs = genRemove(inner.recs, f)
+	inner.resume = false
+	body := If{
+		Cond: Prim{Op: prim.Lt, Args: []Expr{Var{Name: n}, Int{Value: 1}}},
+		Then: g.int(inner, sz[0]),
+		Else: Prim{Op: prim.Add, Args: []Expr{
+			g.int(inner, sz[1]),
+			Apply{Fn: Var{Name: f}, Args: []Expr{Prim{Op: prim.Sub, Args: []Expr{Var{Name: n}, Int{Value: 1}}}}},
+		}},
+	}
+	return LetRec{
+		Bindings: []Binding{{Name: f, Fn: Lambda{Vars: []string{n}, Body: body}}},
+		Body:     g.int(s.bindRec(f), sz[2]),
+	}
+}
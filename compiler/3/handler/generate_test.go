@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestGenerate checks that generated programs are accepted by the checks and run to completion.
+func TestGenerate(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		e := Generate(rand.New(rand.NewSource(seed)), 30)
+		if errs := Check(e); len(errs) != 0 {
+			t.Fatalf("seed %d: %v\n%s", seed, errs, e)
+		}
+		if _, err := Infer(e); err != nil {
+			t.Fatalf("seed %d: %v\n%s", seed, err, e)
+		}
+		if _, err := Eval(e); err != nil {
+			t.Fatalf("seed %d: %v\n%s", seed, err, e)
+		}
+	}
+}
@@ -0,0 +1,874 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errTypeMismatch = errors.New("type mismatch")
+var errUnknownConstructor = errors.New("unknown constructor")
+var errUnknownType = errors.New("unknown type")
+
+// Inference holds the principal types of the top-level bindings of a program, along with the type
+// of the program itself and the effects that it may signal.
+type Inference struct {
+	Bindings []Typing
+	Type     string
+	Effects  string
+}
+
+type Typing struct {
+	Name string
+	Type string
+}
+
+func (i Inference) String() string {
+	var b strings.Builder
+	for _, t := range i.Bindings {
+		fmt.Fprintf(&b, "%s : %s\n", t.Name, t.Type)
+	}
+	fmt.Fprintf(&b, "%s ! %s", i.Type, i.Effects)
+	return b.String()
+}
+
+// Infer infers the types of e using Hindley-Milner inference extended with rows of effects.
+//
+// Every expression is inferred under a row of the effects that may be signalled while evaluating
+// it, and a function type carries the row of effects signalled when it is called. Handling an effect
+// removes it from the row of the handled expression. Rows may be extended by unification, so an
+// effect signalled twice is the same as one signalled once.
+//
+// Each effect has one signature across the whole program, fixed by its uses. The top-level bindings
+// are the recursive bindings that enclose the rest of the program.
+func Infer(e Expr) (Inference, error) {
+	in := &inferrer{effects: map[string]*effectSig{}}
+	eff := in.newVar()
+
+	var res Inference
+	s := inferScope{}
+	for {
+		switch top := e.(type) {
+		case Data:
+			s = s.declare(top)
+			e = top.Body
+			continue
+
+		case LetRec:
+			var err error
+			s, err = in.letRec(top, s)
+			if err != nil {
+				return Inference{}, err
+			}
+			for _, b := range top.Bindings {
+				res.Bindings = append(res.Bindings, Typing{
+					Name: b.Name,
+					Type: newTypePrinter().print(s.lookup(b.Name)),
+				})
+			}
+			e = top.Body
+			continue
+		}
+		break
+	}
+
+	t, err := in.infer(e, s, eff)
+	if err != nil {
+		return Inference{}, err
+	}
+	res.Type = newTypePrinter().print(t)
+
+	labels, _ := flattenRow(eff)
+	res.Effects = "{" + strings.Join(labels, ", ") + "}"
+
+	return res, nil
+}
+
+// ty is an inferred type. Rows are types too, so that they can be held by type variables.
+type ty interface{}
+
+type tyVar struct {
+	level int
+	ref   ty
+}
+
+type tyCon struct {
+	name string
+	args []ty
+}
+
+type tyFn struct {
+	params  []ty
+	effects ty
+	result  ty
+}
+
+// tyRow is a set of effects, which is extended by tail unless tail is nil.
+type tyRow struct {
+	labels []string
+	tail   ty
+}
+
+// genericLevel marks variables that have been generalised, and are copied when a binding is used.
+const genericLevel = 1 << 30
+
+var (
+	intType  = tyCon{name: "int"}
+	boolType = tyCon{name: "bool"}
+)
+
+type effectSig struct {
+	params []ty
+	result ty
+}
+
+type inferrer struct {
+	level   int
+	effects map[string]*effectSig
+}
+
+type inferScope struct {
+	vars         *inferVar
+	constructors map[string]inferCon
+	resume       *resumeType
+}
+
+type inferVar struct {
+	name string
+	t    ty
+	next *inferVar
+}
+
+type inferCon struct {
+	data   Data
+	fields []Type
+}
+
+// resumeType describes the resume expressions within an effect handler.
+type resumeType struct {
+	arg     ty
+	effects ty
+	result  ty
+}
+
+func (s inferScope) lookup(name string) ty {
+	for v := s.vars; v != nil; v = v.next {
+		if v.name == name {
+			return v.t
+		}
+	}
+	return nil
+}
+
+func (s inferScope) bind(name string, t ty) inferScope {
+	s.vars = &inferVar{name: name, t: t, next: s.vars}
+	return s
+}
+
+func (s inferScope) declare(d Data) inferScope {
+	constructors := map[string]inferCon{}
+	for name, c := range s.constructors {
+		constructors[name] = c
+	}
+	for _, c := range d.Constructors {
+		constructors[c.Name] = inferCon{data: d, fields: c.Fields}
+	}
+	s.constructors = constructors
+	return s
+}
+
+func (in *inferrer) newVar() *tyVar {
+	return &tyVar{level: in.level}
+}
+
+func (in *inferrer) effect(name string, arity int) (*effectSig, error) {
+	sig := in.effects[name]
+	if sig == nil {
+		sig = &effectSig{result: &tyVar{}}
+		for i := 0; i < arity; i++ {
+			sig.params = append(sig.params, &tyVar{})
+		}
+		in.effects[name] = sig
+	}
+	if len(sig.params) != arity {
+		return nil, fmt.Errorf("%w: %s takes %d arguments, got %d", errWrongArgCount, name, len(sig.params), arity)
+	}
+	return sig, nil
+}
+
+func (in *inferrer) infer(e Expr, s inferScope, eff ty) (ty, error) {
+	switch e := e.(type) {
+	case Var:
+		t := s.lookup(e.Name)
+		if t == nil {
+			return nil, fmt.Errorf("%w: %s", errUnbound, e.Name)
+		}
+		return in.instantiate(t, map[*tyVar]ty{}), nil
+
+	case Lambda:
+		return in.lambda(e, s)
+
+	case Apply:
+		fn, err := in.infer(e.Fn, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		args, err := in.inferAll(e.Args, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		res := in.newVar()
+		if err := in.unify(fn, tyFn{params: args, effects: eff, result: res}); err != nil {
+			return nil, err
+		}
+		return res, nil
+
+	case Handle:
+		return in.handle(e, s, eff)
+
+	case Signal:
+		sig, err := in.effect(e.Effect, len(e.Args))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Pos, err)
+		}
+		args, err := in.inferAll(e.Args, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		for i, a := range args {
+			if err := in.unify(sig.params[i], a); err != nil {
+				return nil, fmt.Errorf("%s: argument to %s: %w", e.Pos, e.Effect, err)
+			}
+		}
+		if err := in.unify(eff, tyRow{labels: []string{e.Effect}, tail: in.newVar()}); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Pos, err)
+		}
+		return sig.result, nil
+
+	case Resume:
+		r := s.resume
+		if r == nil {
+			return nil, fmt.Errorf("%s: %w", e.Pos, errNotInHandler)
+		}
+		with, err := in.infer(e.With, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.unify(r.arg, with); err != nil {
+			return nil, fmt.Errorf("%s: resuming: %w", e.Pos, err)
+		}
+		if err := in.unify(eff, r.effects); err != nil {
+			return nil, fmt.Errorf("%s: resuming: %w", e.Pos, err)
+		}
+		return r.result, nil
+
+	case Int:
+		return intType, nil
+
+	case Bool:
+		return boolType, nil
+
+	case Prim:
+		args, err := in.inferAll(e.Args, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != e.Op.Arity() {
+			return nil, fmt.Errorf("%w: %s takes %d arguments, got %d", errWrongArgCount, e.Op, e.Op.Arity(), len(args))
+		}
+		for _, a := range args {
+			if err := in.unify(intType, a); err != nil {
+				return nil, fmt.Errorf("argument to %s: %w", e.Op, err)
+			}
+		}
+		if e.Op == prim.Eq || e.Op == prim.Lt {
+			return boolType, nil
+		}
+		return intType, nil
+
+	case If:
+		cond, err := in.infer(e.Cond, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.unify(boolType, cond); err != nil {
+			return nil, fmt.Errorf("condition: %w", err)
+		}
+		then, err := in.infer(e.Then, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		els, err := in.infer(e.Else, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.unify(then, els); err != nil {
+			return nil, err
+		}
+		return then, nil
+
+	case Data:
+		return in.infer(e.Body, s.declare(e), eff)
+
+	case Construct:
+		return in.construct(e, s, eff)
+
+	case Match:
+		return in.match(e, s, eff)
+
+	case LetRec:
+		s, err := in.letRec(e, s)
+		if err != nil {
+			return nil, err
+		}
+		return in.infer(e.Body, s, eff)
+	}
+
+	return nil, fmt.Errorf("%w: %#v", errUnsupported, e)
+}
+
+func (in *inferrer) inferAll(es []Expr, s inferScope, eff ty) ([]ty, error) {
+	var ts []ty
+	for _, x := range es {
+		t, err := in.infer(x, s, eff)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// lambda infers a function type, with the effects of the body as those of calling the function.
+func (in *inferrer) lambda(e Lambda, s inferScope) (ty, error) {
+	var params []ty
+	for _, x := range e.Vars {
+		p := in.newVar()
+		params = append(params, p)
+		s = s.bind(x, p)
+	}
+	eff := in.newVar()
+	res, err := in.infer(e.Body, s, eff)
+	if err != nil {
+		return nil, err
+	}
+	return tyFn{params: params, effects: eff, result: res}, nil
+}
+
+func (in *inferrer) letRec(e LetRec, s inferScope) (inferScope, error) {
+	in.level++
+	ts := make([]ty, len(e.Bindings))
+	for i, b := range e.Bindings {
+		ts[i] = in.newVar()
+		s = s.bind(b.Name, ts[i])
+	}
+	for i, b := range e.Bindings {
+		t, err := in.lambda(b.Fn, s)
+		if err != nil {
+			return s, fmt.Errorf("in %s: %w", b.Name, err)
+		}
+		if err := in.unify(ts[i], t); err != nil {
+			return s, fmt.Errorf("in %s: %w", b.Name, err)
+		}
+	}
+	in.level--
+
+	for i, b := range e.Bindings {
+		in.generalize(ts[i])
+		s = s.bind(b.Name, ts[i])
+	}
+	return s, nil
+}
+
+// handle infers the handled expression with the handled effects added to the row, and the effect
+// handlers without them. Resuming a deep handler gives the result of the handle expression, while
+// resuming a shallow handler gives the result of the handled expression, signalling any of the
+// handled effects that it signals.
+func (in *inferrer) handle(e Handle, s inferScope, eff ty) (ty, error) {
+	var handled []string
+	for _, h := range e.Handlers {
+		handled = append(handled, h.Effect)
+	}
+	inner := tyRow{labels: handled, tail: eff}
+
+	eval, err := in.infer(e.Eval, s, inner)
+	if err != nil {
+		return nil, err
+	}
+
+	res := eval
+	if e.Return != nil {
+		res, err = in.infer(e.Return.Body, s.bind(e.Return.Var, eval), eff)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, h := range e.Handlers {
+		sig, err := in.effect(h.Effect, len(h.Vars))
+		if err != nil {
+			return nil, fmt.Errorf("handling %s: %w", h.Effect, err)
+		}
+
+		hs := s
+		for i, x := range h.Vars {
+			hs = hs.bind(x, sig.params[i])
+		}
+		hs.resume = &resumeType{arg: sig.result, effects: eff, result: res}
+		if e.Shallow {
+			hs.resume = &resumeType{arg: sig.result, effects: inner, result: eval}
+		}
+
+		t, err := in.infer(h.Body, hs, eff)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.unify(res, t); err != nil {
+			return nil, fmt.Errorf("handling %s: %w", h.Effect, err)
+		}
+	}
+
+	return res, nil
+}
+
+func (in *inferrer) construct(e Construct, s inferScope, eff ty) (ty, error) {
+	c, ok := s.constructors[e.Constructor]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownConstructor, e.Constructor)
+	}
+	if len(c.fields) != len(e.Args) {
+		return nil, fmt.Errorf("%w: %s takes %d arguments, got %d", errWrongArgCount, e.Constructor, len(c.fields), len(e.Args))
+	}
+
+	t, params := in.dataType(c.data)
+	args, err := in.inferAll(e.Args, s, eff)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range c.fields {
+		ft, err := fieldType(f, params)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.unify(ft, args[i]); err != nil {
+			return nil, fmt.Errorf("argument to %s: %w", e.Constructor, err)
+		}
+	}
+	return t, nil
+}
+
+func (in *inferrer) match(e Match, s inferScope, eff ty) (ty, error) {
+	on, err := in.infer(e.On, s, eff)
+	if err != nil {
+		return nil, err
+	}
+
+	res := in.newVar()
+	for _, c := range e.Cases {
+		con, ok := s.constructors[c.Constructor]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errUnknownConstructor, c.Constructor)
+		}
+		if len(con.fields) != len(c.Vars) {
+			return nil, fmt.Errorf("%w: %s takes %d arguments, got %d", errWrongArgCount, c.Constructor, len(con.fields), len(c.Vars))
+		}
+
+		t, params := in.dataType(con.data)
+		if err := in.unify(on, t); err != nil {
+			return nil, fmt.Errorf("matching %s: %w", c.Constructor, err)
+		}
+
+		cs := s
+		for i, f := range con.fields {
+			ft, err := fieldType(f, params)
+			if err != nil {
+				return nil, err
+			}
+			cs = cs.bind(c.Vars[i], ft)
+		}
+
+		body, err := in.infer(c.Body, cs, eff)
+		if err != nil {
+			return nil, err
+		}
+		if err := in.unify(res, body); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// dataType gives a fresh instance of a data type, along with the types its parameters stand for.
+func (in *inferrer) dataType(d Data) (ty, map[string]ty) {
+	params := map[string]ty{}
+	var args []ty
+	for _, p := range d.Params {
+		v := in.newVar()
+		params[p] = v
+		args = append(args, v)
+	}
+	return tyCon{name: d.Name, args: args}, params
+}
+
+func fieldType(t Type, params map[string]ty) (ty, error) {
+	switch t := t.(type) {
+	case TypeVar:
+		if p, ok := params[t.Name]; ok {
+			return p, nil
+		}
+		return nil, fmt.Errorf("%w: %s", errUnknownType, t.Name)
+
+	case TypeName:
+		var args []ty
+		for _, a := range t.Args {
+			at, err := fieldType(a, params)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, at)
+		}
+		return tyCon{name: t.Name, args: args}, nil
+	}
+	return nil, fmt.Errorf("%w: %#v", errUnknownType, t)
+}
+
+func prune(t ty) ty {
+	for {
+		v, ok := t.(*tyVar)
+		if !ok || v.ref == nil {
+			return t
+		}
+		t = v.ref
+	}
+}
+
+// flattenRow gives the effects in a row, and the variable that extends it, if any.
+func flattenRow(t ty) ([]string, *tyVar) {
+	seen := map[string]bool{}
+	var labels []string
+	for {
+		switch r := prune(t).(type) {
+		case tyRow:
+			for _, l := range r.labels {
+				if !seen[l] {
+					seen[l] = true
+					labels = append(labels, l)
+				}
+			}
+			t = r.tail
+			if t == nil {
+				sort.Strings(labels)
+				return labels, nil
+			}
+			continue
+
+		case *tyVar:
+			sort.Strings(labels)
+			return labels, r
+		}
+		panic("bad row")
+	}
+}
+
+func (in *inferrer) unify(a, b ty) error {
+	a, b = prune(a), prune(b)
+
+	if av, ok := a.(*tyVar); ok {
+		if bv, ok := b.(*tyVar); ok && av == bv {
+			return nil
+		}
+		if _, ok := b.(tyRow); ok {
+			return in.unifyRows(a, b)
+		}
+		return in.bind(av, b)
+	}
+	if bv, ok := b.(*tyVar); ok {
+		if _, ok := a.(tyRow); ok {
+			return in.unifyRows(a, b)
+		}
+		return in.bind(bv, a)
+	}
+
+	switch a := a.(type) {
+	case tyCon:
+		b, ok := b.(tyCon)
+		if !ok || a.name != b.name || len(a.args) != len(b.args) {
+			break
+		}
+		for i := range a.args {
+			if err := in.unify(a.args[i], b.args[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case tyFn:
+		b, ok := b.(tyFn)
+		if !ok || len(a.params) != len(b.params) {
+			break
+		}
+		for i := range a.params {
+			if err := in.unify(a.params[i], b.params[i]); err != nil {
+				return err
+			}
+		}
+		if err := in.unify(a.effects, b.effects); err != nil {
+			return err
+		}
+		return in.unify(a.result, b.result)
+
+	case tyRow:
+		return in.unifyRows(a, b)
+	}
+
+	return in.mismatch(a, b)
+}
+
+// unifyRows makes two rows contain the same effects, extending them where they are open.
+func (in *inferrer) unifyRows(a, b ty) error {
+	al, at := flattenRow(a)
+	bl, bt := flattenRow(b)
+	onlyA, onlyB := difference(al, bl), difference(bl, al)
+
+	if at == bt {
+		if at == nil {
+			if len(onlyA) != 0 || len(onlyB) != 0 {
+				return in.mismatch(a, b)
+			}
+			return nil
+		}
+		if len(onlyA) == 0 && len(onlyB) == 0 {
+			return nil
+		}
+		at.ref = tyRow{labels: append(onlyA, onlyB...), tail: in.varAt(at.level)}
+		return nil
+	}
+
+	var tail ty
+	if at != nil && bt != nil {
+		tail = in.varAt(minInt(at.level, bt.level))
+	}
+	if len(onlyB) != 0 || at != nil {
+		if at == nil {
+			return in.mismatch(a, b)
+		}
+		at.ref = tyRow{labels: onlyB, tail: tail}
+	}
+	if len(onlyA) != 0 || bt != nil {
+		if bt == nil {
+			return in.mismatch(a, b)
+		}
+		bt.ref = tyRow{labels: onlyA, tail: tail}
+	}
+	return nil
+}
+
+func (in *inferrer) varAt(level int) *tyVar {
+	return &tyVar{level: level}
+}
+
+func (in *inferrer) bind(v *tyVar, t ty) error {
+	if in.occurs(v, t) {
+		return fmt.Errorf("%w: %s occurs in %s", errTypeMismatch, in.show(v), in.show(t))
+	}
+	v.ref = t
+	return nil
+}
+
+// occurs checks whether v occurs in t, lowering the level of the variables in t to that of v so
+// that they are not generalised while v is in scope.
+func (in *inferrer) occurs(v *tyVar, t ty) bool {
+	switch t := prune(t).(type) {
+	case *tyVar:
+		if t == v {
+			return true
+		}
+		t.level = minInt(t.level, v.level)
+	case tyCon:
+		for _, a := range t.args {
+			if in.occurs(v, a) {
+				return true
+			}
+		}
+	case tyFn:
+		for _, p := range t.params {
+			if in.occurs(v, p) {
+				return true
+			}
+		}
+		return in.occurs(v, t.effects) || in.occurs(v, t.result)
+	case tyRow:
+		if t.tail != nil {
+			return in.occurs(v, t.tail)
+		}
+	}
+	return false
+}
+
+func (in *inferrer) mismatch(a, b ty) error {
+	p := newTypePrinter()
+	return fmt.Errorf("%w: %s and %s", errTypeMismatch, p.print(a), p.print(b))
+}
+
+func (in *inferrer) show(t ty) string {
+	return newTypePrinter().print(t)
+}
+
+// generalize marks the variables in t that were introduced within the current level as generic.
+func (in *inferrer) generalize(t ty) {
+	switch t := prune(t).(type) {
+	case *tyVar:
+		if t.level > in.level {
+			t.level = genericLevel
+		}
+	case tyCon:
+		for _, a := range t.args {
+			in.generalize(a)
+		}
+	case tyFn:
+		for _, p := range t.params {
+			in.generalize(p)
+		}
+		in.generalize(t.effects)
+		in.generalize(t.result)
+	case tyRow:
+		if t.tail != nil {
+			in.generalize(t.tail)
+		}
+	}
+}
+
+// instantiate copies t, replacing its generic variables with fresh ones.
+func (in *inferrer) instantiate(t ty, fresh map[*tyVar]ty) ty {
+	switch t := prune(t).(type) {
+	case *tyVar:
+		if t.level != genericLevel {
+			return t
+		}
+		if fresh[t] == nil {
+			fresh[t] = in.newVar()
+		}
+		return fresh[t]
+	case tyCon:
+		var args []ty
+		for _, a := range t.args {
+			args = append(args, in.instantiate(a, fresh))
+		}
+		return tyCon{name: t.name, args: args}
+	case tyFn:
+		var params []ty
+		for _, p := range t.params {
+			params = append(params, in.instantiate(p, fresh))
+		}
+		return tyFn{params: params, effects: in.instantiate(t.effects, fresh), result: in.instantiate(t.result, fresh)}
+	case tyRow:
+		r := tyRow{labels: t.labels}
+		if t.tail != nil {
+			r.tail = in.instantiate(t.tail, fresh)
+		}
+		return r
+	}
+	return t
+}
+
+// typePrinter names type variables in the order they appear.
+type typePrinter struct {
+	names map[*tyVar]string
+	types int
+	rows  int
+}
+
+func newTypePrinter() *typePrinter {
+	return &typePrinter{names: map[*tyVar]string{}}
+}
+
+func (p *typePrinter) name(v *tyVar, row bool) string {
+	if n, ok := p.names[v]; ok {
+		return n
+	}
+	var n string
+	if row {
+		n = "e"
+		if p.rows > 0 {
+			n = fmt.Sprintf("e%d", p.rows)
+		}
+		p.rows++
+	} else {
+		n = string(rune('a' + p.types%26))
+		if p.types >= 26 {
+			n = fmt.Sprintf("%s%d", n, p.types/26)
+		}
+		p.types++
+	}
+	p.names[v] = n
+	return n
+}
+
+func (p *typePrinter) print(t ty) string {
+	switch t := prune(t).(type) {
+	case *tyVar:
+		return p.name(t, false)
+
+	case tyCon:
+		if len(t.args) == 0 {
+			return t.name
+		}
+		return fmt.Sprintf("%s(%s)", t.name, p.printAll(t.args))
+
+	case tyFn:
+		params := p.printAll(t.params)
+		labels, tail := flattenRow(t.effects)
+		switch {
+		case tail == nil && len(labels) == 0:
+			return fmt.Sprintf("(%s) -> %s", params, p.print(t.result))
+		case tail == nil:
+			return fmt.Sprintf("(%s) -{%s}-> %s", params, strings.Join(labels, ", "), p.print(t.result))
+		case len(labels) == 0:
+			return fmt.Sprintf("(%s) -{%s}-> %s", params, p.name(tail, true), p.print(t.result))
+		}
+		return fmt.Sprintf("(%s) -{%s | %s}-> %s", params, strings.Join(labels, ", "), p.name(tail, true), p.print(t.result))
+
+	case tyRow:
+		labels, tail := flattenRow(t)
+		if tail == nil {
+			return "{" + strings.Join(labels, ", ") + "}"
+		}
+		if len(labels) == 0 {
+			return "{" + p.name(tail, true) + "}"
+		}
+		return fmt.Sprintf("{%s | %s}", strings.Join(labels, ", "), p.name(tail, true))
+	}
+	return "?"
+}
+
+func (p *typePrinter) printAll(ts []ty) string {
+	parts := make([]string, len(ts))
+	for i, t := range ts {
+		parts[i] = p.print(t)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func difference(xs, ys []string) []string {
+	in := map[string]bool{}
+	for _, y := range ys {
+		in[y] = true
+	}
+	var res []string
+	for _, x := range xs {
+		if !in[x] {
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+func minInt(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
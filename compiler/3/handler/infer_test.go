@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestInfer(t *testing.T) {
+	get := Signal{Effect: "get"}
+	plus := func(x, y Expr) Expr {
+		return Prim{Op: prim.Add, Args: []Expr{x, y}}
+	}
+	option := func(body Expr) Expr {
+		return Data{
+			Name:   "option",
+			Params: []string{"a"},
+			Constructors: []Constructor{
+				{Name: "none"},
+				{Name: "some", Fields: []Type{TypeVar{Name: "a"}}},
+			},
+			Body: body,
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		in   Expr
+		out  Inference
+	}{
+		{
+			name: "int",
+			in:   Int{Value: 1},
+			out:  Inference{Type: "int", Effects: "{}"},
+		},
+		{
+			name: "identity",
+			in: LetRec{
+				Bindings: []Binding{{Name: "id", Fn: Lambda{Vars: []string{"x"}, Body: Var{Name: "x"}}}},
+				Body:     Apply{Fn: Var{Name: "id"}, Args: []Expr{Bool{Value: true}}},
+			},
+			out: Inference{
+				Bindings: []Typing{{Name: "id", Type: "(a) -{e}-> a"}},
+				Type:     "bool",
+				Effects:  "{}",
+			},
+		},
+		{
+			name: "higherOrder",
+			in: LetRec{
+				Bindings: []Binding{{Name: "call", Fn: Lambda{
+					Vars: []string{"f", "x"},
+					Body: Apply{Fn: Var{Name: "f"}, Args: []Expr{Var{Name: "x"}}},
+				}}},
+				Body: Var{Name: "call"},
+			},
+			out: Inference{
+				Bindings: []Typing{{Name: "call", Type: "((a) -{e}-> b, a) -{e}-> b"}},
+				Type:     "((a) -{e}-> b, a) -{e}-> b",
+				Effects:  "{}",
+			},
+		},
+		{
+			name: "signal",
+			in: LetRec{
+				Bindings: []Binding{{Name: "next", Fn: Lambda{Body: plus(get, Int{Value: 1})}}},
+				Body:     Apply{Fn: Var{Name: "next"}},
+			},
+			out: Inference{
+				Bindings: []Typing{{Name: "next", Type: "() -{get | e}-> int"}},
+				Type:     "int",
+				Effects:  "{get}",
+			},
+		},
+		{
+			name: "handled",
+			in: LetRec{
+				Bindings: []Binding{{Name: "run", Fn: Lambda{Body: Handle{
+					Eval: plus(get, Signal{Effect: "put", Args: []Expr{Int{Value: 1}}}),
+					Handlers: []EffectHandler{
+						{Effect: "get", Body: Resume{With: Int{Value: 1}}},
+					},
+					Return: &ReturnClause{Var: "x", Body: Prim{Op: prim.Eq, Args: []Expr{Var{Name: "x"}, Int{Value: 2}}}},
+				}}}},
+				Body: Var{Name: "run"},
+			},
+			out: Inference{
+				Bindings: []Typing{{Name: "run", Type: "() -{put | e}-> bool"}},
+				Type:     "() -{put | e}-> bool",
+				Effects:  "{}",
+			},
+		},
+		{
+			name: "data",
+			in: option(LetRec{
+				Bindings: []Binding{{Name: "get", Fn: Lambda{
+					Vars: []string{"o", "d"},
+					Body: Match{On: Var{Name: "o"}, Cases: []Case{
+						{Constructor: "none", Body: Var{Name: "d"}},
+						{Constructor: "some", Vars: []string{"x"}, Body: Var{Name: "x"}},
+					}},
+				}}},
+				Body: Construct{Constructor: "some", Args: []Expr{Int{Value: 1}}},
+			}),
+			out: Inference{
+				Bindings: []Typing{{Name: "get", Type: "(option(a), a) -{e}-> a"}},
+				Type:     "option(int)",
+				Effects:  "{}",
+			},
+		},
+		{
+			name: "shallow",
+			in: Handle{
+				Eval: plus(get, get),
+				Handlers: []EffectHandler{
+					{Effect: "get", Body: Resume{With: Int{Value: 1}}},
+				},
+				Shallow: true,
+			},
+			out: Inference{Type: "int", Effects: "{get}"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Infer(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("got %#v, expecting %#v", out, test.out)
+			}
+		})
+	}
+}
+
+func TestInferenceString(t *testing.T) {
+	in := Inference{
+		Bindings: []Typing{{Name: "id", Type: "(a) -{e}-> a"}},
+		Type:     "int",
+		Effects:  "{get}",
+	}
+	out := "id : (a) -{e}-> a\nint ! {get}"
+	if in.String() != out {
+		t.Errorf("got %q, expecting %q", in.String(), out)
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   Expr
+		err  error
+	}{
+		{
+			name: "unbound",
+			in:   Var{Name: "x"},
+			err:  errUnbound,
+		},
+		{
+			name: "resumeShape",
+			in: Handle{
+				Eval: Prim{Op: prim.Add, Args: []Expr{Signal{Effect: "get"}, Int{Value: 1}}},
+				Handlers: []EffectHandler{
+					{Effect: "get", Body: Resume{With: Bool{Value: true}, Pos: Pos{Line: 3, Col: 7}}},
+				},
+			},
+			err: errTypeMismatch,
+		},
+		{
+			name: "effectArgCount",
+			in: Handle{
+				Eval: Signal{Effect: "put", Args: []Expr{Int{Value: 1}}},
+				Handlers: []EffectHandler{
+					{Effect: "put", Vars: []string{"x", "y"}, Body: Int{Value: 0}},
+				},
+			},
+			err: errWrongArgCount,
+		},
+		{
+			name: "notAFunction",
+			in:   Apply{Fn: Int{Value: 1}},
+			err:  errTypeMismatch,
+		},
+		{
+			name: "resumeOutsideHandler",
+			in:   Resume{With: Int{Value: 1}},
+			err:  errNotInHandler,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Infer(test.in)
+			if !errors.Is(err, test.err) {
+				t.Errorf("got %v, expecting %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import "github.com/bobappleyard/goose/irjson"
+
+var codec = irjson.NewCodec(
+	Var{},
+	Apply{},
+	Lambda{},
+	Handle{},
+	Signal{},
+	Resume{},
+	Int{},
+	Prim{},
+	Bool{},
+	If{},
+	Data{},
+	Construct{},
+	Match{},
+	LetRec{},
+	TypeVar{},
+	TypeName{},
+)
+
+func (e Var) MarshalJSON() ([]byte, error)       { return codec.Marshal(e) }
+func (e Apply) MarshalJSON() ([]byte, error)     { return codec.Marshal(e) }
+func (e Lambda) MarshalJSON() ([]byte, error)    { return codec.Marshal(e) }
+func (e Handle) MarshalJSON() ([]byte, error)    { return codec.Marshal(e) }
+func (e Signal) MarshalJSON() ([]byte, error)    { return codec.Marshal(e) }
+func (e Resume) MarshalJSON() ([]byte, error)    { return codec.Marshal(e) }
+func (e Int) MarshalJSON() ([]byte, error)       { return codec.Marshal(e) }
+func (e Prim) MarshalJSON() ([]byte, error)      { return codec.Marshal(e) }
+func (e Bool) MarshalJSON() ([]byte, error)      { return codec.Marshal(e) }
+func (e If) MarshalJSON() ([]byte, error)        { return codec.Marshal(e) }
+func (e Data) MarshalJSON() ([]byte, error)      { return codec.Marshal(e) }
+func (e Construct) MarshalJSON() ([]byte, error) { return codec.Marshal(e) }
+func (e Match) MarshalJSON() ([]byte, error)     { return codec.Marshal(e) }
+func (e LetRec) MarshalJSON() ([]byte, error)    { return codec.Marshal(e) }
+func (t TypeVar) MarshalJSON() ([]byte, error)   { return codec.Marshal(t) }
+func (t TypeName) MarshalJSON() ([]byte, error)  { return codec.Marshal(t) }
+
+// UnmarshalExpr reads an expression written as JSON.
+func UnmarshalExpr(data []byte) (Expr, error) {
+	var e Expr
+	if err := codec.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
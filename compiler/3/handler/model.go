@@ -1,46 +1,172 @@
 package handler
 
+import (
+	"fmt"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
 type Expr interface {
 	expr()
 }
 
+// Pos is a position in the source of a program. The zero Pos is an unknown position.
+type Pos struct {
+	Line, Col int
+}
+
+func (p Pos) String() string {
+	if p.Line == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
 type Var struct {
 	Name string
 }
 
+// Apply calls a function. Pure applications only ever call pure functions.
 type Apply struct {
-	Fn  Expr
-	Arg Expr
+	Fn   Expr
+	Args []Expr
+	Pure bool
+
+	// id identifies the application to MarkPure.
+	id int
 }
 
+// Lambda is a function. A pure function never signals an effect, so it has no need of the handlers
+// in effect where it is called. See MarkPure.
 type Lambda struct {
-	Var  string
+	Vars []string
 	Body Expr
+	Pure bool
+
+	// id identifies the function to MarkPure.
+	id int
 }
 
+// Handle installs handlers for the effects signalled by Eval. A deep handler handles every effect
+// signalled by the computation, including after it is resumed. A shallow handler only handles the
+// first, and is not reinstated when the computation is resumed.
 type Handle struct {
 	Eval     Expr
 	Handlers []EffectHandler
+	Return   *ReturnClause
+	Shallow  bool
 }
 
 type EffectHandler struct {
 	Effect string
-	Var    string
+	Vars   []string
 	Body   Expr
 }
 
+// ReturnClause transforms the value of a handled expression. It is optional.
+type ReturnClause struct {
+	Var  string
+	Body Expr
+}
+
 type Signal struct {
 	Effect string
-	Arg    Expr
+	Args   []Expr
+	Pos    Pos
 }
 
 type Resume struct {
 	With Expr
+	Pos  Pos
+}
+
+type Int struct {
+	Value int
+}
+
+type Prim struct {
+	Op   prim.Op
+	Args []Expr
+}
+
+type Bool struct {
+	Value bool
+}
+
+type If struct {
+	Cond Expr
+	Then Expr
+	Else Expr
+}
+
+// Data declares a sum type. Its constructors are in scope within Body.
+type Data struct {
+	Name         string
+	Params       []string
+	Constructors []Constructor
+	Body         Expr
 }
 
-func (Var) expr()    {}
-func (Apply) expr()  {}
-func (Lambda) expr() {}
-func (Handle) expr() {}
-func (Signal) expr() {}
-func (Resume) expr() {}
+type Constructor struct {
+	Name   string
+	Fields []Type
+}
+
+type Construct struct {
+	Constructor string
+	Args        []Expr
+}
+
+type Match struct {
+	On    Expr
+	Cases []Case
+}
+
+type Case struct {
+	Constructor string
+	Vars        []string
+	Body        Expr
+}
+
+// LetRec binds a group of mutually recursive functions within Body.
+type LetRec struct {
+	Bindings []Binding
+	Body     Expr
+}
+
+type Binding struct {
+	Name string
+	Fn   Lambda
+}
+
+// Type is the type of a field in a data declaration.
+type Type interface {
+	typ()
+}
+
+type TypeVar struct {
+	Name string
+}
+
+type TypeName struct {
+	Name string
+	Args []Type
+}
+
+func (Var) expr()       {}
+func (Apply) expr()     {}
+func (Lambda) expr()    {}
+func (Handle) expr()    {}
+func (Signal) expr()    {}
+func (Resume) expr()    {}
+func (Int) expr()       {}
+func (Prim) expr()      {}
+func (Bool) expr()      {}
+func (If) expr()        {}
+func (Data) expr()      {}
+func (Construct) expr() {}
+func (Match) expr()     {}
+func (LetRec) expr()    {}
+
+func (TypeVar) typ()  {}
+func (TypeName) typ() {}
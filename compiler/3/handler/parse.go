@@ -0,0 +1,812 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errSyntax = errors.New("syntax error")
+
+// Parse reads an expression. The syntax is:
+//
+//	expr   = "data" name ["(" names ")"] "=" ctor {"|" ctor} "in" expr
+//	       | "letrec" name "(" names ")" "=" expr {";" name "(" names ")" "=" expr} "in" expr
+//	       | sum ["==" sum | "<" sum]
+//	sum    = term {("+" | "-") term}
+//	term   = call {"*" call}
+//	call   = atom {"(" exprs ")"}
+//	atom   = name | ["-"] int | "true" | "false" | "(" expr ")"
+//	       | "fun" "(" names ")" "{" expr "}"
+//	       | "if" expr "{" expr "}" "else" "{" expr "}"
+//	       | "handle" ["shallow"] "{" expr "}" "with" "{" clause {";" clause} "}"
+//	       | "signal" name "(" exprs ")"
+//	       | "resume" "(" expr ")"
+//	       | "match" expr "{" name ["(" names ")"] "->" expr {";" ...} "}"
+//	       | "cmp" "(" expr "," expr ")"
+//	clause = name "(" names ")" "->" expr | "return" "(" name ")" "->" expr
+//	ctor   = name ["(" type {"," type} ")"]
+//	type   = name ["(" type {"," type} ")"]
+//
+// Names that have been declared as constructors build values, and the names of a data declaration's
+// parameters are type variables. Comments run from "//" to the end of the line.
+func Parse(src string) (Expr, error) {
+	toks, err := scan(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, constructors: map[string]bool{}}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return e, nil
+}
+
+// ParseTopLevel reads an entry at the top level of a session, which is either an expression or a
+// declaration. Declarations are data declarations and recursive bindings without "in" or a body, and
+// are returned with a nil Body. The constructors declared by earlier entries, given in decls, are in
+// scope.
+func ParseTopLevel(src string, decls []Expr) (Expr, error) {
+	p, err := newTopLevelParser(src, decls)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Expr
+	switch {
+	case p.is("data"):
+		e, err = p.data(true)
+	case p.is("letrec"):
+		e, err = p.letRec(true)
+	default:
+		e, err = p.expr()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return e, nil
+}
+
+// ParseDecls reads a series of declarations, such as those of a library, each as ParseTopLevel
+// would. The constructors declared by each are in scope in those that follow.
+func ParseDecls(src string, decls []Expr) ([]Expr, error) {
+	p, err := newTopLevelParser(src, decls)
+	if err != nil {
+		return nil, err
+	}
+	p.declsOnly = true
+
+	var res []Expr
+	for p.peek().kind != tokEOF {
+		var e Expr
+		switch {
+		case p.is("data"):
+			e, err = p.data(true)
+		case p.is("letrec"):
+			e, err = p.letRec(true)
+		default:
+			return nil, fmt.Errorf("%w, expecting a declaration", p.unexpected(p.peek()))
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func newTopLevelParser(src string, decls []Expr) (*parser, error) {
+	toks, err := scan(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks, constructors: map[string]bool{}}
+	for _, d := range decls {
+		if d, ok := d.(Data); ok {
+			for _, c := range d.Constructors {
+				p.constructors[c.Name] = true
+			}
+		}
+	}
+	return p, nil
+}
+
+// Wrap places e within declarations read by ParseTopLevel or ParseDecls, with the first outermost.
+func Wrap(decls []Expr, e Expr) Expr {
+	for i := len(decls) - 1; i >= 0; i-- {
+		switch d := decls[i].(type) {
+		case Data:
+			d.Body = e
+			e = d
+		case LetRec:
+			d.Body = e
+			e = d
+		}
+	}
+	return e
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokInt
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  Pos
+}
+
+var keywords = map[string]bool{
+	"data": true, "letrec": true, "in": true, "fun": true, "if": true, "else": true,
+	"handle": true, "shallow": true, "with": true, "return": true, "signal": true, "resume": true,
+	"match": true, "cmp": true, "true": true, "false": true,
+}
+
+var puncts = []string{"->", "==", "(", ")", "{", "}", ",", ";", "|", "=", "+", "-", "*", "<", "."}
+
+func scan(src string) ([]token, error) {
+	var toks []token
+	rs := []rune(src)
+	line, col := 1, 1
+	advance := func(n int) {
+		for _, r := range rs[:n] {
+			if r == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+		}
+		rs = rs[n:]
+	}
+
+next:
+	for len(rs) > 0 {
+		pos := Pos{Line: line, Col: col}
+		r := rs[0]
+		switch {
+		case unicode.IsSpace(r):
+			advance(1)
+			continue
+
+		case r == '/' && len(rs) > 1 && rs[1] == '/':
+			n := 0
+			for n < len(rs) && rs[n] != '\n' {
+				n++
+			}
+			advance(n)
+			continue
+
+		case unicode.IsDigit(r):
+			n := 0
+			for n < len(rs) && unicode.IsDigit(rs[n]) {
+				n++
+			}
+			toks = append(toks, token{kind: tokInt, text: string(rs[:n]), pos: pos})
+			advance(n)
+			continue
+
+		case unicode.IsLetter(r) || r == '_':
+			n := 0
+			for n < len(rs) && (unicode.IsLetter(rs[n]) || unicode.IsDigit(rs[n]) || rs[n] == '_' || rs[n] == '\'') {
+				n++
+			}
+			toks = append(toks, token{kind: tokName, text: string(rs[:n]), pos: pos})
+			advance(n)
+			continue
+		}
+
+		for _, p := range puncts {
+			if len(rs) >= len(p) && string(rs[:len(p)]) == p {
+				toks = append(toks, token{kind: tokPunct, text: p, pos: pos})
+				advance(len(p))
+				continue next
+			}
+		}
+
+		return nil, fmt.Errorf("%s: %w: unexpected %q", pos, errSyntax, r)
+	}
+
+	return append(toks, token{kind: tokEOF, pos: Pos{Line: line, Col: col}}), nil
+}
+
+type parser struct {
+	toks         []token
+	next         int
+	constructors map[string]bool
+
+	// declsOnly is set when declarations at the top level never have a body.
+	declsOnly bool
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.toks[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// endOfDecl checks whether a declaration at the top level has ended without a body.
+func (p *parser) endOfDecl() bool {
+	return p.declsOnly || p.peek().kind == tokEOF
+}
+
+// is checks whether the next token is the keyword or punctuation given, consuming it if so.
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	if t.kind == tokEOF || t.kind == tokInt || t.text != text {
+		return false
+	}
+	p.next++
+	return true
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return fmt.Errorf("%w, expecting %q", p.unexpected(p.peek()), text)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("%s: %w: unexpected end of input", t.pos, errSyntax)
+	}
+	return fmt.Errorf("%s: %w: unexpected %q", t.pos, errSyntax, t.text)
+}
+
+func (p *parser) name() (string, error) {
+	t := p.peek()
+	if t.kind != tokName || keywords[t.text] {
+		return "", fmt.Errorf("%w, expecting a name", p.unexpected(t))
+	}
+	p.next++
+	return t.text, nil
+}
+
+// effect reads the name of an effect, which may be qualified with the names of the groups that it
+// belongs to, as in console.print.
+func (p *parser) effect() (string, error) {
+	name, err := p.name()
+	if err != nil {
+		return "", err
+	}
+	for p.is(".") {
+		part, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		name += "." + part
+	}
+	return name, nil
+}
+
+// names reads a parenthesised list of names.
+func (p *parser) names() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var res []string
+	for !p.is(")") {
+		if len(res) != 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		n, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+// exprs reads a parenthesised list of expressions.
+func (p *parser) exprs() ([]Expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var res []Expr
+	for !p.is(")") {
+		if len(res) != 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func (p *parser) block() (Expr, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (p *parser) expr() (Expr, error) {
+	switch {
+	case p.is("data"):
+		return p.data(false)
+
+	case p.is("letrec"):
+		return p.letRec(false)
+	}
+
+	left, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []prim.Op{prim.Eq, prim.Lt} {
+		if p.is(infix[op].symbol) {
+			right, err := p.sum()
+			if err != nil {
+				return nil, err
+			}
+			return Prim{Op: op, Args: []Expr{left, right}}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) sum() (Expr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := prim.Add
+		if p.is("-") {
+			op = prim.Sub
+		} else if !p.is("+") {
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = Prim{Op: op, Args: []Expr{left, right}}
+	}
+}
+
+func (p *parser) term() (Expr, error) {
+	left, err := p.call()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") {
+		right, err := p.call()
+		if err != nil {
+			return nil, err
+		}
+		left = Prim{Op: prim.Mul, Args: []Expr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) call() (Expr, error) {
+	fn, err := p.atom()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().text == "(" {
+		args, err := p.exprs()
+		if err != nil {
+			return nil, err
+		}
+		fn = Apply{Fn: fn, Args: args}
+	}
+	return fn, nil
+}
+
+func (p *parser) atom() (Expr, error) {
+	t := p.take()
+
+	switch t.kind {
+	case tokInt:
+		return p.int(t, 1)
+
+	case tokPunct:
+		switch t.text {
+		case "-":
+			if n := p.take(); n.kind == tokInt {
+				return p.int(n, -1)
+			}
+			return nil, p.unexpected(t)
+
+		case "(":
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+
+	case tokName:
+		if !keywords[t.text] {
+			return p.variable(t)
+		}
+		switch t.text {
+		case "true", "false":
+			return Bool{Value: t.text == "true"}, nil
+
+		case "fun":
+			return p.lambda()
+
+		case "if":
+			return p.ifThenElse()
+
+		case "handle":
+			return p.handle()
+
+		case "signal":
+			return p.signal(t)
+
+		case "resume":
+			return p.resume(t)
+
+		case "match":
+			return p.match()
+
+		case "cmp":
+			args, err := p.exprs()
+			if err != nil {
+				return nil, err
+			}
+			if len(args) != prim.Cmp.Arity() {
+				return nil, fmt.Errorf("%s: %w: cmp takes %d operands", t.pos, errSyntax, prim.Cmp.Arity())
+			}
+			return Prim{Op: prim.Cmp, Args: args}, nil
+		}
+	}
+
+	return nil, p.unexpected(t)
+}
+
+func (p *parser) int(t token, sign int) (Expr, error) {
+	n, err := strconv.Atoi(t.text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", t.pos, errSyntax, err)
+	}
+	return Int{Value: sign * n}, nil
+}
+
+// variable reads a name, which builds a value if it is a constructor.
+func (p *parser) variable(t token) (Expr, error) {
+	if !p.constructors[t.text] {
+		return Var{Name: t.text}, nil
+	}
+	if p.peek().text != "(" {
+		return Construct{Constructor: t.text}, nil
+	}
+	args, err := p.exprs()
+	if err != nil {
+		return nil, err
+	}
+	return Construct{Constructor: t.text, Args: args}, nil
+}
+
+func (p *parser) lambda() (Expr, error) {
+	vars, err := p.names()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return Lambda{Vars: vars, Body: body}, nil
+}
+
+func (p *parser) ifThenElse() (Expr, error) {
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("else"); err != nil {
+		return nil, err
+	}
+	els, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return If{Cond: cond, Then: then, Else: els}, nil
+}
+
+func (p *parser) handle() (Expr, error) {
+	var h Handle
+	h.Shallow = p.is("shallow")
+
+	eval, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	h.Eval = eval
+
+	if err := p.expect("with"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for {
+		if p.is("return") {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			x, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("->"); err != nil {
+				return nil, err
+			}
+			body, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			h.Return = &ReturnClause{Var: x, Body: body}
+		} else {
+			effect, err := p.effect()
+			if err != nil {
+				return nil, err
+			}
+			vars, err := p.names()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("->"); err != nil {
+				return nil, err
+			}
+			body, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			h.Handlers = append(h.Handlers, EffectHandler{Effect: effect, Vars: vars, Body: body})
+		}
+		if !p.is(";") {
+			break
+		}
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (p *parser) signal(t token) (Expr, error) {
+	effect, err := p.effect()
+	if err != nil {
+		return nil, err
+	}
+	args, err := p.exprs()
+	if err != nil {
+		return nil, err
+	}
+	return Signal{Effect: effect, Args: args, Pos: t.pos}, nil
+}
+
+func (p *parser) resume(t token) (Expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	with, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return Resume{With: with, Pos: t.pos}, nil
+}
+
+func (p *parser) match() (Expr, error) {
+	on, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var cases []Case
+	for {
+		c, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		var vars []string
+		if p.peek().text == "(" {
+			if vars, err = p.names(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("->"); err != nil {
+			return nil, err
+		}
+		body, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, Case{Constructor: c, Vars: vars, Body: body})
+		if !p.is(";") {
+			break
+		}
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return Match{On: on, Cases: cases}, nil
+}
+
+// letRec reads recursive bindings. At the top level, they may be declared without a body.
+func (p *parser) letRec(top bool) (Expr, error) {
+	var bindings []Binding
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		vars, err := p.names()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		body, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, Binding{Name: name, Fn: Lambda{Vars: vars, Body: body}})
+		if !p.is(";") {
+			break
+		}
+	}
+	if top && p.endOfDecl() {
+		return LetRec{Bindings: bindings}, nil
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	body, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return LetRec{Bindings: bindings, Body: body}, nil
+}
+
+// data declares its constructors for the rest of the expression. At the top level, it may be declared
+// without a body.
+func (p *parser) data(top bool) (Expr, error) {
+	var d Data
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	d.Name = name
+	if p.peek().text == "(" {
+		if d.Params, err = p.names(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	for {
+		c, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		ctor := Constructor{Name: c}
+		if p.peek().text == "(" {
+			if ctor.Fields, err = p.types(d.Params); err != nil {
+				return nil, err
+			}
+		}
+		d.Constructors = append(d.Constructors, ctor)
+		if !p.is("|") {
+			break
+		}
+	}
+	if top && p.endOfDecl() {
+		for _, c := range d.Constructors {
+			p.constructors[c.Name] = true
+		}
+		return d, nil
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+
+	outer := p.constructors
+	p.constructors = map[string]bool{}
+	for c := range outer {
+		p.constructors[c] = true
+	}
+	for _, c := range d.Constructors {
+		p.constructors[c.Name] = true
+	}
+	d.Body, err = p.expr()
+	p.constructors = outer
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// types reads a parenthesised list of types, in which params are type variables.
+func (p *parser) types(params []string) ([]Type, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var res []Type
+	for !p.is(")") {
+		if len(res) != 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		var t Type = TypeName{Name: name}
+		for _, x := range params {
+			if x == name {
+				t = TypeVar{Name: name}
+			}
+		}
+		if p.peek().text == "(" {
+			args, err := p.types(params)
+			if err != nil {
+				return nil, err
+			}
+			t = TypeName{Name: name, Args: args}
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
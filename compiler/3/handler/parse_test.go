@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestParse(t *testing.T) {
+	x, y := Var{Name: "x"}, Var{Name: "y"}
+
+	for _, test := range []struct {
+		name string
+		in   string
+		out  Expr
+	}{
+		{
+			name: "var",
+			in:   "x",
+			out:  x,
+		},
+		{
+			name: "negative",
+			in:   "-3",
+			out:  Int{Value: -3},
+		},
+		{
+			name: "precedence",
+			in:   "x + 2 * y - 1 < 3",
+			out: Prim{Op: prim.Lt, Args: []Expr{
+				Prim{Op: prim.Sub, Args: []Expr{
+					Prim{Op: prim.Add, Args: []Expr{x, Prim{Op: prim.Mul, Args: []Expr{Int{Value: 2}, y}}}},
+					Int{Value: 1},
+				}},
+				Int{Value: 3},
+			}},
+		},
+		{
+			name: "apply",
+			in:   "f(x)(y, true)",
+			out: Apply{
+				Fn:   Apply{Fn: Var{Name: "f"}, Args: []Expr{x}},
+				Args: []Expr{y, Bool{Value: true}},
+			},
+		},
+		{
+			name: "lambda",
+			in:   "fun(x, y) { cmp(x, y) }",
+			out:  Lambda{Vars: []string{"x", "y"}, Body: Prim{Op: prim.Cmp, Args: []Expr{x, y}}},
+		},
+		{
+			name: "if",
+			in:   "if x == 1 { 2 } else { 3 } // comment",
+			out: If{
+				Cond: Prim{Op: prim.Eq, Args: []Expr{x, Int{Value: 1}}},
+				Then: Int{Value: 2},
+				Else: Int{Value: 3},
+			},
+		},
+		{
+			name: "handle",
+			in:   "handle shallow {\n  signal get()\n} with {\n  get() -> resume(1);\n  return(x) -> x\n}",
+			out: Handle{
+				Eval: Signal{Effect: "get", Pos: Pos{Line: 2, Col: 3}},
+				Handlers: []EffectHandler{
+					{Effect: "get", Body: Resume{With: Int{Value: 1}, Pos: Pos{Line: 4, Col: 12}}},
+				},
+				Return:  &ReturnClause{Var: "x", Body: x},
+				Shallow: true,
+			},
+		},
+		{
+			name: "qualifiedEffect",
+			in:   "handle { signal console.print(1) } with { console.print(x) -> resume(x) }",
+			out: Handle{
+				Eval:     Signal{Effect: "console.print", Args: []Expr{Int{Value: 1}}, Pos: Pos{Line: 1, Col: 10}},
+				Handlers: []EffectHandler{{Effect: "console.print", Vars: []string{"x"}, Body: Resume{With: x, Pos: Pos{Line: 1, Col: 63}}}},
+			},
+		},
+		{
+			name: "data",
+			in:   "data list(a) = nil | cons(a, list(a)) in match cons(1, nil) { nil -> 0; cons(x, y) -> x }",
+			out: Data{
+				Name:   "list",
+				Params: []string{"a"},
+				Constructors: []Constructor{
+					{Name: "nil"},
+					{Name: "cons", Fields: []Type{TypeVar{Name: "a"}, TypeName{Name: "list", Args: []Type{TypeVar{Name: "a"}}}}},
+				},
+				Body: Match{
+					On: Construct{Constructor: "cons", Args: []Expr{Int{Value: 1}, Construct{Constructor: "nil"}}},
+					Cases: []Case{
+						{Constructor: "nil", Body: Int{Value: 0}},
+						{Constructor: "cons", Vars: []string{"x", "y"}, Body: x},
+					},
+				},
+			},
+		},
+		{
+			name: "letrec",
+			in:   "letrec f(x) = g(x); g(y) = y in f",
+			out: LetRec{
+				Bindings: []Binding{
+					{Name: "f", Fn: Lambda{Vars: []string{"x"}, Body: Apply{Fn: Var{Name: "g"}, Args: []Expr{x}}}},
+					{Name: "g", Fn: Lambda{Vars: []string{"y"}, Body: y}},
+				},
+				Body: Var{Name: "f"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Parse(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("got %#v, expecting %#v", out, test.out)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{
+			name: "unexpectedChar",
+			in:   "x + $",
+			err:  `1:5: syntax error: unexpected '$'`,
+		},
+		{
+			name: "unclosed",
+			in:   "f(x",
+			err:  `1:4: syntax error: unexpected end of input, expecting ","`,
+		},
+		{
+			name: "keywordName",
+			in:   "fun(if) { 1 }",
+			err:  `1:5: syntax error: unexpected "if", expecting a name`,
+		},
+		{
+			name: "trailing",
+			in:   "x y",
+			err:  `1:3: syntax error: unexpected "y"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.in)
+			if !errors.Is(err, errSyntax) || err.Error() != test.err {
+				t.Errorf("got %v, expecting %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseTopLevel(t *testing.T) {
+	opt := Data{Name: "opt", Constructors: []Constructor{{Name: "none"}, {Name: "some", Fields: []Type{TypeName{Name: "int"}}}}}
+
+	for _, test := range []struct {
+		name  string
+		in    string
+		decls []Expr
+		out   Expr
+	}{
+		{
+			name: "expr",
+			in:   "1 + 2",
+			out:  Prim{Op: prim.Add, Args: []Expr{Int{Value: 1}, Int{Value: 2}}},
+		},
+		{
+			name: "data",
+			in:   "data opt = none | some(int)",
+			out:  opt,
+		},
+		{
+			name: "letRec",
+			in:   "letrec id(x) = x",
+			out:  LetRec{Bindings: []Binding{{Name: "id", Fn: Lambda{Vars: []string{"x"}, Body: Var{Name: "x"}}}}},
+		},
+		{
+			name: "nestedNeedsBody",
+			in:   "letrec id(x) = letrec f(y) = y in f(x)",
+			out: LetRec{Bindings: []Binding{{Name: "id", Fn: Lambda{Vars: []string{"x"}, Body: LetRec{
+				Bindings: []Binding{{Name: "f", Fn: Lambda{Vars: []string{"y"}, Body: Var{Name: "y"}}}},
+				Body:     Apply{Fn: Var{Name: "f"}, Args: []Expr{Var{Name: "x"}}},
+			}}}}},
+		},
+		{
+			name:  "declaredConstructors",
+			in:    "some(1)",
+			decls: []Expr{opt},
+			out:   Construct{Constructor: "some", Args: []Expr{Int{Value: 1}}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ParseTopLevel(test.in, test.decls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("got %#v, expecting %#v", out, test.out)
+			}
+		})
+	}
+}
+
+func TestParseDecls(t *testing.T) {
+	out, err := ParseDecls("data opt = none | some(int)\nletrec f(x) = some(x)\ndata pair = pair(opt, opt)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := Data{Name: "opt", Constructors: []Constructor{{Name: "none"}, {Name: "some", Fields: []Type{TypeName{Name: "int"}}}}}
+	want := []Expr{
+		opt,
+		LetRec{Bindings: []Binding{{Name: "f", Fn: Lambda{Vars: []string{"x"}, Body: Construct{Constructor: "some", Args: []Expr{Var{Name: "x"}}}}}}},
+		Data{Name: "pair", Constructors: []Constructor{{Name: "pair", Fields: []Type{TypeName{Name: "opt"}, TypeName{Name: "opt"}}}}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %#v, expecting %#v", out, want)
+	}
+
+	if _, err := ParseDecls("data opt = none in none", nil); !errors.Is(err, errSyntax) || err.Error() != `1:17: syntax error: unexpected "in", expecting a declaration` {
+		t.Errorf("got %v, expecting a body to be rejected", err)
+	}
+}
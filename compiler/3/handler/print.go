@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+// Expressions print in the syntax that Parse reads. Blocks that do not fit comfortably on one line
+// are broken over several, indented to show their nesting.
+
+func (e Var) String() string       { return format(e, 0, precAny) }
+func (e Apply) String() string     { return format(e, 0, precAny) }
+func (e Lambda) String() string    { return format(e, 0, precAny) }
+func (e Handle) String() string    { return format(e, 0, precAny) }
+func (e Signal) String() string    { return format(e, 0, precAny) }
+func (e Resume) String() string    { return format(e, 0, precAny) }
+func (e Int) String() string       { return format(e, 0, precAny) }
+func (e Prim) String() string      { return format(e, 0, precAny) }
+func (e Bool) String() string      { return format(e, 0, precAny) }
+func (e If) String() string        { return format(e, 0, precAny) }
+func (e Data) String() string      { return format(e, 0, precAny) }
+func (e Construct) String() string { return format(e, 0, precAny) }
+func (e Match) String() string     { return format(e, 0, precAny) }
+func (e LetRec) String() string    { return format(e, 0, precAny) }
+
+func (t TypeVar) String() string {
+	return t.Name
+}
+
+func (t TypeName) String() string {
+	if len(t.Args) == 0 {
+		return t.Name
+	}
+	args := make([]string, len(t.Args))
+	for i, a := range t.Args {
+		args[i] = fmt.Sprint(a)
+	}
+	return fmt.Sprintf("%s(%s)", t.Name, strings.Join(args, ", "))
+}
+
+// Operator precedence, from loosest to tightest. Data declarations and recursive bindings extend as
+// far to the right as they can, so they bind loosest of all.
+const (
+	precAny = iota
+	precCompare
+	precAdd
+	precMul
+	precAtom
+)
+
+// Infix operators. Other primitives are written like calls.
+var infix = map[prim.Op]struct {
+	symbol string
+	prec   int
+}{
+	prim.Add: {"+", precAdd},
+	prim.Sub: {"-", precAdd},
+	prim.Mul: {"*", precMul},
+	prim.Eq:  {"==", precCompare},
+	prim.Lt:  {"<", precCompare},
+}
+
+const lineWidth = 40
+
+func indent(depth int) string {
+	return strings.Repeat("    ", depth)
+}
+
+// block puts braces around a body that has been formatted at depth+1, keeping it on one line if it
+// is short enough.
+func block(body string, depth int) string {
+	if !strings.Contains(body, "\n") && len(body) <= lineWidth {
+		return fmt.Sprintf("{ %s }", body)
+	}
+	return fmt.Sprintf("{\n%s%s\n%s}", indent(depth+1), body, indent(depth))
+}
+
+// lines puts braces around items that have been formatted at depth+1, one per line.
+func lines(items []string, depth int) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	for i, x := range items {
+		b.WriteString(indent(depth + 1))
+		b.WriteString(x)
+		if i < len(items)-1 {
+			b.WriteString(";")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(indent(depth))
+	b.WriteString("}")
+	return b.String()
+}
+
+func paren(s string, prec, min int) string {
+	if prec < min {
+		return fmt.Sprintf("(%s)", s)
+	}
+	return s
+}
+
+func formatAll(es []Expr, depth int) string {
+	strs := make([]string, len(es))
+	for i, e := range es {
+		strs[i] = format(e, depth, precAny)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// format writes e at the given depth of indentation, within a context that needs an expression of
+// at least precedence min.
+func format(e Expr, depth, min int) string {
+	switch e := e.(type) {
+	case Var:
+		return e.Name
+
+	case Int:
+		return fmt.Sprint(e.Value)
+
+	case Bool:
+		return fmt.Sprint(e.Value)
+
+	case Apply:
+		fn := format(e.Fn, depth, precAny)
+		if _, ok := e.Fn.(Var); !ok {
+			fn = fmt.Sprintf("(%s)", fn)
+		}
+		return fmt.Sprintf("%s(%s)", fn, formatAll(e.Args, depth))
+
+	case Lambda:
+		return fmt.Sprintf("fun(%s) %s", strings.Join(e.Vars, ", "), block(format(e.Body, depth+1, precAny), depth))
+
+	case Prim:
+		op, ok := infix[e.Op]
+		if !ok || len(e.Args) != 2 {
+			return fmt.Sprintf("%s(%s)", e.Op, formatAll(e.Args, depth))
+		}
+		// The left operand may be another operation of the same precedence, as these associate
+		// to the left, but the right may not. Comparisons do not associate at all.
+		left := op.prec
+		if op.prec == precCompare {
+			left++
+		}
+		s := fmt.Sprintf("%s %s %s", format(e.Args[0], depth, left), op.symbol, format(e.Args[1], depth, op.prec+1))
+		return paren(s, op.prec, min)
+
+	case If:
+		return fmt.Sprintf(
+			"if %s %s else %s",
+			format(e.Cond, depth, precAny),
+			block(format(e.Then, depth+1, precAny), depth),
+			block(format(e.Else, depth+1, precAny), depth),
+		)
+
+	case Signal:
+		return fmt.Sprintf("signal %s(%s)", e.Effect, formatAll(e.Args, depth))
+
+	case Resume:
+		return fmt.Sprintf("resume(%s)", format(e.With, depth, precAny))
+
+	case Handle:
+		var clauses []string
+		for _, h := range e.Handlers {
+			clauses = append(clauses, fmt.Sprintf(
+				"%s(%s) -> %s",
+				h.Effect, strings.Join(h.Vars, ", "), format(h.Body, depth+1, precAny),
+			))
+		}
+		if e.Return != nil {
+			clauses = append(clauses, fmt.Sprintf("return(%s) -> %s", e.Return.Var, format(e.Return.Body, depth+1, precAny)))
+		}
+		kw := "handle"
+		if e.Shallow {
+			kw = "handle shallow"
+		}
+		return fmt.Sprintf("%s %s with %s", kw, block(format(e.Eval, depth+1, precAny), depth), lines(clauses, depth))
+
+	case Data:
+		ctors := make([]string, len(e.Constructors))
+		for i, c := range e.Constructors {
+			ctors[i] = c.Name
+			if len(c.Fields) != 0 {
+				fields := make([]string, len(c.Fields))
+				for j, f := range c.Fields {
+					fields[j] = fmt.Sprint(f)
+				}
+				ctors[i] = fmt.Sprintf("%s(%s)", c.Name, strings.Join(fields, ", "))
+			}
+		}
+		name := e.Name
+		if len(e.Params) != 0 {
+			name = fmt.Sprintf("%s(%s)", e.Name, strings.Join(e.Params, ", "))
+		}
+		s := fmt.Sprintf(
+			"data %s = %s\n%sin %s",
+			name, strings.Join(ctors, " | "), indent(depth), format(e.Body, depth, precAny),
+		)
+		return paren(s, precAny, min)
+
+	case Construct:
+		if len(e.Args) == 0 {
+			return e.Constructor
+		}
+		return fmt.Sprintf("%s(%s)", e.Constructor, formatAll(e.Args, depth))
+
+	case Match:
+		cases := make([]string, len(e.Cases))
+		for i, c := range e.Cases {
+			pat := c.Constructor
+			if len(c.Vars) != 0 {
+				pat = fmt.Sprintf("%s(%s)", c.Constructor, strings.Join(c.Vars, ", "))
+			}
+			cases[i] = fmt.Sprintf("%s -> %s", pat, format(c.Body, depth+1, precAny))
+		}
+		return fmt.Sprintf("match %s %s", format(e.On, depth, precAny), lines(cases, depth))
+
+	case LetRec:
+		var b strings.Builder
+		b.WriteString("letrec\n")
+		for i, x := range e.Bindings {
+			b.WriteString(indent(depth + 1))
+			fmt.Fprintf(&b, "%s(%s) = %s", x.Name, strings.Join(x.Fn.Vars, ", "), format(x.Fn.Body, depth+1, precAny))
+			if i < len(e.Bindings)-1 {
+				b.WriteString(";")
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%sin %s", indent(depth), format(e.Body, depth, precAny))
+		return paren(b.String(), precAny, min)
+	}
+
+	return fmt.Sprintf("%#v", e)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestString(t *testing.T) {
+	x, y := Var{Name: "x"}, Var{Name: "y"}
+
+	for _, test := range []struct {
+		name string
+		in   Expr
+		out  string
+	}{
+		{
+			name: "associativity",
+			in: Prim{Op: prim.Sub, Args: []Expr{
+				Prim{Op: prim.Sub, Args: []Expr{x, y}},
+				Prim{Op: prim.Sub, Args: []Expr{x, y}},
+			}},
+			out: "x - y - (x - y)",
+		},
+		{
+			name: "precedence",
+			in: Prim{Op: prim.Mul, Args: []Expr{
+				Prim{Op: prim.Add, Args: []Expr{x, Int{Value: 1}}},
+				Prim{Op: prim.Cmp, Args: []Expr{x, Int{Value: -1}}},
+			}},
+			out: "(x + 1) * cmp(x, -1)",
+		},
+		{
+			name: "shortLambda",
+			in:   Apply{Fn: Lambda{Vars: []string{"x"}, Body: x}, Args: []Expr{Int{Value: 1}}},
+			out:  "(fun(x) { x })(1)",
+		},
+		{
+			name: "handle",
+			in: Handle{
+				Eval: Signal{Effect: "get"},
+				Handlers: []EffectHandler{
+					{Effect: "get", Body: Resume{With: Int{Value: 1}}},
+				},
+				Return: &ReturnClause{Var: "x", Body: If{Cond: Bool{Value: true}, Then: x, Else: Int{Value: 0}}},
+			},
+			out: "handle { signal get() } with {\n" +
+				"    get() -> resume(1);\n" +
+				"    return(x) -> if true { x } else { 0 }\n" +
+				"}",
+		},
+		{
+			name: "nested",
+			in: Lambda{Vars: []string{"o"}, Body: Match{On: Var{Name: "o"}, Cases: []Case{
+				{Constructor: "none", Body: Int{Value: 0}},
+				{Constructor: "some", Vars: []string{"x"}, Body: x},
+			}}},
+			out: "fun(o) {\n" +
+				"    match o {\n" +
+				"        none -> 0;\n" +
+				"        some(x) -> x\n" +
+				"    }\n" +
+				"}",
+		},
+		{
+			name: "letRecOperand",
+			in: Prim{Op: prim.Add, Args: []Expr{
+				LetRec{Bindings: []Binding{{Name: "f", Fn: Lambda{Body: Int{Value: 1}}}}, Body: Var{Name: "f"}},
+				Int{Value: 1},
+			}},
+			out: "(letrec\n" +
+				"    f() = 1\n" +
+				"in f) + 1",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out := fmt.Sprint(test.in)
+			if out != test.out {
+				t.Errorf("got\n%s\nexpecting\n%s", out, test.out)
+			}
+		})
+	}
+}
+
+// Parsing what has been printed gives the expression back.
+func TestRoundTrip(t *testing.T) {
+	for _, in := range []Expr{
+		Prim{Op: prim.Lt, Args: []Expr{
+			Prim{Op: prim.Sub, Args: []Expr{Int{Value: 1}, Prim{Op: prim.Add, Args: []Expr{Int{Value: 2}, Int{Value: -3}}}}},
+			Prim{Op: prim.Mul, Args: []Expr{Int{Value: 4}, Prim{Op: prim.Mul, Args: []Expr{Int{Value: 5}, Int{Value: 6}}}}},
+		}},
+		Apply{
+			Fn:   If{Cond: Bool{Value: false}, Then: Var{Name: "f"}, Else: Lambda{Vars: []string{"x"}, Body: Var{Name: "x"}}},
+			Args: []Expr{LetRec{Bindings: []Binding{{Name: "g", Fn: Lambda{Body: Int{Value: 1}}}}, Body: Var{Name: "g"}}},
+		},
+		Data{
+			Name: "box",
+			Constructors: []Constructor{
+				{Name: "box", Fields: []Type{TypeName{Name: "int"}}},
+			},
+			Body: Handle{
+				Eval: Prim{Op: prim.Add, Args: []Expr{
+					Data{Name: "unit", Constructors: []Constructor{{Name: "unit"}}, Body: Int{Value: 1}},
+					Int{Value: 2},
+				}},
+				Handlers: []EffectHandler{
+					{Effect: "put", Vars: []string{"a", "b"}, Body: Construct{Constructor: "box", Args: []Expr{Var{Name: "a"}}}},
+				},
+				Shallow: true,
+			},
+		},
+	} {
+		s := fmt.Sprint(in)
+		out, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s\n%v", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Errorf("got %#v, expecting %#v", out, in)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package handler
+
+// MarkPure returns a copy of e in which the functions that can never signal an effect are marked as
+// pure, along with the applications that only ever call such functions. Functions that install
+// handlers, resume or call functions from outside of the program are not pure.
+//
+// A function is only marked as pure when every application that may call it is as well, so that
+// they agree on how the call is made. Functions that escape the program are never pure.
+func MarkPure(e Expr) Expr {
+	// Functions and applications are numbered, so that what the analysis finds out about each of
+	// them can be attached to it afterwards.
+	n := 0
+	e = rewrite(e, func(f Lambda) Lambda {
+		n++
+		f.id = n
+		return f
+	}, func(c Apply) Apply {
+		n++
+		c.id = n
+		return c
+	})
+
+	a := newAnalysis()
+	val, _ := a.walk(e, flowScope{})
+	val.escape()
+
+	pure := map[*function]bool{}
+	for _, f := range a.functions {
+		pure[f] = !f.escaped && !f.effects.unknown && len(f.effects.effects) == 0
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, c := range a.calls {
+			if c.pure(pure) {
+				continue
+			}
+			for f := range c.fn.fns {
+				if pure[f] {
+					pure[f] = false
+					changed = true
+				}
+			}
+		}
+	}
+
+	pureFns := map[int]bool{}
+	for _, f := range a.functions {
+		pureFns[f.id] = pure[f]
+	}
+	pureCalls := map[int]bool{}
+	for _, c := range a.calls {
+		pureCalls[c.id] = c.pure(pure)
+	}
+	return rewrite(e, func(f Lambda) Lambda {
+		f.Pure, f.id = pureFns[f.id], 0
+		return f
+	}, func(c Apply) Apply {
+		c.Pure, c.id = pureCalls[c.id], 0
+		return c
+	})
+}
+
+func (c *call) pure(pure map[*function]bool) bool {
+	if c.fn.unknown || len(c.fn.fns) == 0 {
+		return false
+	}
+	for f := range c.fn.fns {
+		if !pure[f] {
+			return false
+		}
+	}
+	return true
+}
+
+// rewrite returns a copy of e with fn applied to each function and app to each application.
+func rewrite(e Expr, fn func(Lambda) Lambda, app func(Apply) Apply) Expr {
+	r := rewriter{fn: fn, app: app}
+	return r.rewrite(e)
+}
+
+type rewriter struct {
+	fn  func(Lambda) Lambda
+	app func(Apply) Apply
+}
+
+func (r rewriter) rewrite(e Expr) Expr {
+	switch e := e.(type) {
+	case Lambda:
+		return r.rewriteFn(e)
+
+	case Apply:
+		e.Fn = r.rewrite(e.Fn)
+		e.Args = r.rewriteAll(e.Args)
+		return r.app(e)
+
+	case Handle:
+		e.Eval = r.rewrite(e.Eval)
+		if e.Return != nil {
+			ret := *e.Return
+			ret.Body = r.rewrite(ret.Body)
+			e.Return = &ret
+		}
+		handlers := make([]EffectHandler, len(e.Handlers))
+		for i, h := range e.Handlers {
+			h.Body = r.rewrite(h.Body)
+			handlers[i] = h
+		}
+		e.Handlers = handlers
+		return e
+
+	case Signal:
+		e.Args = r.rewriteAll(e.Args)
+		return e
+
+	case Resume:
+		e.With = r.rewrite(e.With)
+		return e
+
+	case Prim:
+		e.Args = r.rewriteAll(e.Args)
+		return e
+
+	case If:
+		e.Cond = r.rewrite(e.Cond)
+		e.Then = r.rewrite(e.Then)
+		e.Else = r.rewrite(e.Else)
+		return e
+
+	case Data:
+		e.Body = r.rewrite(e.Body)
+		return e
+
+	case Construct:
+		e.Args = r.rewriteAll(e.Args)
+		return e
+
+	case Match:
+		e.On = r.rewrite(e.On)
+		cases := make([]Case, len(e.Cases))
+		for i, c := range e.Cases {
+			c.Body = r.rewrite(c.Body)
+			cases[i] = c
+		}
+		e.Cases = cases
+		return e
+
+	case LetRec:
+		bindings := make([]Binding, len(e.Bindings))
+		for i, b := range e.Bindings {
+			b.Fn = r.rewriteFn(b.Fn)
+			bindings[i] = b
+		}
+		e.Bindings = bindings
+		e.Body = r.rewrite(e.Body)
+		return e
+	}
+
+	return e
+}
+
+func (r rewriter) rewriteFn(e Lambda) Lambda {
+	e.Body = r.rewrite(e.Body)
+	return r.fn(e)
+}
+
+func (r rewriter) rewriteAll(es []Expr) []Expr {
+	res := make([]Expr, len(es))
+	for i, e := range es {
+		res[i] = r.rewrite(e)
+	}
+	return res
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestMarkPure(t *testing.T) {
+	get := Signal{Effect: "get"}
+	call := func(name string, args ...Expr) Expr {
+		return Apply{Fn: Var{Name: name}, Args: args}
+	}
+	fn := func(name string, body Expr, vars ...string) Binding {
+		return Binding{Name: name, Fn: Lambda{Vars: vars, Body: body}}
+	}
+	inc := fn("inc", Prim{Op: prim.Add, Args: []Expr{Var{Name: "x"}, Int{Value: 1}}}, "x")
+
+	for _, test := range []struct {
+		name     string
+		bindings []Binding
+		body     Expr
+		out      []bool
+	}{
+		{
+			name:     "pure",
+			bindings: []Binding{inc},
+			body:     call("inc", Int{Value: 1}),
+			out:      []bool{true},
+		},
+		{
+			name:     "signals",
+			bindings: []Binding{fn("next", get)},
+			body:     call("next"),
+			out:      []bool{false},
+		},
+		{
+			name:     "callsSignaller",
+			bindings: []Binding{fn("next", get), fn("twice", call("next"))},
+			body:     call("twice"),
+			out:      []bool{false, false},
+		},
+		{
+			name:     "escapes",
+			bindings: []Binding{inc},
+			body:     Var{Name: "inc"},
+			out:      []bool{false},
+		},
+		{
+			name:     "callsOut",
+			bindings: []Binding{fn("f", call("g"))},
+			body:     call("f"),
+			out:      []bool{false},
+		},
+		{
+			name: "handles",
+			bindings: []Binding{fn("f", Handle{
+				Eval:     get,
+				Handlers: []EffectHandler{{Effect: "get", Body: Int{Value: 1}}},
+			})},
+			body: call("f"),
+			out:  []bool{false},
+		},
+		{
+			name:     "sharesCall",
+			bindings: []Binding{inc, fn("next", get, "x"), fn("apply", call("f", Int{Value: 1}), "f")},
+			body: Prim{Op: prim.Add, Args: []Expr{
+				call("apply", Var{Name: "inc"}),
+				call("apply", Var{Name: "next"}),
+			}},
+			out: []bool{false, false, false},
+		},
+		{
+			name:     "pureHigherOrder",
+			bindings: []Binding{inc, fn("apply", call("f", Int{Value: 1}), "f")},
+			body:     call("apply", Var{Name: "inc"}),
+			out:      []bool{true, true},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			marked := MarkPure(LetRec{Bindings: test.bindings, Body: test.body}).(LetRec)
+			var out []bool
+			for _, b := range marked.Bindings {
+				out = append(out, b.Fn.Pure)
+			}
+			if !reflect.DeepEqual(out, test.out) {
+				t.Errorf("got %v, expecting %v", out, test.out)
+			}
+		})
+	}
+}
+
+func TestMarkPureCalls(t *testing.T) {
+	in := LetRec{
+		Bindings: []Binding{{Name: "id", Fn: Lambda{Vars: []string{"x"}, Body: Var{Name: "x"}}}},
+		Body: Apply{
+			Fn:   Var{Name: "f"},
+			Args: []Expr{Apply{Fn: Var{Name: "id"}, Args: []Expr{Int{Value: 1}}}},
+		},
+	}
+	out := MarkPure(in).(LetRec)
+	outer := out.Body.(Apply)
+	if outer.Pure {
+		t.Error("call to unknown function marked as pure")
+	}
+	if !outer.Args[0].(Apply).Pure {
+		t.Error("call to pure function not marked as pure")
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+// Size counts the nodes in e.
+func Size(e Expr) int {
+	switch e := e.(type) {
+	case Var, Int, Bool:
+		return 1
+
+	case Apply:
+		return 1 + Size(e.Fn) + sizeAll(e.Args)
+
+	case Lambda:
+		return 1 + Size(e.Body)
+
+	case Handle:
+		n := 1 + Size(e.Eval)
+		for _, h := range e.Handlers {
+			n += Size(h.Body)
+		}
+		if e.Return != nil {
+			n += Size(e.Return.Body)
+		}
+		return n
+
+	case Signal:
+		return 1 + sizeAll(e.Args)
+
+	case Resume:
+		return 1 + Size(e.With)
+
+	case Prim:
+		return 1 + sizeAll(e.Args)
+
+	case If:
+		return 1 + Size(e.Cond) + Size(e.Then) + Size(e.Else)
+
+	case Data:
+		return 1 + Size(e.Body)
+
+	case Construct:
+		return 1 + sizeAll(e.Args)
+
+	case Match:
+		n := 1 + Size(e.On)
+		for _, c := range e.Cases {
+			n += Size(c.Body)
+		}
+		return n
+
+	case LetRec:
+		n := 1 + Size(e.Body)
+		for _, b := range e.Bindings {
+			n += Size(b.Fn)
+		}
+		return n
+	}
+
+	panic("unreachable")
+}
+
+func sizeAll(es []Expr) int {
+	n := 0
+	for _, e := range es {
+		n += Size(e)
+	}
+	return n
+}
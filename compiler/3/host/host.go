@@ -0,0 +1,180 @@
+// Running programs from Go, with Go functions handling the effects that programs leave unhandled.
+// This is how a program is given access to the world outside of it: a service registers handlers for
+// the effects that it wishes to expose, and any program that signals them without handling them
+// itself has them handled by the service.
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bobappleyard/goose/b2c"
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/c2l"
+	"github.com/bobappleyard/goose/cont"
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/h2c"
+	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/l2b"
+	"github.com/bobappleyard/goose/lc"
+	"github.com/bobappleyard/goose/lib"
+	"github.com/bobappleyard/goose/pass"
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errNoHandler = errors.New("no handler for effect")
+
+// Handler handles an effect signalled with args, returning the value that the program is resumed
+// with.
+type Handler func(args []prim.Value) (prim.Value, error)
+
+// Host maps the names of effects to the handlers for them.
+type Host struct {
+	handlers map[string]Handler
+}
+
+func New() *Host {
+	return &Host{handlers: map[string]Handler{}}
+}
+
+// Register makes fn the handler for effect, replacing any handler that it already has.
+func (h *Host) Register(effect string, fn Handler) {
+	h.handlers[effect] = fn
+}
+
+// Effects lists the effects that h has handlers for, in order.
+func (h *Host) Effects() []string {
+	effects := make([]string, 0, len(h.handlers))
+	for e := range h.handlers {
+		effects = append(effects, e)
+	}
+	sort.Strings(effects)
+	return effects
+}
+
+// Handle calls the handler for effect.
+func (h *Host) Handle(effect string, args []prim.Value) (prim.Value, error) {
+	fn, ok := h.handlers[effect]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errNoHandler, effect)
+	}
+	return fn(args)
+}
+
+// Run compiles src and runs it on the bytecode virtual machine, with h handling any effects that it
+// does not handle itself, apart from those of the runtime's scheduler.
+func (h *Host) Run(src string) (prim.Value, error) {
+	p, err := Compile(src, append(h.Effects(), cps.Concurrency...)...)
+	if err != nil {
+		return nil, err
+	}
+	return bc.EvalHost(p, h)
+}
+
+// Compile compiles src to bytecode, with the generators of lib.Generators in scope. It may signal the
+// effects named without handling them, but no others.
+func Compile(src string, effects ...string) (bc.Program, error) {
+	e, err := lib.Parse(src, lib.Generators)
+	if err != nil {
+		return bc.Program{}, err
+	}
+	return compile(e, pipeline(false), effects)
+}
+
+// CompileExpr compiles e to bytecode, as Compile does with what it parses.
+func CompileExpr(e handler.Expr, effects ...string) (bc.Program, error) {
+	return compile(e, pipeline(false), effects)
+}
+
+// CompileForDebugger compiles src as Compile does, except that every signal looks its clause up in
+// the handler object, where the debugger's effect breakpoints see it.
+func CompileForDebugger(src string, effects ...string) (bc.Program, error) {
+	e, err := lib.Parse(src, lib.Generators)
+	if err != nil {
+		return bc.Program{}, err
+	}
+	return compile(e, pipeline(true), effects)
+}
+
+func compile(e handler.Expr, m *pass.Manager, effects []string) (bc.Program, error) {
+	if errs := handler.Check(e, effects...); len(errs) != 0 {
+		return bc.Program{}, errs[0]
+	}
+	if _, err := handler.Infer(e); err != nil {
+		return bc.Program{}, err
+	}
+	m.StopAfter = "l2b"
+	ir, err := m.Run(e)
+	if err != nil {
+		return bc.Program{}, err
+	}
+	return ir.(bc.Program), nil
+}
+
+// Pipeline registers the passes that take a checked program to C.
+func Pipeline() *pass.Manager {
+	return pipeline(false)
+}
+
+// pipeline registers the passes of Pipeline, converting the program for the debugger if debug is set.
+func pipeline(debug bool) *pass.Manager {
+	m := &pass.Manager{}
+	m.Register("h2c", func(ir interface{}) (interface{}, error) {
+		if debug {
+			return h2c.ConvertExprForDebugger(ir.(handler.Expr))
+		}
+		return h2c.ConvertExpr(ir.(handler.Expr), false)
+	})
+	m.Register("c2l", func(ir interface{}) (interface{}, error) {
+		return c2l.ConvertExpr(ir.(cont.Expr))
+	})
+	m.RegisterOptional("reduce", func(ir interface{}) (interface{}, error) {
+		return lc.Reduce(ir.(lc.Expr)), nil
+	})
+	m.Register("l2b", func(ir interface{}) (interface{}, error) {
+		return l2b.ConvertProgram(ir.(lc.Expr)), nil
+	})
+	m.Register("b2c", func(ir interface{}) (interface{}, error) {
+		var b strings.Builder
+		if err := b2c.ConvertProgram(ir.(bc.Program), &b); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	})
+	return m
+}
+
+// Print handles console.print, writing its arguments to w on a line, separated by spaces. There is
+// no unit value, so the program is resumed with 0.
+func Print(w io.Writer) Handler {
+	return func(args []prim.Value) (prim.Value, error) {
+		strs := make([]string, len(args))
+		for i, a := range args {
+			strs[i] = a.String()
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(strs, " ")); err != nil {
+			return nil, err
+		}
+		return prim.Int(0), nil
+	}
+}
+
+// Now handles time.now, resuming the program with the time given by clock, in milliseconds since
+// the Unix epoch.
+func Now(clock func() time.Time) Handler {
+	return func(args []prim.Value) (prim.Value, error) {
+		return prim.Int(clock().UnixMilli()), nil
+	}
+}
+
+// Standard gives a host that handles console.print by writing to w, and time.now with clock.
+func Standard(w io.Writer, clock func() time.Time) *Host {
+	h := New()
+	h.Register("console.print", Print(w))
+	h.Register("time.now", Now(clock))
+	return h
+}
@@ -0,0 +1,232 @@
+package host
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestRun(t *testing.T) {
+	var out strings.Builder
+	h := Standard(&out, func() time.Time { return time.UnixMilli(1000) })
+	h.Register("double", func(args []prim.Value) (prim.Value, error) {
+		return args[0].(prim.Int) * 2, nil
+	})
+
+	v, err := h.Run(`
+		letrec show(n) = signal console.print(n, signal double(n)) in
+		handle {
+			show(1) + show(signal time.now()) + signal double(signal ask())
+		} with {
+			ask() -> resume(21)
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != prim.Int(42) {
+		t.Errorf("got %s, expecting 42", v)
+	}
+	if want := "1 2\n1000 2000\n"; out.String() != want {
+		t.Errorf("got %q, expecting %q", out.String(), want)
+	}
+}
+
+func TestRunGenerators(t *testing.T) {
+	v, err := New().Run(`
+		letrec sum(l) = match l { nil -> 0; cons(x, rest) -> x + sum(rest) } in
+		sum(toList(take(3, filter(fun(x) { 10 < x }, count(0)))))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != prim.Int(36) {
+		t.Errorf("got %s, expecting 36", v)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	h := New()
+	if _, err := h.Run("signal console.print(1)"); err == nil || err.Error() != "1:1: unhandled effect: console.print" {
+		t.Errorf("got %v, expecting console.print to be unhandled", err)
+	}
+	if _, err := h.Run("(fun(x) { x + 1 })(true)"); err == nil || err.Error() != "type mismatch: int and bool" {
+		t.Errorf("got %v, expecting a type error", err)
+	}
+	if _, err := h.Handle("time.now", nil); !errors.Is(err, errNoHandler) {
+		t.Errorf("got %v, expecting %v", err, errNoHandler)
+	}
+}
+
+// TestSuspend has the host suspend the program whenever it is asked for a number, answering only
+// once the program has been resumed.
+func TestSuspend(t *testing.T) {
+	n, suspend := 0, true
+	h := New()
+	h.Register("ask", func(args []prim.Value) (prim.Value, error) {
+		if suspend {
+			suspend = false
+			return nil, cps.ErrSuspend
+		}
+		n++
+		suspend = true
+		return prim.Int(n), nil
+	})
+	p, err := Compile("signal ask() * 10 + signal ask()", h.Effects()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, data, err := bc.Run(p, h)
+	suspended := 0
+	for err == nil && data != nil {
+		suspended++
+		v, data, err = bc.Resume(p, data, h)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != prim.Int(12) || suspended != 2 {
+		t.Errorf("got %s after %d suspensions, expecting 12 after 2", v, suspended)
+	}
+
+	other, err := Compile("signal ask()", h.Effects()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err = bc.Run(p, h); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := bc.Resume(other, data, h); err == nil {
+		t.Error("expecting a different program not to be resumed")
+	}
+}
+
+// TestSuspendScheduler suspends a program once it has made a channel and a thread has finished,
+// checking that they are still there when it is resumed and that new ids do not clash with theirs.
+func TestSuspendScheduler(t *testing.T) {
+	suspend := true
+	h := New()
+	h.Register("ask", func(args []prim.Value) (prim.Value, error) {
+		if suspend {
+			suspend = false
+			return nil, cps.ErrSuspend
+		}
+		return prim.Int(0), nil
+	})
+	p, err := Compile(`
+		(fun(c, t) {
+			signal thread.send(c, 5) + signal thread.await(t) + signal ask() +
+			signal thread.recv(c) * 10 + signal thread.await(t) * 100 + signal thread.channel() * 1000
+		})(signal thread.channel(), signal thread.fork(fun() { 1 }))
+	`, append(h.Effects(), cps.Concurrency...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, data, err := bc.Run(p, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data == nil {
+		t.Fatal("expecting the program to be suspended")
+	}
+	v, _, err := bc.Resume(p, data, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != prim.Int(3151) {
+		t.Errorf("got %s, expecting 3151", v)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		out  prim.Value
+	}{
+		{
+			name: "await",
+			in: `
+				letrec sum(n) = if n == 0 { 0 } else { n + sum(n - 1) } in
+				(fun(a, b) { signal thread.await(a) + signal thread.await(b) })(
+					signal thread.fork(fun() { sum(10) }),
+					signal thread.fork(fun() { sum(100) })
+				)
+			`,
+			out: prim.Int(5105),
+		},
+		{
+			name: "channel",
+			in: `
+				letrec
+					produce(c, n) = if n == 0 { 0 } else { signal thread.send(c, n) + signal thread.yield() + produce(c, n - 1) };
+					consume(c, n) = if n == 0 { 0 } else { signal thread.recv(c) + consume(c, n - 1) }
+				in
+				(fun(c) {
+					(fun(t) { consume(c, 10) })(signal thread.fork(fun() { produce(c, 10) }))
+				})(signal thread.channel())
+			`,
+			out: prim.Int(55),
+		},
+		{
+			name: "interleaving",
+			in: `
+				letrec
+					run(c, id, n) = if n == 0 { 0 } else { signal thread.send(c, id) + signal thread.yield() + run(c, id, n - 1) };
+					collect(c, acc, n) = if n == 0 { acc } else { collect(c, acc * 10 + signal thread.recv(c), n - 1) }
+				in
+				(fun(c) {
+					(fun(a, b) { collect(c, 0, 6) })(
+						signal thread.fork(fun() { run(c, 1, 3) }),
+						signal thread.fork(fun() { run(c, 2, 3) })
+					)
+				})(signal thread.channel())
+			`,
+			out: prim.Int(121212),
+		},
+		{
+			name: "manyThreads",
+			in: `
+				letrec spawn(n) = if n == 0 { 0 } else {
+					(fun(t) { spawn(n - 1) + signal thread.await(t) })(signal thread.fork(fun() { n }))
+				} in spawn(1000)
+			`,
+			out: prim.Int(500500),
+		},
+		{
+			name: "handlersPerThread",
+			in: `
+				letrec work(n) = handle { n + signal ask() } with { ask() -> 2 * resume(signal thread.yield() + n) } in
+				(fun(a, b) { signal thread.await(a) * 1000 + signal thread.await(b) })(
+					signal thread.fork(fun() { work(1) }),
+					signal thread.fork(fun() { work(10) })
+				)
+			`,
+			out: prim.Int(4040),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := New().Run(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.out {
+				t.Errorf("got %s, expecting %s", out, test.out)
+			}
+		})
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	_, err := New().Run("signal thread.recv(signal thread.channel())")
+	if err == nil || err.Error() != "deadlock: every thread is blocked" {
+		t.Errorf("got %v, expecting deadlock", err)
+	}
+}
@@ -0,0 +1,262 @@
+// JSON encoding for the intermediate representations.
+//
+// Nodes are written as objects with a "kind" member naming the type of the node, followed by their
+// fields, so that the values of the sealed interfaces used for expressions can be read back. Kinds
+// and field names are the names of the Go types and fields, starting with a lower case letter. Fields
+// that are false, nil or empty are left out, and read back as such.
+package irjson
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var errUnknownKind = errors.New("unknown kind")
+var errUnknownField = errors.New("unknown field")
+var errWrongKind = errors.New("wrong kind")
+
+// Codec encodes and decodes the nodes of one intermediate representation.
+type Codec struct {
+	kinds map[reflect.Type]string
+	types map[string]reflect.Type
+}
+
+// NewCodec creates a codec for the node types given by example.
+func NewCodec(nodes ...interface{}) *Codec {
+	c := &Codec{kinds: map[reflect.Type]string{}, types: map[string]reflect.Type{}}
+	for _, n := range nodes {
+		t := reflect.TypeOf(n)
+		kind := lowerFirst(t.Name())
+		c.kinds[t] = kind
+		c.types[kind] = t
+	}
+	return c
+}
+
+// Marshal encodes v, which is a node or contains nodes.
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := c.encode(&b, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal decodes data into the value that v points to, which may be an interface implemented by
+// the nodes of the codec.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	p := reflect.ValueOf(v)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		return fmt.Errorf("irjson: expecting a pointer, got %T", v)
+	}
+	return c.decode(data, p.Elem())
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+func (c *Codec) encode(b *bytes.Buffer, v reflect.Value) error {
+	if v.Type().Implements(textMarshaler) {
+		return encodeJSON(b, v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("null")
+			return nil
+		}
+		return c.encode(b, v.Elem())
+
+	case reflect.Slice:
+		if v.IsNil() {
+			b.WriteString("null")
+			return nil
+		}
+		b.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i != 0 {
+				b.WriteString(",")
+			}
+			if err := c.encode(b, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		b.WriteString("]")
+		return nil
+
+	case reflect.Struct:
+		return c.encodeStruct(b, v)
+	}
+
+	return encodeJSON(b, v.Interface())
+}
+
+func (c *Codec) encodeStruct(b *bytes.Buffer, v reflect.Value) error {
+	b.WriteString("{")
+	first := true
+	if kind, ok := c.kinds[v.Type()]; ok {
+		fmt.Fprintf(b, `"kind":%q`, kind)
+		first = false
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := v.Type().Field(i), v.Field(i)
+		if f.PkgPath != "" || omit(fv) {
+			continue
+		}
+		if !first {
+			b.WriteString(",")
+		}
+		first = false
+		fmt.Fprintf(b, "%q:", lowerFirst(f.Name))
+		if err := c.encode(b, fv); err != nil {
+			return err
+		}
+	}
+	b.WriteString("}")
+	return nil
+}
+
+// omit reports whether a field is left out of the encoding.
+func omit(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Interface, reflect.Ptr, reflect.Slice:
+		return v.IsNil()
+	case reflect.Struct:
+		return v.IsZero()
+	}
+	return false
+}
+
+func encodeJSON(b *bytes.Buffer, v interface{}) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b.Write(bs)
+	return nil
+}
+
+func (c *Codec) decode(data []byte, v reflect.Value) error {
+	if reflect.PtrTo(v.Type()).Implements(textMarshaler) {
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+
+	null := bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		var node struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		t, ok := c.types[node.Kind]
+		if !ok || !t.Implements(v.Type()) {
+			return fmt.Errorf("%w: %q", errUnknownKind, node.Kind)
+		}
+		n := reflect.New(t).Elem()
+		if err := c.decode(data, n); err != nil {
+			return err
+		}
+		v.Set(n)
+		return nil
+
+	case reflect.Ptr:
+		if null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := c.decode(data, p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+
+	case reflect.Slice:
+		if null {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := c.decode(item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+
+	case reflect.Struct:
+		return c.decodeStruct(data, v)
+	}
+
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+func (c *Codec) decodeStruct(data []byte, v reflect.Value) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	if kind, ok := members["kind"]; ok {
+		var name string
+		if err := json.Unmarshal(kind, &name); err != nil {
+			return err
+		}
+		if want, ok := c.kinds[v.Type()]; !ok || name != want {
+			return fmt.Errorf("%w: expecting %s, got %q", errWrongKind, v.Type().Name(), name)
+		}
+		delete(members, "kind")
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := lowerFirst(f.Name)
+		m, ok := members[name]
+		if !ok {
+			continue
+		}
+		delete(members, name)
+		if err := c.decode(m, v.Field(i)); err != nil {
+			return fmt.Errorf("%s.%s: %w", v.Type().Name(), f.Name, err)
+		}
+	}
+
+	for name := range members {
+		return fmt.Errorf("%w: %s in %s", errUnknownField, name, v.Type().Name())
+	}
+	return nil
+}
+
+// lowerFirst starts a name with a lower case letter. Names that are all upper case, such as ID,
+// become all lower case.
+func lowerFirst(name string) string {
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(name)
+	}
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[n:]
+}
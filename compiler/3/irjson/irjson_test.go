@@ -0,0 +1,118 @@
+package irjson
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+type node interface {
+	node()
+}
+
+type leaf struct {
+	Value int
+}
+
+type branch struct {
+	Op       prim.Op
+	Children []node
+	Label    *leaf
+	Flag     bool
+}
+
+func (leaf) node()   {}
+func (branch) node() {}
+
+var testCodec = NewCodec(leaf{}, branch{})
+
+func TestRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   node
+		out  string
+	}{
+		{
+			name: "leaf",
+			in:   leaf{Value: 0},
+			out:  `{"kind":"leaf","value":0}`,
+		},
+		{
+			name: "omitted",
+			in:   branch{Op: prim.Add},
+			out:  `{"kind":"branch","op":"add"}`,
+		},
+		{
+			name: "nested",
+			in: branch{
+				Op:       prim.Lt,
+				Children: []node{leaf{Value: 1}, branch{Children: []node{}}},
+				Label:    &leaf{Value: 2},
+				Flag:     true,
+			},
+			out: `{"kind":"branch","op":"lt","children":[{"kind":"leaf","value":1},{"kind":"branch","op":"add","children":[]}],"label":{"kind":"leaf","value":2},"flag":true}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			bs, err := testCodec.Marshal(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(bs) != test.out {
+				t.Errorf("got %s, expecting %s", bs, test.out)
+			}
+			var out node
+			if err := testCodec.Unmarshal(bs, &out); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out, test.in) {
+				t.Errorf("got %#v, expecting %#v", out, test.in)
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		err  error
+	}{
+		{
+			name: "unknownKind",
+			in:   `{"kind":"twig"}`,
+			err:  errUnknownKind,
+		},
+		{
+			name: "missingKind",
+			in:   `{"value":1}`,
+			err:  errUnknownKind,
+		},
+		{
+			name: "unknownField",
+			in:   `{"kind":"leaf","colour":"green"}`,
+			err:  errUnknownField,
+		},
+		{
+			name: "wrongKind",
+			in:   `{"kind":"branch","label":{"kind":"branch"}}`,
+			err:  errWrongKind,
+		},
+		{
+			// operations are read by prim, which reports unknown ones
+			name: "unknownOp",
+			in:   `{"kind":"branch","op":"div"}`,
+			err:  prim.ErrUnknownOp,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var out node
+			err := testCodec.Unmarshal([]byte(test.in), &out)
+			if !errors.Is(err, test.err) {
+				t.Errorf("got %v, expecting %v", err, test.err)
+			}
+		})
+	}
+}
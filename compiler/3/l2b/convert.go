@@ -20,26 +20,56 @@ type converter struct {
 	prog        *bc.Program
 	block       int
 	free, bound []lc.Var
+	rec         []lc.Var
 	pos         int
 }
 
 func (c *converter) convertExpr(e lc.Expr) {
 	switch e := e.(type) {
-	case lc.Var:
-		c.addStep(c.convertVar(e))
+	case lc.App:
+		c.addStep(c.convertCall(e))
+
+	case lc.Case:
+		c.addStep(c.convertCase(e))
+
+	case lc.Fix:
+		c.convertFix(e)
+
+	default:
+		c.addStep(c.convertValue(e))
 		c.pos++
+	}
+}
+
+// convertValue produces the step that pushes the value of e. Any steps needed to compute that value
+// are added to the block first.
+func (c *converter) convertValue(e lc.Expr) bc.Step {
+	switch e := e.(type) {
+	case lc.Var:
+		return c.convertVar(e)
 
 	case lc.Abs:
-		c.addStep(c.convertLambda(e))
-		c.pos++
+		return c.convertLambda(e)
 
-	case lc.App:
-		c.addStep(c.convertCall(e))
+	case lc.Int:
+		return bc.PushInt{Value: e.Value}
+
+	case lc.Prim:
+		return c.convertPrim(e)
+
+	case lc.Con:
+		return c.convertCon(e)
 	}
+
+	panic(fmt.Sprintf("unexpected expression: %#v", e))
 }
 
 func (c *converter) convertVar(e lc.Var) bc.Step {
-	id := indexOf(e, c.bound)
+	id := lastIndexOf(e, c.rec)
+	if id != -1 {
+		return bc.PushRec{Var: id}
+	}
+	id = lastIndexOf(e, c.bound)
 	if id != -1 {
 		return bc.PushBound{Var: id}
 	}
@@ -56,7 +86,11 @@ func (c *converter) convertVar(e lc.Var) bc.Step {
 }
 
 func (c *converter) convertLambda(e lc.Abs) bc.PushFn {
-	block, free := c.convertBody(e)
+	return c.convertClosure(flattenVars(e))
+}
+
+func (c *converter) convertClosure(bound []lc.Var, body lc.Expr) bc.PushFn {
+	block, free := c.convertBlock(bound, body)
 	start := c.pos
 
 	c.addStep(bc.PushBlock{
@@ -73,40 +107,98 @@ func (c *converter) convertLambda(e lc.Abs) bc.PushFn {
 	}
 }
 
+func (c *converter) convertPrim(e lc.Prim) bc.PushPrim {
+	start := c.pushValues(e.Args)
+
+	return bc.PushPrim{
+		Op:    e.Op,
+		Start: start,
+		Argc:  len(e.Args),
+	}
+}
+
+func (c *converter) convertCon(e lc.Con) bc.PushCon {
+	start := c.pushValues(e.Args)
+
+	return bc.PushCon{
+		Tag:   e.Tag,
+		Start: start,
+		Argc:  len(e.Args),
+	}
+}
+
+// convertCase turns each of the arms into a function, to be selected when the case is executed.
+func (c *converter) convertCase(e lc.Case) bc.Switch {
+	toPush := make([]bc.Step, len(e.Arms)+1)
+	toPush[0] = c.convertValue(e.On)
+	for i, a := range e.Arms {
+		toPush[i+1] = c.convertClosure(a.Vars, a.Body)
+	}
+
+	return bc.Switch{
+		Start: c.addSteps(toPush),
+		Argc:  len(toPush),
+	}
+}
+
+// convertFix builds the recursive functions, which capture placeholders for one another until they
+// are tied together. The body is then called with the functions as its arguments.
+func (c *converter) convertFix(e lc.Fix) {
+	toPush := make([]bc.Step, len(e.Fns)+1)
+	toPush[0] = c.convertClosure(e.Vars, e.Body)
+	c.rec = e.Vars
+	for i, f := range e.Fns {
+		toPush[i+1] = c.convertLambda(f)
+	}
+	c.rec = nil
+
+	start := c.addSteps(toPush)
+	c.addStep(bc.Tie{
+		Start: start + 1,
+		Count: len(e.Fns),
+	})
+	c.addStep(bc.Call{
+		Start: start,
+		Argc:  len(toPush),
+	})
+}
+
+// pushValues places the values of es next to each other in the frame, returning the position of
+// the first one.
+func (c *converter) pushValues(es []lc.Expr) int {
+	toPush := make([]bc.Step, len(es))
+	for i, a := range es {
+		toPush[i] = c.convertValue(a)
+	}
+	return c.addSteps(toPush)
+}
+
 func (c *converter) convertCall(e lc.App) bc.Call {
 	args := flattenArgs(e)
 	toPush := make([]bc.Step, len(args))
 
 	for i, a := range args {
-		switch a := a.(type) {
-		case lc.Var:
-			toPush[i] = c.convertVar(a)
-		case lc.Abs:
-			toPush[i] = c.convertLambda(a)
-		}
-	}
-
-	start := c.pos
-	for _, a := range toPush {
-		c.addStep(a)
-		c.pos++
+		toPush[i] = c.convertValue(a)
 	}
 
 	return bc.Call{
-		Start: start,
+		Start: c.addSteps(toPush),
 		Argc:  len(args),
 	}
 }
 
 func (c *converter) convertBody(e lc.Abs) (int, []lc.Var) {
-	bound, body := flattenVars(e)
+	return c.convertBlock(flattenVars(e))
+}
+
+func (c *converter) convertBlock(bound []lc.Var, body lc.Expr) (int, []lc.Var) {
 	block := len(c.prog.Blocks)
 
 	inner := converter{
 		prog:  c.prog,
 		block: block,
 		bound: bound,
-		free:  usedVars(mergeVars(c.bound, c.free), e),
+		free:  usedVars(removeVars(bound, mergeVars(mergeVars(c.bound, c.free), c.rec)), body),
 	}
 	c.prog.Blocks = append(c.prog.Blocks, bc.Block{
 		Bound: inner.bound,
@@ -123,6 +215,16 @@ func (c *converter) addStep(s bc.Step) {
 	block.Steps = append(block.Steps, s)
 }
 
+// addSteps adds steps that each push a value, returning the position of the first one.
+func (c *converter) addSteps(ss []bc.Step) int {
+	start := c.pos
+	for _, s := range ss {
+		c.addStep(s)
+		c.pos++
+	}
+	return start
+}
+
 func usedVars(scope []lc.Var, e lc.Expr) []lc.Var {
 	switch e := e.(type) {
 	case lc.Var:
@@ -130,6 +232,31 @@ func usedVars(scope []lc.Var, e lc.Expr) []lc.Var {
 			return []lc.Var{e}
 		}
 		return nil
+
+	case lc.Int:
+		return nil
+
+	case lc.Prim:
+		return usedVarsAll(scope, e.Args)
+
+	case lc.Con:
+		return usedVarsAll(scope, e.Args)
+
+	case lc.Case:
+		used := usedVars(scope, e.On)
+		for _, a := range e.Arms {
+			used = mergeVars(used, usedVars(removeVars(a.Vars, scope), a.Body))
+		}
+		return used
+
+	case lc.Fix:
+		inner := removeVars(e.Vars, scope)
+		used := usedVars(inner, e.Body)
+		for _, f := range e.Fns {
+			used = mergeVars(used, usedVars(inner, f))
+		}
+		return used
+
 	case lc.Abs:
 		return usedVars(removeVar(e.Var, scope), e.Body)
 
@@ -143,6 +270,14 @@ func usedVars(scope []lc.Var, e lc.Expr) []lc.Var {
 	panic("unreachable")
 }
 
+func usedVarsAll(scope []lc.Var, es []lc.Expr) []lc.Var {
+	var used []lc.Var
+	for _, e := range es {
+		used = mergeVars(used, usedVars(scope, e))
+	}
+	return used
+}
+
 func flattenVars(a lc.Abs) ([]lc.Var, lc.Expr) {
 	var vars []lc.Var
 	for {
@@ -177,24 +312,44 @@ func indexOf(x lc.Var, xs []lc.Var) int {
 	return -1
 }
 
+func lastIndexOf(x lc.Var, xs []lc.Var) int {
+	for i := len(xs) - 1; i >= 0; i-- {
+		if x == xs[i] {
+			return i
+		}
+	}
+	return -1
+}
+
 func appearsIn(x lc.Var, xs []lc.Var) bool {
 	return indexOf(x, xs) != -1
 }
 
+// removeVar returns xs without x. It does not modify xs, which may be shared with a block.
 func removeVar(x lc.Var, xs []lc.Var) []lc.Var {
 	idx := indexOf(x, xs)
 	if idx == -1 {
 		return xs
 	}
-	copy(xs[idx:], xs[idx+1:])
-	return xs[:len(xs)-1]
+	res := make([]lc.Var, 0, len(xs)-1)
+	res = append(res, xs[:idx]...)
+	return append(res, xs[idx+1:]...)
+}
+
+func removeVars(rm, xs []lc.Var) []lc.Var {
+	for _, x := range rm {
+		xs = removeVar(x, xs)
+	}
+	return xs
 }
 
+// mergeVars returns the union of a and b, preserving the order of a. It does not modify a.
 func mergeVars(a, b []lc.Var) []lc.Var {
+	res := a[:len(a):len(a)]
 	for _, b := range b {
-		if !appearsIn(b, a) {
-			a = append(a, b)
+		if !appearsIn(b, res) {
+			res = append(res, b)
 		}
 	}
-	return a
+	return res
 }
@@ -0,0 +1,107 @@
+package lc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDot writes e as a tree in the DOT language of Graphviz. Each term is a node, and edges are
+// labelled with the part that the child plays in its parent where that is not obvious.
+func WriteDot(w io.Writer, e Expr) error {
+	d := &dotWriter{w: w}
+	d.printf("digraph lc {\n")
+	d.printf("\tnode [fontname=monospace];\n")
+	d.node(e)
+	d.printf("}\n")
+	return d.err
+}
+
+type dotWriter struct {
+	w     io.Writer
+	nodes int
+	err   error
+}
+
+func (d *dotWriter) printf(format string, args ...interface{}) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = fmt.Fprintf(d.w, format, args...)
+}
+
+// node writes e and its children, returning the name of the node for e.
+func (d *dotWriter) node(e Expr) string {
+	id := fmt.Sprintf("n%d", d.nodes)
+	d.nodes++
+
+	label := func(l string) {
+		d.printf("\t%s [label=%s];\n", id, dotQuote(l))
+	}
+	edge := func(child Expr, l string) {
+		to := d.node(child)
+		if l == "" {
+			d.printf("\t%s -> %s;\n", id, to)
+			return
+		}
+		d.printf("\t%s -> %s [label=%s];\n", id, to, dotQuote(l))
+	}
+
+	switch e := e.(type) {
+	case Var:
+		label(e.Name)
+
+	case Int:
+		label(fmt.Sprint(e.Value))
+
+	case Abs:
+		label("λ" + e.Var.Name)
+		edge(e.Body, "")
+
+	case App:
+		label("@")
+		edge(e.Fn, "fn")
+		edge(e.Arg, "arg")
+
+	case Prim:
+		label(e.Op.String())
+		for _, a := range e.Args {
+			edge(a, "")
+		}
+
+	case Con:
+		label(fmt.Sprintf("#%d", e.Tag))
+		for _, a := range e.Args {
+			edge(a, "")
+		}
+
+	case Case:
+		label("case")
+		edge(e.On, "on")
+		for i, a := range e.Arms {
+			edge(a.Body, fmt.Sprintf("#%d(%s)", i, varNames(a.Vars)))
+		}
+
+	case Fix:
+		label("fix")
+		for i, f := range e.Fns {
+			edge(f, e.Vars[i].Name)
+		}
+		edge(e.Body, "in")
+	}
+
+	return id
+}
+
+func varNames(vs []Var) string {
+	names := make([]string, len(vs))
+	for i, v := range vs {
+		names[i] = v.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// dotQuote writes s as a string in the DOT language.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
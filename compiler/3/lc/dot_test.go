@@ -0,0 +1,53 @@
+package lc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestWriteDot(t *testing.T) {
+	k := Var{Name: "k"}
+	in := Abs{Var: k, Body: Case{
+		On: Con{Tag: 1, Args: []Expr{Int{Value: 2}}},
+		Arms: []Arm{
+			{Body: App{Fn: k, Arg: Int{Value: 0}}},
+			{Vars: []Var{{Name: `"x"`}}, Body: App{Fn: k, Arg: Prim{Op: prim.Add, Args: []Expr{Var{Name: `"x"`}, Int{Value: 1}}}}},
+		},
+	}}
+	out := `digraph lc {
+	node [fontname=monospace];
+	n0 [label="λk"];
+	n1 [label="case"];
+	n2 [label="#1"];
+	n3 [label="2"];
+	n2 -> n3;
+	n1 -> n2 [label="on"];
+	n4 [label="@"];
+	n5 [label="k"];
+	n4 -> n5 [label="fn"];
+	n6 [label="0"];
+	n4 -> n6 [label="arg"];
+	n1 -> n4 [label="#0()"];
+	n7 [label="@"];
+	n8 [label="k"];
+	n7 -> n8 [label="fn"];
+	n9 [label="add"];
+	n10 [label="\"x\""];
+	n9 -> n10;
+	n11 [label="1"];
+	n9 -> n11;
+	n7 -> n9 [label="arg"];
+	n1 -> n7 [label="#1(\"x\")"];
+	n0 -> n1;
+}
+`
+	var b strings.Builder
+	if err := WriteDot(&b, in); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != out {
+		t.Errorf("got\n%s\nexpecting\n%s", b.String(), out)
+	}
+}
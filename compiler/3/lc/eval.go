@@ -0,0 +1,229 @@
+package lc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errNotFunction = errors.New("not a function")
+var errNoMatch = errors.New("no matching arm")
+var errWrongArgCount = errors.New("wrong number of arguments")
+var errNotValue = errors.New("not a value")
+var errNotControl = errors.New("not a transfer of control")
+
+// Eval runs a program in continuation passing style, as produced by c2l. The program is a function
+// that takes the continuation of the whole program, and the runtime provides a continuation that
+// finishes it.
+//
+// Applications, cases and recursive bindings may only appear in tail position, where they transfer
+// control. Everything else is a value. Reduction can leave functions that make a call with fewer
+// arguments than the callee takes, so functions may be called with more arguments than they have
+// parameters. The rest are passed on to the call.
+func Eval(e Expr) (prim.Value, error) {
+	m := &machine{}
+	f, err := m.value(e, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.Call(f, []prim.Value{m.rt.Return()})
+	return m.run()
+}
+
+type machine struct {
+	rt   cps.Runtime
+	expr Expr
+	env  *binding
+	fn   prim.Value
+	args []prim.Value
+	err  error
+
+	// extra holds arguments that were passed to a function beyond its parameters. They are passed
+	// on to the call that the function makes.
+	extra []prim.Value
+}
+
+type binding struct {
+	name  string
+	value prim.Value
+	next  *binding
+}
+
+type closure struct {
+	fn  Abs
+	env *binding
+}
+
+func (c *closure) String() string {
+	return "<function>"
+}
+
+func (m *machine) run() (prim.Value, error) {
+	for m.err == nil {
+		if v, done := m.rt.Done(); done {
+			return v, nil
+		}
+		if m.expr != nil {
+			e := m.expr
+			m.expr = nil
+			m.exec(e)
+			continue
+		}
+		f, args := m.fn, m.args
+		m.fn, m.args = nil, nil
+		m.apply(f, args)
+	}
+	return nil, m.err
+}
+
+// Call arranges for f to be called with args once the current step is complete.
+func (m *machine) Call(f prim.Value, args []prim.Value) {
+	m.fn = f
+	m.args = args
+}
+
+func (m *machine) fail(err error) {
+	m.err = err
+}
+
+func (m *machine) exec(e Expr) {
+	switch e := e.(type) {
+	case App:
+		var es []Expr
+		var fn Expr = e
+		for {
+			app, ok := fn.(App)
+			if !ok {
+				break
+			}
+			es = append([]Expr{app.Arg}, es...)
+			fn = app.Fn
+		}
+		vs, err := m.values(append([]Expr{fn}, es...), m.env)
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		m.Call(vs[0], append(vs[1:], m.extra...))
+		m.extra = nil
+
+	case Case:
+		v, err := m.value(e.On, m.env)
+		if err != nil {
+			m.fail(err)
+			return
+		}
+		con, ok := v.(prim.Con)
+		if !ok {
+			m.fail(fmt.Errorf("%w: cannot match on %s", prim.ErrType, v))
+			return
+		}
+		if con.Tag < 0 || con.Tag >= len(e.Arms) || len(e.Arms[con.Tag].Vars) != len(con.Fields) {
+			m.fail(fmt.Errorf("%w: %s", errNoMatch, v))
+			return
+		}
+		arm := e.Arms[con.Tag]
+		env := m.env
+		for i, x := range arm.Vars {
+			env = &binding{name: x.Name, value: con.Fields[i], next: env}
+		}
+		m.expr, m.env = arm.Body, env
+
+	case Fix:
+		env := m.env
+		bound := make([]*binding, len(e.Vars))
+		for i, x := range e.Vars {
+			env = &binding{name: x.Name, next: env}
+			bound[i] = env
+		}
+		for i, f := range e.Fns {
+			bound[i].value = &closure{fn: f, env: env}
+		}
+		m.expr, m.env = e.Body, env
+
+	default:
+		m.fail(fmt.Errorf("%w: %s", errNotControl, e))
+	}
+}
+
+// apply calls f with all of its arguments at once.
+func (m *machine) apply(f prim.Value, args []prim.Value) {
+	switch f := f.(type) {
+	case *closure:
+		if len(args) == 0 {
+			m.fail(fmt.Errorf("%w: expecting more than 0", errWrongArgCount))
+			return
+		}
+		env, fn := f.env, f.fn
+		for {
+			env = &binding{name: fn.Var.Name, value: args[0], next: env}
+			args = args[1:]
+			next, ok := fn.Body.(Abs)
+			if !ok || len(args) == 0 {
+				break
+			}
+			fn = next
+		}
+		if _, ok := fn.Body.(Abs); ok {
+			m.fail(fmt.Errorf("%w: expecting more arguments", errWrongArgCount))
+			return
+		}
+		m.expr, m.env, m.extra = fn.Body, env, args
+
+	case *cps.Builtin:
+		if err := f.Call(m, args); err != nil {
+			m.fail(err)
+		}
+
+	default:
+		m.fail(fmt.Errorf("%w: %s", errNotFunction, f))
+	}
+}
+
+func (m *machine) value(e Expr, env *binding) (prim.Value, error) {
+	switch e := e.(type) {
+	case Var:
+		for b := env; b != nil; b = b.next {
+			if b.name == e.Name {
+				return b.value, nil
+			}
+		}
+		return m.rt.Global(e.Name)
+
+	case Int:
+		return prim.Int(e.Value), nil
+
+	case Abs:
+		return &closure{fn: e, env: env}, nil
+
+	case Prim:
+		vs, err := m.values(e.Args, env)
+		if err != nil {
+			return nil, err
+		}
+		return e.Op.Apply(vs)
+
+	case Con:
+		vs, err := m.values(e.Args, env)
+		if err != nil {
+			return nil, err
+		}
+		return prim.Con{Tag: e.Tag, Fields: vs}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", errNotValue, e)
+}
+
+func (m *machine) values(es []Expr, env *binding) ([]prim.Value, error) {
+	vs := make([]prim.Value, len(es))
+	for i, e := range es {
+		v, err := m.value(e, env)
+		if err != nil {
+			return nil, err
+		}
+		vs[i] = v
+	}
+	return vs, nil
+}
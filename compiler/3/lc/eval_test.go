@@ -0,0 +1,61 @@
+package lc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bobappleyard/goose/prim"
+)
+
+func TestEval(t *testing.T) {
+	k := Var{Name: "k"}
+	x := Var{Name: "x"}
+	y := Var{Name: "y"}
+	for _, test := range []struct {
+		name string
+		in   Expr
+		out  prim.Value
+		err  error
+	}{
+		{
+			name: "return",
+			in:   Abs{Var: k, Body: App{Fn: k, Arg: Int{Value: 1}}},
+			out:  prim.Int(1),
+		},
+		{
+			// (λx · f x) 2 3 passes 3 on to f
+			name: "extraArgs",
+			in: Abs{Var: k, Body: App{
+				Fn: App{
+					Fn:  Abs{Var: x, Body: App{Fn: Abs{Var: x, Body: Abs{Var: y, Body: App{Fn: k, Arg: y}}}, Arg: x}},
+					Arg: Int{Value: 2},
+				},
+				Arg: Int{Value: 3},
+			}},
+			out: prim.Int(3),
+		},
+		{
+			name: "tooFewArgs",
+			in: Abs{Var: k, Body: App{
+				Fn:  Abs{Var: x, Body: Abs{Var: k, Body: App{Fn: k, Arg: x}}},
+				Arg: Int{Value: 2},
+			}},
+			err: errWrongArgCount,
+		},
+		{
+			name: "notControl",
+			in:   Abs{Var: k, Body: Int{Value: 1}},
+			err:  errNotControl,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Eval(test.in)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, expecting %v", err, test.err)
+			}
+			if out != test.out {
+				t.Errorf("got %v, expecting %v", out, test.out)
+			}
+		})
+	}
+}
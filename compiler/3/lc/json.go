@@ -0,0 +1,32 @@
+package lc
+
+import "github.com/bobappleyard/goose/irjson"
+
+var codec = irjson.NewCodec(
+	Var{},
+	App{},
+	Abs{},
+	Int{},
+	Prim{},
+	Con{},
+	Case{},
+	Fix{},
+)
+
+func (v Var) MarshalJSON() ([]byte, error)  { return codec.Marshal(v) }
+func (a App) MarshalJSON() ([]byte, error)  { return codec.Marshal(a) }
+func (a Abs) MarshalJSON() ([]byte, error)  { return codec.Marshal(a) }
+func (i Int) MarshalJSON() ([]byte, error)  { return codec.Marshal(i) }
+func (p Prim) MarshalJSON() ([]byte, error) { return codec.Marshal(p) }
+func (c Con) MarshalJSON() ([]byte, error)  { return codec.Marshal(c) }
+func (c Case) MarshalJSON() ([]byte, error) { return codec.Marshal(c) }
+func (f Fix) MarshalJSON() ([]byte, error)  { return codec.Marshal(f) }
+
+// UnmarshalExpr reads an expression written as JSON.
+func UnmarshalExpr(data []byte) (Expr, error) {
+	var e Expr
+	if err := codec.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
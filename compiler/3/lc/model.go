@@ -1,7 +1,12 @@
 // The untyped lambda calculus.
 package lc
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bobappleyard/goose/prim"
+)
 
 type Expr interface {
 	expr()
@@ -21,9 +26,52 @@ type Abs struct {
 	Body Expr
 }
 
-func (Var) expr() {}
-func (App) expr() {}
-func (Abs) expr() {}
+// Int is an integer constant.
+type Int struct {
+	Value int
+}
+
+// Prim applies a primitive operation to its arguments. Primitives do not take a continuation, so
+// they may appear as arguments to an application.
+type Prim struct {
+	Op   prim.Op
+	Args []Expr
+}
+
+// Con is a constructed value, identified by its tag.
+type Con struct {
+	Tag  int
+	Args []Expr
+}
+
+// Case transfers control to the arm selected by the tag of its scrutinee, binding that value's
+// fields. Like an application, it may only appear in tail position.
+type Case struct {
+	On   Expr
+	Arms []Arm
+}
+
+type Arm struct {
+	Vars []Var
+	Body Expr
+}
+
+// Fix binds a group of mutually recursive functions within Body. Like an application, it may only
+// appear in tail position.
+type Fix struct {
+	Vars []Var
+	Fns  []Abs
+	Body Expr
+}
+
+func (Var) expr()  {}
+func (App) expr()  {}
+func (Abs) expr()  {}
+func (Int) expr()  {}
+func (Prim) expr() {}
+func (Con) expr()  {}
+func (Case) expr() {}
+func (Fix) expr()  {}
 
 func (v Var) String() string {
 	return v.Name
@@ -45,10 +93,59 @@ func (l Abs) String() string {
 	return fmt.Sprintf("λ%s · %s", l.Var, l.Body)
 }
 
+func (i Int) String() string {
+	return fmt.Sprint(i.Value)
+}
+
+func (p Prim) String() string {
+	return fmt.Sprintf("%s(%s)", p.Op, joinExprs(p.Args))
+}
+
+func (c Con) String() string {
+	if len(c.Args) == 0 {
+		return fmt.Sprintf("#%d", c.Tag)
+	}
+	return fmt.Sprintf("#%d(%s)", c.Tag, joinExprs(c.Args))
+}
+
+func (c Case) String() string {
+	arms := make([]string, len(c.Arms))
+	for i, a := range c.Arms {
+		vars := make([]string, len(a.Vars))
+		for j, v := range a.Vars {
+			vars[j] = v.Name
+		}
+		arms[i] = fmt.Sprintf("#%d(%s) → %s", i, strings.Join(vars, ", "), a.Body)
+	}
+	return fmt.Sprintf("case %s { %s }", c.On, strings.Join(arms, "; "))
+}
+
+func (f Fix) String() string {
+	bindings := make([]string, len(f.Vars))
+	for i, v := range f.Vars {
+		bindings[i] = fmt.Sprintf("%s = %s", v, f.Fns[i])
+	}
+	return fmt.Sprintf("fix %s in %s", strings.Join(bindings, ", "), f.Body)
+}
+
+func joinExprs(xs []Expr) string {
+	strs := make([]string, len(xs))
+	for i, x := range xs {
+		strs[i] = fmt.Sprint(x)
+	}
+	return strings.Join(strs, ", ")
+}
+
 func containsLambda(x Expr) bool {
 	switch x := x.(type) {
-	case Var:
+	case Var, Int:
 		return false
+	case Prim:
+		return anyContainsLambda(x.Args)
+	case Con:
+		return anyContainsLambda(x.Args)
+	case Case, Fix:
+		return true
 	case Abs:
 		return true
 	case App:
@@ -56,3 +153,12 @@ func containsLambda(x Expr) bool {
 	}
 	panic("unreachable")
 }
+
+func anyContainsLambda(xs []Expr) bool {
+	for _, x := range xs {
+		if containsLambda(x) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,8 @@ package lc
 // continuation passing style. using beta and eta reductions where applicable. This utilises a
 // heuristic, which is that every reduction step must actually make the term smaller. Doing so
 // prevents the function from looping infinitely at the cost of missing some useful reductions.
+// Recursive functions bound by Fix are never substituted, so they are never unrolled, but they are
+// dropped if nothing refers to them.
 func Reduce(e Expr) Expr {
 	return reduce(e, true)
 }
@@ -13,9 +15,51 @@ func Reduce(e Expr) Expr {
 func reduce(expr Expr, rhs bool) Expr {
 start:
 	switch e := expr.(type) {
-	case Var:
+	case Var, Int:
 		return e
 
+	case Prim:
+		return Prim{Op: e.Op, Args: reduceAll(e.Args)}
+
+	case Con:
+		return Con{Tag: e.Tag, Args: reduceAll(e.Args)}
+
+	case Case:
+		on := reduce(e.On, true)
+		arms := make([]Arm, len(e.Arms))
+		for i, a := range e.Arms {
+			arms[i] = Arm{Vars: a.Vars, Body: reduce(a.Body, false)}
+		}
+
+		// case of known constructor: case #1(y) { #0() → f; #1(x) → x } --> y
+		if on, ok := on.(Con); ok && knownCase(on, arms) {
+			arm := arms[on.Tag]
+			expr = arm.Body
+			for i, v := range arm.Vars {
+				expr = substitute(v, on.Args[i], expr)
+			}
+			if Size(expr) >= Size(e) {
+				return expr
+			}
+			goto start
+		}
+
+		return Case{On: on, Arms: arms}
+
+	case Fix:
+		body := reduce(e.Body, false)
+
+		// unused bindings: fix f = λx·y in z --> z
+		if !mentionsAny(e.Vars, body) {
+			return body
+		}
+
+		fns := make([]Abs, len(e.Fns))
+		for i, f := range e.Fns {
+			fns[i] = reduceFn(f)
+		}
+		return Fix{Vars: e.Vars, Fns: fns, Body: body}
+
 	case Abs:
 		body := reduce(e.Body, false)
 
@@ -31,9 +75,9 @@ start:
 		arg := reduce(e.Arg, true)
 
 		// beta reduction: (λx·x) y --> y
-		if fn, ok := fn.(Abs); ok {
+		if fn, ok := fn.(Abs); ok && !captures(fn.Var, arg, fn.Body) {
 			expr = substitute(fn.Var, arg, fn.Body)
-			if size(expr) >= size(e) {
+			if Size(expr) >= Size(e) {
 				return expr
 			}
 			// simulate tail recursion
@@ -46,6 +90,46 @@ start:
 	panic("unreachable")
 }
 
+// reduceFn reduces the body of a function bound by Fix. There is no eta reduction of any of its
+// parameters, so that the binding remains a function of all of them.
+func reduceFn(f Abs) Abs {
+	if body, ok := f.Body.(Abs); ok {
+		return Abs{Var: f.Var, Body: reduceFn(body)}
+	}
+	return Abs{Var: f.Var, Body: reduce(f.Body, false)}
+}
+
+func reduceAll(es []Expr) []Expr {
+	res := make([]Expr, len(es))
+	for i, e := range es {
+		res[i] = reduce(e, true)
+	}
+	return res
+}
+
+// knownCase checks whether a case expression can be resolved statically. Fields are substituted
+// into the arm one at a time, so this also makes sure that doing so won't confuse two variables.
+func knownCase(on Con, arms []Arm) bool {
+	if on.Tag < 0 || on.Tag >= len(arms) {
+		return false
+	}
+	arm := arms[on.Tag]
+	if len(arm.Vars) != len(on.Args) {
+		return false
+	}
+	for i, a := range on.Args {
+		for _, v := range arm.Vars[i+1:] {
+			if Contains(v, a) {
+				return false
+			}
+		}
+		if captures(arm.Vars[i], a, arm.Body) {
+			return false
+		}
+	}
+	return true
+}
+
 // Contains reports the presence of the variable v in the expression e, taking into account possible
 // bindings of a variable with the same name.
 func Contains(v Var, e Expr) bool {
@@ -53,6 +137,37 @@ func Contains(v Var, e Expr) bool {
 	case Var:
 		return e == v
 
+	case Int:
+		return false
+
+	case Prim:
+		return containsAny(v, e.Args)
+
+	case Con:
+		return containsAny(v, e.Args)
+
+	case Case:
+		if Contains(v, e.On) {
+			return true
+		}
+		for _, a := range e.Arms {
+			if !binds(a, v) && Contains(v, a.Body) {
+				return true
+			}
+		}
+		return false
+
+	case Fix:
+		if bindsAny(e.Vars, v) {
+			return false
+		}
+		for _, f := range e.Fns {
+			if Contains(v, f) {
+				return true
+			}
+		}
+		return Contains(v, e.Body)
+
 	case Abs:
 		if e.Var == v {
 			return false
@@ -66,18 +181,67 @@ func Contains(v Var, e Expr) bool {
 	panic("unreachable")
 }
 
+func containsAny(v Var, es []Expr) bool {
+	for _, e := range es {
+		if Contains(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func binds(a Arm, v Var) bool {
+	return bindsAny(a.Vars, v)
+}
+
+func bindsAny(vs []Var, v Var) bool {
+	for _, x := range vs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
 // Valid checks whether a term is valid according to the constraints of CPS. This means that, while
 // nested abstractions and applications are permissible, this nesting may only appear on the lhs.
+// Primitive operations and constructors are computed directly, so applications may not appear
+// among their arguments either. Case expressions transfer control in the same way as applications.
 func Valid(e Expr) bool {
 	switch e := e.(type) {
-	case Var:
+	case Var, Int:
 		return true
 
+	case Prim:
+		return validArgs(e.Args)
+
+	case Con:
+		return validArgs(e.Args)
+
+	case Case:
+		if !validArgs([]Expr{e.On}) {
+			return false
+		}
+		for _, a := range e.Arms {
+			if !Valid(a.Body) {
+				return false
+			}
+		}
+		return true
+
+	case Fix:
+		for _, f := range e.Fns {
+			if !Valid(f) {
+				return false
+			}
+		}
+		return Valid(e.Body)
+
 	case Abs:
 		return Valid(e.Body)
 
 	case App:
-		if _, ok := e.Arg.(App); ok {
+		if isControl(e.Arg) {
 			return false
 		}
 		return Valid(e.Fn) && Valid(e.Arg)
@@ -86,6 +250,24 @@ func Valid(e Expr) bool {
 	panic("unreachable")
 }
 
+func validArgs(es []Expr) bool {
+	for _, e := range es {
+		if isControl(e) || !Valid(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// isControl reports whether evaluating e transfers control rather than producing a value.
+func isControl(e Expr) bool {
+	switch e.(type) {
+	case App, Case, Fix:
+		return true
+	}
+	return false
+}
+
 // validEta checks whether we can safely perform an eta reduction. This is a bit fiddly, as we are
 // trying to maintain CPS-validity.
 func validEta(e Abs, body App, rhs bool) bool {
@@ -99,6 +281,79 @@ func validEta(e Abs, body App, rhs bool) bool {
 	return !rhs || !ok
 }
 
+// captures reports whether substituting to for from in e would place to under a binding of one of
+// its variables. Substitution does not rename bindings, so such reductions are not made.
+func captures(from Var, to, e Expr) bool {
+	switch e := e.(type) {
+	case Var, Int:
+		return false
+
+	case Prim:
+		return capturesAny(from, to, e.Args)
+
+	case Con:
+		return capturesAny(from, to, e.Args)
+
+	case Case:
+		if captures(from, to, e.On) {
+			return true
+		}
+		for _, a := range e.Arms {
+			if binds(a, from) || !Contains(from, a.Body) {
+				continue
+			}
+			if mentionsAny(a.Vars, to) || captures(from, to, a.Body) {
+				return true
+			}
+		}
+		return false
+
+	case Fix:
+		if bindsAny(e.Vars, from) || !Contains(from, e) {
+			return false
+		}
+		if mentionsAny(e.Vars, to) {
+			return true
+		}
+		for _, f := range e.Fns {
+			if captures(from, to, f) {
+				return true
+			}
+		}
+		return captures(from, to, e.Body)
+
+	case Abs:
+		if e.Var == from || !Contains(from, e.Body) {
+			return false
+		}
+		return Contains(e.Var, to) || captures(from, to, e.Body)
+
+	case App:
+		return captures(from, to, e.Fn) || captures(from, to, e.Arg)
+	}
+
+	panic("unreachable")
+}
+
+// mentionsAny reports whether any of vs appear in e.
+func mentionsAny(vs []Var, e Expr) bool {
+	for _, v := range vs {
+		if Contains(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func capturesAny(from Var, to Expr, es []Expr) bool {
+	for _, e := range es {
+		if captures(from, to, e) {
+			return true
+		}
+	}
+	return false
+}
+
 // substitue replaces all instances of from with to in e, taking into account scoping rules.
 func substitute(from Var, to, e Expr) Expr {
 	switch e := e.(type) {
@@ -108,6 +363,38 @@ func substitute(from Var, to, e Expr) Expr {
 		}
 		return e
 
+	case Int:
+		return e
+
+	case Prim:
+		return Prim{Op: e.Op, Args: substituteAll(from, to, e.Args)}
+
+	case Con:
+		return Con{Tag: e.Tag, Args: substituteAll(from, to, e.Args)}
+
+	case Case:
+		arms := make([]Arm, len(e.Arms))
+		for i, a := range e.Arms {
+			arms[i] = a
+			if !binds(a, from) {
+				arms[i].Body = substitute(from, to, a.Body)
+			}
+		}
+		return Case{On: substitute(from, to, e.On), Arms: arms}
+
+	case Fix:
+		if bindsAny(e.Vars, from) {
+			return e
+		}
+		fns := make([]Abs, len(e.Fns))
+		for i, f := range e.Fns {
+			fns[i] = Abs{Var: f.Var, Body: f.Body}
+			if f.Var != from {
+				fns[i].Body = substitute(from, to, f.Body)
+			}
+		}
+		return Fix{Vars: e.Vars, Fns: fns, Body: substitute(from, to, e.Body)}
+
 	case Abs:
 		if e.Var == from {
 			return e
@@ -124,18 +411,54 @@ func substitute(from Var, to, e Expr) Expr {
 	panic("unreachable")
 }
 
-// size of a lambda term.
-func size(e Expr) int {
+func substituteAll(from Var, to Expr, es []Expr) []Expr {
+	res := make([]Expr, len(es))
+	for i, e := range es {
+		res[i] = substitute(from, to, e)
+	}
+	return res
+}
+
+// Size counts the nodes in e.
+func Size(e Expr) int {
 	switch e := e.(type) {
-	case Var:
+	case Var, Int:
 		return 1
 
+	case Prim:
+		return 1 + sizeAll(e.Args)
+
+	case Con:
+		return 1 + sizeAll(e.Args)
+
+	case Case:
+		n := 1 + Size(e.On)
+		for _, a := range e.Arms {
+			n += Size(a.Body)
+		}
+		return n
+
+	case Fix:
+		n := 1 + Size(e.Body)
+		for _, f := range e.Fns {
+			n += Size(f)
+		}
+		return n
+
 	case Abs:
-		return 1 + size(e.Body)
+		return 1 + Size(e.Body)
 
 	case App:
-		return size(e.Fn) + size(e.Arg)
+		return Size(e.Fn) + Size(e.Arg)
 	}
 
 	panic("unreachable")
 }
+
+func sizeAll(es []Expr) int {
+	n := 0
+	for _, e := range es {
+		n += Size(e)
+	}
+	return n
+}
@@ -3,6 +3,8 @@ package lc
 import (
 	"reflect"
 	"testing"
+
+	"github.com/bobappleyard/goose/prim"
 )
 
 func TestReduce(t *testing.T) {
@@ -114,6 +116,208 @@ func TestReduce(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "prim",
+			in: Abs{
+				Var: Var{Name: "#k1"},
+				Body: App{
+					Fn: Abs{
+						Var: Var{Name: "#k2"},
+						Body: App{
+							Fn:  Var{Name: "#k2"},
+							Arg: Var{Name: "x"},
+						},
+					},
+					Arg: Abs{
+						Var: Var{Name: "#x3"},
+						Body: App{
+							Fn: Abs{
+								Var: Var{Name: "#k4"},
+								Body: App{
+									Fn:  Var{Name: "#k4"},
+									Arg: Int{Value: 1},
+								},
+							},
+							Arg: Abs{
+								Var: Var{Name: "#x5"},
+								Body: App{
+									Fn: Var{Name: "#k1"},
+									Arg: Prim{
+										Op:   prim.Add,
+										Args: []Expr{Var{Name: "#x3"}, Var{Name: "#x5"}},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			out: Abs{
+				Var: Var{Name: "#k1"},
+				Body: App{
+					Fn: Var{Name: "#k1"},
+					Arg: Prim{
+						Op:   prim.Add,
+						Args: []Expr{Var{Name: "x"}, Int{Value: 1}},
+					},
+				},
+			},
+		},
+		{
+			name: "known-case",
+			in: Abs{
+				Var: Var{Name: "k"},
+				Body: Case{
+					On: Con{Tag: 1, Args: []Expr{Var{Name: "y"}}},
+					Arms: []Arm{
+						{Body: App{Fn: Var{Name: "k"}, Arg: Int{Value: 0}}},
+						{
+							Vars: []Var{{Name: "x"}},
+							Body: App{Fn: Var{Name: "k"}, Arg: Var{Name: "x"}},
+						},
+					},
+				},
+			},
+			out: Abs{
+				Var:  Var{Name: "k"},
+				Body: App{Fn: Var{Name: "k"}, Arg: Var{Name: "y"}},
+			},
+		},
+		{
+			name: "fix",
+			in: Abs{
+				Var: Var{Name: "k"},
+				Body: Fix{
+					Vars: []Var{{Name: "f"}},
+					Fns: []Abs{
+						{
+							Var: Var{Name: "x"},
+							Body: Abs{
+								Var: Var{Name: "k2"},
+								Body: App{
+									Fn: Abs{Var: Var{Name: "y"}, Body: Var{Name: "y"}},
+									Arg: App{
+										Fn:  App{Fn: Var{Name: "f"}, Arg: Var{Name: "x"}},
+										Arg: Var{Name: "k2"},
+									},
+								},
+							},
+						},
+					},
+					Body: App{
+						Fn:  App{Fn: Var{Name: "f"}, Arg: Int{Value: 1}},
+						Arg: Var{Name: "k"},
+					},
+				},
+			},
+			out: Abs{
+				Var: Var{Name: "k"},
+				Body: Fix{
+					Vars: []Var{{Name: "f"}},
+					Fns: []Abs{
+						{
+							Var: Var{Name: "x"},
+							Body: Abs{
+								Var: Var{Name: "k2"},
+								Body: App{
+									Fn:  App{Fn: Var{Name: "f"}, Arg: Var{Name: "x"}},
+									Arg: Var{Name: "k2"},
+								},
+							},
+						},
+					},
+					Body: App{
+						Fn:  App{Fn: Var{Name: "f"}, Arg: Int{Value: 1}},
+						Arg: Var{Name: "k"},
+					},
+				},
+			},
+		},
+		{
+			// app(f, x) = f(x) would be eta reduced to app = f, which is not a function of two arguments
+			name: "fix-no-eta",
+			in: Fix{
+				Vars: []Var{{Name: "app"}},
+				Fns: []Abs{
+					{
+						Var: Var{Name: "f"},
+						Body: Abs{
+							Var: Var{Name: "x"},
+							Body: Abs{
+								Var: Var{Name: "k"},
+								Body: App{
+									Fn:  App{Fn: Var{Name: "f"}, Arg: Var{Name: "x"}},
+									Arg: Var{Name: "k"},
+								},
+							},
+						},
+					},
+				},
+				Body: App{Fn: Var{Name: "app"}, Arg: Var{Name: "g"}},
+			},
+			out: Fix{
+				Vars: []Var{{Name: "app"}},
+				Fns: []Abs{
+					{
+						Var: Var{Name: "f"},
+						Body: Abs{
+							Var: Var{Name: "x"},
+							Body: Abs{
+								Var: Var{Name: "k"},
+								Body: App{
+									Fn:  App{Fn: Var{Name: "f"}, Arg: Var{Name: "x"}},
+									Arg: Var{Name: "k"},
+								},
+							},
+						},
+					},
+				},
+				Body: App{Fn: Var{Name: "app"}, Arg: Var{Name: "g"}},
+			},
+		},
+		{
+			name: "unused-fix",
+			in: Fix{
+				Vars: []Var{{Name: "f"}},
+				Fns: []Abs{
+					{
+						Var:  Var{Name: "x"},
+						Body: App{Fn: Var{Name: "f"}, Arg: Var{Name: "x"}},
+					},
+				},
+				Body: App{Fn: Var{Name: "k"}, Arg: Int{Value: 1}},
+			},
+			out: App{Fn: Var{Name: "k"}, Arg: Int{Value: 1}},
+		},
+		{
+			name: "capture",
+			in: App{
+				Fn: Abs{
+					Var: Var{Name: "x"},
+					Body: Abs{
+						Var: Var{Name: "y"},
+						Body: App{
+							Fn:  Var{Name: "k"},
+							Arg: Prim{Op: prim.Add, Args: []Expr{Var{Name: "x"}, Var{Name: "y"}}},
+						},
+					},
+				},
+				Arg: Var{Name: "y"},
+			},
+			out: App{
+				Fn: Abs{
+					Var: Var{Name: "x"},
+					Body: Abs{
+						Var: Var{Name: "y"},
+						Body: App{
+							Fn:  Var{Name: "k"},
+							Arg: Prim{Op: prim.Add, Args: []Expr{Var{Name: "x"}, Var{Name: "y"}}},
+						},
+					},
+				},
+				Arg: Var{Name: "y"},
+			},
+		},
 		{
 			name: "eta-invalid",
 			in: App{
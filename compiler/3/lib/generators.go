@@ -0,0 +1,52 @@
+package lib
+
+// Generators is a library of generators and the combinators over them.
+//
+// A generator is a function of no arguments that signals yield(x) for each of its elements in turn.
+// There is no unit value, so consumers resume it with 0. The combinators are handlers for yield:
+//
+//	range(from, to)  the integers from from up to but not including to
+//	count(from)      the integers from from upwards, without end
+//	map(f, g)        f applied to the elements of g
+//	filter(p, g)     the elements of g for which p holds
+//	take(n, g)       the first n elements of g, after which g is abandoned
+//	toList(g)        a list of the elements of g
+//
+// The handlers of range, count, map and filter resume in tail position, so they run in place where
+// yield is signalled, without capturing anything. A pipeline of them is a loop that calls each stage
+// in turn. Only consumers that need the rest of the generator as a value, such as take and toList,
+// capture it, and then only up to their own handler.
+const Generators = `
+data list(a) = nil | cons(a, list(a))
+
+letrec
+	range(from, to) = fun() { rangeFrom(from, to) };
+	rangeFrom(i, to) = if i < to { signal yield(i) + rangeFrom(i + 1, to) } else { 0 };
+
+	count(from) = fun() { countFrom(from) };
+	countFrom(i) = signal yield(i) + countFrom(i + 1);
+
+	map(f, g) = fun() {
+		handle { g() } with { yield(x) -> resume(signal yield(f(x))) }
+	};
+
+	filter(p, g) = fun() {
+		handle { g() } with {
+			yield(x) -> if p(x) { resume(signal yield(x)) } else { resume(0) }
+		}
+	};
+
+	take(n, g) = fun() {
+		(handle { g() } with {
+			yield(x) -> fun(left) {
+				if left == 0 { 0 } else { signal yield(x) + resume(0)(left - 1) }
+			};
+			return(r) -> fun(left) { 0 }
+		})(n)
+	};
+
+	toList(g) = handle { g() } with {
+		yield(x) -> cons(x, resume(0));
+		return(r) -> nil
+	}
+`
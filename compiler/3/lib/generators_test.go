@@ -0,0 +1,144 @@
+package lib_test
+
+import (
+	"testing"
+
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/host"
+	"github.com/bobappleyard/goose/lib"
+	"github.com/bobappleyard/goose/prim"
+)
+
+// digits reads a list of numbers under 100 as the digits of a number in base 100, after a leading 1.
+const digits = `
+letrec
+	digits(l) = number(l, 1);
+	number(l, n) = match l { nil -> n; cons(x, rest) -> number(rest, n * 100 + x) }
+`
+
+func TestGenerators(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+		out  int
+	}{
+		{
+			name: "toList",
+			in:   "digits(toList(range(0, 3)))",
+			out:  1000102,
+		},
+		{
+			name: "empty",
+			in:   "digits(toList(range(3, 0)))",
+			out:  1,
+		},
+		{
+			name: "map",
+			in:   "digits(toList(map(fun(x) { x * x }, range(1, 4))))",
+			out:  1010409,
+		},
+		{
+			name: "filter",
+			in:   "digits(toList(filter(fun(x) { x * x < 20 }, range(0, 7))))",
+			out:  10001020304,
+		},
+		{
+			name: "takeWithoutEnd",
+			in:   "digits(toList(take(3, map(fun(x) { x * 10 }, count(1)))))",
+			out:  1102030,
+		},
+		{
+			name: "takeMore",
+			in:   "digits(toList(take(5, range(0, 2))))",
+			out:  10001,
+		},
+		{
+			name: "effectsPassThrough",
+			in: `
+				handle {
+					digits(toList(map(fun(x) { x + signal offset() }, range(0, 2))))
+				} with {
+					offset() -> resume(10)
+				}
+			`,
+			out: 11011,
+		},
+		{
+			name: "loop",
+			in: `
+				letrec sum(l) = match l { nil -> 0; cons(x, rest) -> x + sum(rest) } in
+				sum(toList(filter(fun(x) { x < 500 }, map(fun(x) { x * 2 }, range(0, 1000)))))
+			`,
+			out: 62250,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := lib.Parse(test.in, lib.Generators, digits)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := handler.Eval(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != prim.Int(test.out) {
+				t.Errorf("interpreter: got %s, expecting %d", v, test.out)
+			}
+
+			p, err := host.CompileExpr(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err = bc.Eval(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != prim.Int(test.out) {
+				t.Errorf("bc: got %s, expecting %d", v, test.out)
+			}
+		})
+	}
+}
+
+// TestGeneratorsInThreads runs generators in threads that yield to one another, so that the yield of
+// a generator and that of the scheduler are both signalled.
+func TestGeneratorsInThreads(t *testing.T) {
+	e, err := lib.Parse(`
+		letrec
+			slowly(g) = fun() {
+				handle { g() } with { yield(x) -> resume(signal thread.yield() + signal yield(x)) }
+			};
+			sum(l) = match l { nil -> 0; cons(x, rest) -> x + sum(rest) }
+		in
+		(fun(a, b) { signal thread.await(a) * 1000 + signal thread.await(b) })(
+			signal thread.fork(fun() { sum(toList(slowly(range(0, 10)))) }),
+			signal thread.fork(fun() { sum(toList(slowly(map(fun(x) { x * x }, range(0, 10))))) })
+		)
+	`, lib.Generators)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := host.CompileExpr(e, cps.Concurrency...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := bc.Eval(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != prim.Int(45285) {
+		t.Errorf("got %s, expecting 45285", v)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := lib.Parse("letrec f(x) = x", lib.Generators); err == nil || err.Error() != "expecting an expression: got a declaration" {
+		t.Errorf("got %v, expecting a declaration to be rejected", err)
+	}
+	if _, err := lib.Parse("toList(range(0, 1))", "1 + 2"); err == nil {
+		t.Error("expecting a library that is not a declaration to be rejected")
+	}
+}
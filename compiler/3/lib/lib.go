@@ -0,0 +1,51 @@
+// Libraries written in the language itself, as declarations that programs are parsed within.
+package lib
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bobappleyard/goose/handler"
+)
+
+var errNoBody = errors.New("expecting an expression")
+
+// Parse parses src with the declarations of libs in scope.
+func Parse(src string, libs ...string) (handler.Expr, error) {
+	decls, err := Declarations(libs...)
+	if err != nil {
+		return nil, err
+	}
+	e, err := handler.ParseTopLevel(src, decls)
+	if err != nil {
+		return nil, err
+	}
+	if declaration(e) {
+		return nil, fmt.Errorf("%w: got a declaration", errNoBody)
+	}
+	return handler.Wrap(decls, e), nil
+}
+
+// Declarations parses the declarations of libs. Each library may refer to the declarations of those
+// before it.
+func Declarations(libs ...string) ([]handler.Expr, error) {
+	var decls []handler.Expr
+	for _, l := range libs {
+		ds, err := handler.ParseDecls(l, decls)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, ds...)
+	}
+	return decls, nil
+}
+
+func declaration(e handler.Expr) bool {
+	switch e := e.(type) {
+	case handler.Data:
+		return e.Body == nil
+	case handler.LetRec:
+		return e.Body == nil
+	}
+	return false
+}
@@ -1,55 +1,162 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 
-	"github.com/bobappleyard/goose/b2c"
-	"github.com/bobappleyard/goose/c2l"
-	"github.com/bobappleyard/goose/h2c"
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/cont"
 	"github.com/bobappleyard/goose/handler"
-	"github.com/bobappleyard/goose/l2b"
+	"github.com/bobappleyard/goose/host"
 	"github.com/bobappleyard/goose/lc"
 )
 
+var errJSONAndDot = errors.New("cannot write both JSON and Graphviz")
+
 func main() {
-	h := handler.Handle{
-		Eval: handler.Apply{Fn: handler.Var{Name: "effectful"}, Arg: handler.Var{Name: "x"}},
-		Handlers: []handler.EffectHandler{
-			{
-				Effect: "effect",
-				Var:    "arg",
-				Body: handler.Apply{
-					Arg: handler.Resume{With: handler.Var{Name: "arg"}},
-					Fn: handler.Lambda{
-						Var:  "res",
-						Body: handler.Apply{Fn: handler.Var{Name: "f"}, Arg: handler.Var{Name: "res"}},
-					},
-				},
-			},
-		},
-	}
-
-	// h := handler.Resume{With: handler.Var{Name: "arg"}}
-
-	// h := handler.Apply{Fn: handler.Var{Name: "effectful"}, Arg: handler.Var{Name: "x"}}
-
-	c, err := h2c.ConvertExpr(h, false)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "repl":
+			runRepl(os.Args[2:])
+			return
+		case "debug":
+			runDebug(os.Args[2:])
+			return
+		case "run":
+			runRun(os.Args[2:])
+			return
+		}
+	}
+
+	dumpAfter := flag.String("dump-after", "", "comma-separated passes whose output is written to stderr")
+	stopAfter := flag.String("stop-after", "", "the last pass to run")
+	skip := flag.String("skip", "", "comma-separated optional passes not to run, such as reduce")
+	stats := flag.Bool("stats", false, "write the time taken by each pass and the size of its output to stderr")
+	asJSON := flag.Bool("json", false, "read the program and write its representations as JSON")
+	asDot := flag.Bool("dot", false, "write lambda terms and bytecode as Graphviz graphs")
+	types := flag.Bool("types", false, "write the principal types of the top-level bindings and of the program to stderr")
+	flag.Parse()
+	if *asJSON && *asDot {
+		fail(errJSONAndDot)
+	}
+
+	src, err := readSource(flag.Arg(0))
 	if err != nil {
-		panic(err)
+		fail(err)
+	}
+	var h handler.Expr
+	if *asJSON {
+		h, err = handler.UnmarshalExpr([]byte(src))
+	} else {
+		h, err = handler.Parse(src)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if errs := handler.Check(h); len(errs) != 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+	inf, err := handler.Infer(h)
+	if err != nil {
+		fail(err)
+	}
+	if *types {
+		fmt.Fprintln(os.Stderr, inf)
+	}
+
+	m := host.Pipeline()
+	m.Dump = os.Stderr
+	m.StopAfter = *stopAfter
+	m.Size = size
+	if *asDot {
+		m.Format = writeDot
+	}
+	if *asJSON {
+		m.Format = writeJSON
+	}
+	if *dumpAfter != "" {
+		m.DumpAfter = strings.Split(*dumpAfter, ",")
+	}
+	if *skip != "" {
+		m.Skip = strings.Split(*skip, ",")
 	}
 
-	// c := cont.WithSubCont{
-	// 	Prompt: cont.Var{Name: "prompt"},
-	// 	Fn: cont.Lambda{
-	// 		Var:  "x",
-	// 		Body: cont.Var{Name: "y"},
-	// 	},
-	// }
+	out, err := m.Run(h)
+	if *stats {
+		m.WriteStats(os.Stderr)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if m.Format != nil {
+		err = m.Format(os.Stdout, out)
+	} else {
+		_, err = fmt.Println(out)
+	}
+	if err != nil {
+		fail(err)
+	}
+}
 
-	l, err := c2l.ConvertExpr(c)
+// writeJSON writes a representation of the program as indented JSON. C is written as a string.
+func writeJSON(w io.Writer, ir interface{}) error {
+	bs, err := json.MarshalIndent(ir, "", "  ")
 	if err != nil {
-		panic(err)
+		return err
 	}
+	_, err = fmt.Fprintf(w, "%s\n", bs)
+	return err
+}
+
+// size measures the output of a pass. C is measured in lines.
+func size(ir interface{}) int {
+	switch ir := ir.(type) {
+	case handler.Expr:
+		return handler.Size(ir)
+	case cont.Expr:
+		return cont.Size(ir)
+	case lc.Expr:
+		return lc.Size(ir)
+	case bc.Program:
+		return ir.Size()
+	case string:
+		return strings.Count(ir, "\n")
+	}
+	return 0
+}
+
+// writeDot writes lambda terms and bytecode as graphs, and everything else as text.
+func writeDot(w io.Writer, ir interface{}) error {
+	switch ir := ir.(type) {
+	case lc.Expr:
+		return lc.WriteDot(w, ir)
+	case bc.Program:
+		return bc.WriteDot(w, ir)
+	}
+	_, err := fmt.Fprintln(w, ir)
+	return err
+}
+
+// readSource reads the program from the named file, or from stdin if there is no name.
+func readSource(name string) (string, error) {
+	if name == "" {
+		bs, err := ioutil.ReadAll(os.Stdin)
+		return string(bs), err
+	}
+	bs, err := ioutil.ReadFile(name)
+	return string(bs), err
+}
 
-	b2c.ConvertProgram(l2b.ConvertProgram(lc.Reduce(l)), os.Stdout)
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/cont"
+	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/host"
+	"github.com/bobappleyard/goose/lc"
+	"github.com/bobappleyard/goose/prim"
+)
+
+// FuzzPipeline generates programs and checks that the output of every pass that can be run gives
+// the same result as the reference interpreter, both with and without the optional reduction.
+func FuzzPipeline(f *testing.F) {
+	for seed := int64(0); seed < 100; seed++ {
+		f.Add(seed, uint8(30))
+	}
+	f.Fuzz(func(t *testing.T, seed int64, size uint8) {
+		h := handler.Generate(rand.New(rand.NewSource(seed)), int(size%64))
+		want, err := handler.Eval(h)
+		if err != nil {
+			t.Fatalf("reference: %v\n%s", err, h)
+		}
+
+		for _, skip := range [][]string{nil, {"reduce"}} {
+			for _, name := range []string{"h2c", "c2l", "reduce", "l2b"} {
+				m := host.Pipeline()
+				m.StopAfter = name
+				m.Skip = skip
+				ir, err := m.Run(h)
+				if err != nil {
+					t.Fatalf("%v\n%s", err, h)
+				}
+				got, err := eval(ir)
+				if err != nil {
+					t.Fatalf("after %s skipping %v: %v\n%s", name, skip, err, h)
+				}
+				if got != want {
+					t.Fatalf("after %s skipping %v: got %s, expecting %s\n%s", name, skip, got, want, h)
+				}
+			}
+		}
+	})
+}
+
+// TestPipeline checks programs that the generator does not produce in the same way as FuzzPipeline.
+func TestPipeline(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   string
+	}{
+		{
+			name: "passArgumentOn",
+			in:   "letrec app(f, x) = f(x) in app(fun(y) { y + 1 }, 1)",
+		},
+		{
+			name: "passArgumentOnNotInTail",
+			in:   "letrec app(f, x) = f(x) in app(fun(y) { y }, 4) + 1",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h, err := handler.Parse(test.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := handler.Eval(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"h2c", "c2l", "reduce", "l2b"} {
+				m := host.Pipeline()
+				m.StopAfter = name
+				ir, err := m.Run(h)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := eval(ir)
+				if err != nil {
+					t.Fatalf("after %s: %v", name, err)
+				}
+				if got != want {
+					t.Errorf("after %s: got %s, expecting %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestJSON checks that every representation of generated programs survives being written as JSON
+// and read back.
+func TestJSON(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		h := handler.Generate(rand.New(rand.NewSource(seed)), 30)
+		checkJSON(t, h)
+
+		for _, name := range []string{"h2c", "c2l", "reduce", "l2b"} {
+			m := host.Pipeline()
+			m.StopAfter = name
+			ir, err := m.Run(h)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, h)
+			}
+			checkJSON(t, ir)
+		}
+	}
+}
+
+func checkJSON(t *testing.T, ir interface{}) {
+	t.Helper()
+
+	bs, err := json.Marshal(ir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	switch ir.(type) {
+	case handler.Expr:
+		out, err = handler.UnmarshalExpr(bs)
+	case cont.Expr:
+		out, err = cont.UnmarshalExpr(bs)
+	case lc.Expr:
+		out, err = lc.UnmarshalExpr(bs)
+	case bc.Program:
+		var p bc.Program
+		err = json.Unmarshal(bs, &p)
+		out = p
+	}
+	if err != nil {
+		t.Fatalf("%v\n%s", err, bs)
+	}
+	if !reflect.DeepEqual(out, ir) {
+		t.Errorf("got %v, expecting %v", out, ir)
+	}
+}
+
+func eval(ir interface{}) (prim.Value, error) {
+	switch ir := ir.(type) {
+	case cont.Expr:
+		return cont.Eval(ir)
+	case lc.Expr:
+		return lc.Eval(ir)
+	case bc.Program:
+		return bc.Eval(ir)
+	}
+	panic("unreachable")
+}
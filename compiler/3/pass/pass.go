@@ -0,0 +1,169 @@
+// Passes over the program, run in order by a manager that can show what each of them produces.
+package pass
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+var errUnknownPass = errors.New("unknown pass")
+var errNotOptional = errors.New("pass cannot be skipped")
+
+// Pass is a stage of the compiler, turning one representation of the program into the next.
+type Pass struct {
+	Name string
+	Run  func(ir interface{}) (interface{}, error)
+
+	// Optional passes produce the same representation that they are given, so they may be skipped.
+	Optional bool
+}
+
+// Stat records how long a pass took and the size of what it produced.
+type Stat struct {
+	Pass string
+	Time time.Duration
+	Size int
+}
+
+// Manager runs passes in the order that they are registered.
+type Manager struct {
+	passes []Pass
+
+	// DumpAfter names the passes whose output is written to Dump.
+	DumpAfter []string
+	Dump      io.Writer
+
+	// Format writes the output of a pass for a dump. If it is nil, the output is written as text.
+	Format func(w io.Writer, ir interface{}) error
+
+	// StopAfter names the last pass to run. If it is empty, every pass runs.
+	StopAfter string
+
+	// Skip names optional passes not to run. Their input is passed on unchanged.
+	Skip []string
+
+	// Size measures the output of a pass for the statistics. If it is nil, sizes are not recorded.
+	Size func(ir interface{}) int
+
+	// Stats has an entry for every pass that has run.
+	Stats []Stat
+}
+
+func (m *Manager) Register(name string, run func(ir interface{}) (interface{}, error)) {
+	m.passes = append(m.passes, Pass{Name: name, Run: run})
+}
+
+// RegisterOptional registers a pass that may be skipped.
+func (m *Manager) RegisterOptional(name string, run func(ir interface{}) (interface{}, error)) {
+	m.passes = append(m.passes, Pass{Name: name, Run: run, Optional: true})
+}
+
+// Names lists the passes in the order they run.
+func (m *Manager) Names() []string {
+	names := make([]string, len(m.passes))
+	for i, p := range m.passes {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func (m *Manager) has(name string) bool {
+	_, ok := m.find(name)
+	return ok
+}
+
+func (m *Manager) find(name string) (Pass, bool) {
+	for _, p := range m.passes {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Pass{}, false
+}
+
+func (m *Manager) skipped(name string) bool {
+	for _, s := range m.Skip {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Run passes ir through each pass in turn, returning what the last one produced.
+func (m *Manager) Run(ir interface{}) (interface{}, error) {
+	for _, name := range append([]string{m.StopAfter}, m.DumpAfter...) {
+		if name != "" && !m.has(name) {
+			return nil, fmt.Errorf("%w: %s (expecting one of %v)", errUnknownPass, name, m.Names())
+		}
+	}
+	for _, name := range m.Skip {
+		p, ok := m.find(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s (expecting one of %v)", errUnknownPass, name, m.Names())
+		}
+		if !p.Optional {
+			return nil, fmt.Errorf("%w: %s", errNotOptional, name)
+		}
+	}
+
+	for _, p := range m.passes {
+		if m.skipped(p.Name) {
+			if p.Name == m.StopAfter {
+				break
+			}
+			continue
+		}
+
+		start := time.Now()
+		out, err := p.Run(ir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Name, err)
+		}
+		stat := Stat{Pass: p.Name, Time: time.Since(start)}
+		if m.Size != nil {
+			stat.Size = m.Size(out)
+		}
+		m.Stats = append(m.Stats, stat)
+		ir = out
+
+		for _, name := range m.DumpAfter {
+			if name != p.Name {
+				continue
+			}
+			if err := m.dump(name, ir); err != nil {
+				return nil, err
+			}
+		}
+		if p.Name == m.StopAfter {
+			break
+		}
+	}
+
+	return ir, nil
+}
+
+func (m *Manager) dump(name string, ir interface{}) error {
+	fmt.Fprintf(m.Dump, "// after %s\n", name)
+	if m.Format == nil {
+		_, err := fmt.Fprintf(m.Dump, "%v\n", ir)
+		return err
+	}
+	return m.Format(m.Dump, ir)
+}
+
+// WriteStats writes a table of the statistics recorded so far.
+func (m *Manager) WriteStats(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "pass\ttime\tsize")
+	var total time.Duration
+	for _, s := range m.Stats {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", s.Pass, s.Time, s.Size)
+		total += s.Time
+	}
+	fmt.Fprintf(tw, "total\t%s\n", total)
+	return tw.Flush()
+}
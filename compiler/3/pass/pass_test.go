@@ -0,0 +1,136 @@
+package pass
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testManager(trace *[]string) *Manager {
+	m := &Manager{Size: func(ir interface{}) int { return ir.(int) }}
+	for _, name := range []string{"double", "inc", "square"} {
+		name := name
+		register := m.Register
+		if name == "inc" {
+			register = m.RegisterOptional
+		}
+		register(name, func(ir interface{}) (interface{}, error) {
+			*trace = append(*trace, name)
+			n := ir.(int)
+			switch name {
+			case "double":
+				return 2 * n, nil
+			case "inc":
+				return n + 1, nil
+			}
+			return n * n, nil
+		})
+	}
+	return m
+}
+
+func TestRun(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		stopAfter string
+		dumpAfter []string
+		skip      []string
+		out       int
+		trace     []string
+		dump      string
+		err       error
+	}{
+		{
+			name:  "all",
+			out:   49,
+			trace: []string{"double", "inc", "square"},
+		},
+		{
+			name:      "stop",
+			stopAfter: "inc",
+			out:       7,
+			trace:     []string{"double", "inc"},
+		},
+		{
+			name:      "dump",
+			dumpAfter: []string{"square", "double"},
+			out:       49,
+			trace:     []string{"double", "inc", "square"},
+			dump:      "// after double\n6\n// after square\n49\n",
+		},
+		{
+			name:  "skip",
+			skip:  []string{"inc"},
+			out:   36,
+			trace: []string{"double", "square"},
+		},
+		{
+			name:      "unknownStop",
+			stopAfter: "halve",
+			err:       errUnknownPass,
+		},
+		{
+			name:      "unknownDump",
+			dumpAfter: []string{"halve"},
+			err:       errUnknownPass,
+		},
+		{
+			name: "unknownSkip",
+			skip: []string{"halve"},
+			err:  errUnknownPass,
+		},
+		{
+			name: "notOptional",
+			skip: []string{"square"},
+			err:  errNotOptional,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var trace []string
+			var dump strings.Builder
+			m := testManager(&trace)
+			m.StopAfter = test.stopAfter
+			m.DumpAfter = test.dumpAfter
+			m.Skip = test.skip
+			m.Dump = &dump
+
+			out, err := m.Run(3)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, expecting %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if out != test.out {
+				t.Errorf("got %v, expecting %d", out, test.out)
+			}
+			if !reflect.DeepEqual(trace, test.trace) {
+				t.Errorf("got %v, expecting %v", trace, test.trace)
+			}
+			if dump.String() != test.dump {
+				t.Errorf("got %q, expecting %q", dump.String(), test.dump)
+			}
+			var sizes []int
+			for _, s := range m.Stats {
+				sizes = append(sizes, s.Size)
+			}
+			if len(sizes) != len(test.trace) || sizes[len(sizes)-1] != test.out {
+				t.Errorf("got sizes %v", sizes)
+			}
+		})
+	}
+}
+
+func TestRunError(t *testing.T) {
+	errFailed := errors.New("failed")
+	m := &Manager{}
+	m.Register("fail", func(ir interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("%w: always", errFailed)
+	})
+	_, err := m.Run(nil)
+	if !errors.Is(err, errFailed) || !strings.HasPrefix(err.Error(), "fail: ") {
+		t.Errorf("got %v", err)
+	}
+}
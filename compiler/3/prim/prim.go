@@ -0,0 +1,66 @@
+// Primitive operations shared by every stage of the pipeline.
+package prim
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownOp = errors.New("unknown operation")
+
+type Op int
+
+const (
+	Add Op = iota
+	Sub
+	Mul
+	Cmp
+	Eq
+	Lt
+)
+
+// Booleans are constructors without fields, so they are represented by their tags.
+const (
+	False = 0
+	True  = 1
+)
+
+var names = []string{
+	Add: "add",
+	Sub: "sub",
+	Mul: "mul",
+	Cmp: "cmp",
+	Eq:  "eq",
+	Lt:  "lt",
+}
+
+// Arity is the number of operands the operation takes.
+func (o Op) Arity() int {
+	return 2
+}
+
+func (o Op) String() string {
+	if o < 0 || int(o) >= len(names) {
+		return fmt.Sprintf("op%d", int(o))
+	}
+	return names[o]
+}
+
+// MarshalText writes the name of the operation.
+func (o Op) MarshalText() ([]byte, error) {
+	if o < 0 || int(o) >= len(names) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownOp, o)
+	}
+	return []byte(names[o]), nil
+}
+
+// UnmarshalText reads the name of an operation.
+func (o *Op) UnmarshalText(text []byte) error {
+	for i, name := range names {
+		if name == string(text) {
+			*o = Op(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownOp, text)
+}
@@ -0,0 +1,134 @@
+package prim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrType = errors.New("type error")
+var ErrNoEntry = errors.New("no entry in object")
+
+// Value is the result of a computation. Integers, constructed values and objects are shared by every
+// evaluator, while functions are specific to each one.
+type Value interface {
+	String() string
+}
+
+type Int int
+
+// Con is a constructed value. Name is for display only.
+type Con struct {
+	Tag    int
+	Name   string
+	Fields []Value
+}
+
+// Object maps selectors to values. Handler objects map effects to their handlers in this way.
+type Object struct {
+	entries *entry
+}
+
+type entry struct {
+	key   string
+	value Value
+	next  *entry
+}
+
+func Bool(b bool) Con {
+	if b {
+		return Con{Tag: True, Name: "true"}
+	}
+	return Con{Tag: False, Name: "false"}
+}
+
+func (i Int) String() string {
+	return fmt.Sprint(int(i))
+}
+
+func (c Con) String() string {
+	name := c.Name
+	if name == "" {
+		name = fmt.Sprintf("#%d", c.Tag)
+	}
+	if len(c.Fields) == 0 {
+		return name
+	}
+	fields := make([]string, len(c.Fields))
+	for i, f := range c.Fields {
+		fields[i] = f.String()
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(fields, ", "))
+}
+
+// Extend returns an object that maps key to value, with all other keys mapped as in o.
+func (o Object) Extend(key string, value Value) Object {
+	return Object{entries: &entry{key: key, value: value, next: o.entries}}
+}
+
+func (o Object) Select(key string) (Value, error) {
+	for e := o.entries; e != nil; e = e.next {
+		if e.key == key {
+			return e.value, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoEntry, key)
+}
+
+// Entries lists the keys and values of o, the most recently added first. Keys that have been
+// extended more than once appear each time, so that o can be rebuilt exactly.
+func (o Object) Entries() ([]string, []Value) {
+	var keys []string
+	var values []Value
+	for e := o.entries; e != nil; e = e.next {
+		keys = append(keys, e.key)
+		values = append(values, e.value)
+	}
+	return keys, values
+}
+
+func (o Object) String() string {
+	var keys []string
+	for e := o.entries; e != nil; e = e.next {
+		keys = append(keys, e.key)
+	}
+	return fmt.Sprintf("{%s}", strings.Join(keys, " "))
+}
+
+// Apply performs the operation on the arguments given.
+func (o Op) Apply(args []Value) (Value, error) {
+	if len(args) != o.Arity() {
+		return nil, fmt.Errorf("%w: %s takes %d arguments, got %d", ErrType, o, o.Arity(), len(args))
+	}
+	x, ok := args[0].(Int)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s expects an integer, got %s", ErrType, o, args[0])
+	}
+	y, ok := args[1].(Int)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s expects an integer, got %s", ErrType, o, args[1])
+	}
+
+	switch o {
+	case Add:
+		return x + y, nil
+	case Sub:
+		return x - y, nil
+	case Mul:
+		return x * y, nil
+	case Cmp:
+		switch {
+		case x < y:
+			return Int(-1), nil
+		case x > y:
+			return Int(1), nil
+		}
+		return Int(0), nil
+	case Eq:
+		return Bool(x == y), nil
+	case Lt:
+		return Bool(x < y), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownOp, o)
+}
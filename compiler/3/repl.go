@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/handler"
+	"github.com/bobappleyard/goose/host"
+	"github.com/bobappleyard/goose/lib"
+	"github.com/bobappleyard/goose/prim"
+)
+
+const replHelp = `Enter an expression to evaluate it, or a declaration to keep it for later entries:
+
+    data name(params) = constructor | ...
+    letrec name(params) = expr; ...
+
+The generators of package lib, such as range, map and toList, are declared already.
+
+Commands show how the last expression is compiled:
+
+    :cont  after h2c
+    :lc    after c2l and reduce
+    :bc    after l2b
+    :c     after b2c
+    :help  show this message
+    :quit  leave
+`
+
+var (
+	errUnknownCommand   = errors.New("unknown command")
+	errNothingEvaluated = errors.New("no expression has been evaluated")
+)
+
+// commands map the commands that show a stage of the pipeline to the pass producing it.
+var commands = map[string]string{
+	":cont": "h2c",
+	":lc":   "reduce",
+	":bc":   "l2b",
+	":c":    "b2c",
+}
+
+func runRepl(args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	vm := flags.Bool("vm", false, "evaluate with the bytecode virtual machine rather than the reference interpreter")
+	flags.Parse(args)
+
+	r, err := newRepl(os.Stdout, *vm)
+	if err != nil {
+		fail(err)
+	}
+	if err := r.run(os.Stdin); err != nil {
+		fail(err)
+	}
+}
+
+// repl evaluates the entries in a session, keeping the declarations for later entries.
+type repl struct {
+	out   io.Writer
+	vm    bool
+	decls []handler.Expr
+	last  handler.Expr
+}
+
+// newRepl starts a session with the declarations of lib.Generators.
+func newRepl(out io.Writer, vm bool) (*repl, error) {
+	decls, err := lib.Declarations(lib.Generators)
+	if err != nil {
+		return nil, err
+	}
+	return &repl{out: out, vm: vm, decls: decls}, nil
+}
+
+func (r *repl) run(in io.Reader) error {
+	lines := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(r.out, "> ")
+		if !lines.Scan() {
+			fmt.Fprintln(r.out)
+			return lines.Err()
+		}
+		if !r.entry(strings.TrimSpace(lines.Text())) {
+			return nil
+		}
+	}
+}
+
+// entry handles a line of input, reporting whether the session should continue.
+func (r *repl) entry(line string) bool {
+	switch {
+	case line == "":
+		return true
+
+	case line == ":quit":
+		return false
+
+	case line == ":help":
+		fmt.Fprint(r.out, replHelp)
+		return true
+
+	case strings.HasPrefix(line, ":"):
+		r.command(line)
+		return true
+	}
+
+	e, err := handler.ParseTopLevel(line, r.decls)
+	if err != nil {
+		r.report(err)
+		return true
+	}
+	switch d := e.(type) {
+	case handler.Data:
+		if d.Body == nil {
+			r.declare(d)
+			return true
+		}
+	case handler.LetRec:
+		if d.Body == nil {
+			r.declare(d)
+			return true
+		}
+	}
+	r.eval(handler.Wrap(r.decls, e))
+	return true
+}
+
+func (r *repl) report(err error) {
+	fmt.Fprintf(r.out, "error: %v\n", err)
+}
+
+// check reports any problems with e, returning its types if there are none.
+func (r *repl) check(e handler.Expr) (handler.Inference, bool) {
+	if errs := handler.Check(e); len(errs) != 0 {
+		for _, err := range errs {
+			r.report(err)
+		}
+		return handler.Inference{}, false
+	}
+	inf, err := handler.Infer(e)
+	if err != nil {
+		r.report(err)
+		return handler.Inference{}, false
+	}
+	return inf, true
+}
+
+// declare keeps d if it is valid, showing the types of any functions it binds.
+func (r *repl) declare(d handler.Expr) {
+	decls := append(append([]handler.Expr(nil), r.decls...), d)
+	inf, ok := r.check(handler.Wrap(decls, handler.Int{}))
+	if !ok {
+		return
+	}
+	r.decls = decls
+
+	lr, ok := d.(handler.LetRec)
+	if !ok {
+		return
+	}
+	// The new bindings are the last ones, shadowing any earlier ones with the same names.
+	for _, t := range inf.Bindings[len(inf.Bindings)-len(lr.Bindings):] {
+		fmt.Fprintf(r.out, "%s : %s\n", t.Name, t.Type)
+	}
+}
+
+func (r *repl) eval(e handler.Expr) {
+	inf, ok := r.check(e)
+	if !ok {
+		return
+	}
+	r.last = e
+
+	var v prim.Value
+	var err error
+	if r.vm {
+		var p interface{}
+		if p, err = r.stage("l2b"); err == nil {
+			v, err = bc.Eval(p.(bc.Program))
+		}
+	} else {
+		v, err = handler.Eval(e)
+	}
+	if err != nil {
+		r.report(err)
+		return
+	}
+	fmt.Fprintf(r.out, "%s : %s\n", v, inf.Type)
+}
+
+func (r *repl) command(line string) {
+	pass, ok := commands[line]
+	if !ok {
+		r.report(fmt.Errorf("%w %s, try :help", errUnknownCommand, line))
+		return
+	}
+	if r.last == nil {
+		r.report(errNothingEvaluated)
+		return
+	}
+	out, err := r.stage(pass)
+	if err != nil {
+		r.report(err)
+		return
+	}
+	fmt.Fprintln(r.out, strings.TrimRight(fmt.Sprint(out), "\n"))
+}
+
+// stage compiles the last expression as far as the pass given.
+func (r *repl) stage(pass string) (interface{}, error) {
+	m := host.Pipeline()
+	m.StopAfter = pass
+	return m.Run(r.last)
+}
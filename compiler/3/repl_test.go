@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepl(t *testing.T) {
+	for _, vm := range []bool{false, true} {
+		var out strings.Builder
+		r, err := newRepl(&out, vm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.run(strings.NewReader(strings.Join([]string{
+			"data opt = none | some(int)",
+			"letrec get(o) = match o { none -> 0; some(x) -> x }",
+			"get(some(41)) + 1",
+			"handle { 1 + signal ask() } with { ask() -> resume(2) }",
+			"signal ask()",
+			"match toList(map(fun(x) { x * 2 }, range(1, 3))) { nil -> 0; cons(x, rest) -> x }",
+			"nope",
+			":foo",
+			":quit",
+			"2",
+		}, "\n")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Join([]string{
+			"> > get : (opt) -{e}-> int",
+			"> 42 : int",
+			"> 3 : int",
+			"> error: 1:1: unhandled effect: ask",
+			"> 2 : int",
+			"> error: unbound variable: nope",
+			"> error: unknown command :foo, try :help",
+			"> ",
+		}, "\n")
+		if out.String() != want {
+			t.Errorf("vm=%v: got\n%s\nexpecting\n%s", vm, out.String(), want)
+		}
+	}
+}
+
+func TestReplStages(t *testing.T) {
+	var out strings.Builder
+	r := &repl{out: &out}
+	if err := r.run(strings.NewReader(":lc\n1 + 2\n:lc\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := "> error: no expression has been evaluated\n> 3 : int\n> λ#k1 · #k1 add(1, 2)\n> \n"
+	if out.String() != want {
+		t.Errorf("got %q, expecting %q", out.String(), want)
+	}
+}
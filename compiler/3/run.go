@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bobappleyard/goose/bc"
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/host"
+	"github.com/bobappleyard/goose/prim"
+)
+
+var errRecordAndReplay = errors.New("cannot record and replay at once")
+var errUnreplayed = errors.New("program finished before the end of the log")
+
+func runRun(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	record := flags.String("record", "", "write the effects handled by the host, and the values they resumed with, to a log")
+	replay := flags.String("replay", "", "a log written by -record, to take the values of effects from instead of the host")
+	flags.Parse(args)
+	if *record != "" && *replay != "" {
+		fail(errRecordAndReplay)
+	}
+
+	src, err := readSource(flags.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+
+	var effects cps.Host = host.Standard(os.Stdout, time.Now)
+	var replayer *cps.Replayer
+	switch {
+	case *record != "":
+		f, err := os.Create(*record)
+		if err != nil {
+			fail(err)
+		}
+		defer f.Close()
+		effects = cps.NewRecorder(effects, f)
+
+	case *replay != "":
+		f, err := os.Open(*replay)
+		if err != nil {
+			fail(err)
+		}
+		replayer, err = cps.NewReplayer(effects, f)
+		f.Close()
+		if err != nil {
+			fail(err)
+		}
+		effects = replayer
+	}
+
+	v, err := runProgram(src, effects)
+	if err != nil {
+		fail(err)
+	}
+	if replayer != nil && !replayer.Finished() {
+		fail(errUnreplayed)
+	}
+	fmt.Println(v)
+}
+
+// runProgram runs src on the bytecode virtual machine, with effects handling the effects that src
+// does not, apart from those of the runtime's scheduler.
+func runProgram(src string, effects cps.Host) (prim.Value, error) {
+	p, err := host.Compile(src, append(effects.Effects(), cps.Concurrency...)...)
+	if err != nil {
+		return nil, err
+	}
+	return bc.EvalHost(p, effects)
+}
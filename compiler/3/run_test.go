@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bobappleyard/goose/cps"
+	"github.com/bobappleyard/goose/host"
+	"github.com/bobappleyard/goose/prim"
+)
+
+// counter gives a host that resumes next with successive integers, starting after n.
+func counter(n int) *host.Host {
+	h := host.New()
+	h.Register("next", func(args []prim.Value) (prim.Value, error) {
+		n++
+		return prim.Int(n), nil
+	})
+	return h
+}
+
+func TestRecordReplay(t *testing.T) {
+	src := `
+		letrec sum(n) = if n == 0 { 0 } else { signal next() * 10 + sum(n - 1) } in
+		handle { sum(3) + signal ask() } with { ask() -> resume(signal next()) }
+	`
+
+	var log strings.Builder
+	v, err := runProgram(src, cps.NewRecorder(counter(0), &log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != prim.Int(64) {
+		t.Errorf("got %s, expecting 64", v)
+	}
+
+	// a fresh counter would give different values, but the log is followed instead
+	rep, err := cps.NewReplayer(counter(100), strings.NewReader(log.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = runProgram(src, rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != prim.Int(64) || !rep.Finished() {
+		t.Errorf("got %s, expecting 64 with the whole log replayed", v)
+	}
+}
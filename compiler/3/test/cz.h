@@ -1,3 +1,5 @@
+#include <stdint.h>
+
 typedef void *cz_value_t;
 
 typedef struct {
@@ -14,6 +16,9 @@ typedef struct {
 
 void cz_process_push(cz_process_t *p, cz_value_t x);
 void cz_process_call(cz_process_t *p, cz_value_t *base, int argc);
+void cz_process_con(cz_process_t *p, int tag, cz_value_t *base, int argc);
+void cz_process_switch(cz_process_t *p, cz_value_t *base, int argc);
+void cz_process_tie(cz_process_t *p, cz_value_t *base, int count);
 
 /* Opcodes */
 
@@ -24,4 +29,37 @@ void cz_process_call(cz_process_t *p, cz_value_t *base, int argc);
 #define CZ_PUSH_FN(base)    cz_process_push(p, p->frame + base)
 #define CZ_CALL(base, argc) cz_process_call(p, p->frame + base, argc)
 
+/* Integers are tagged immediates, distinguished from pointers by their low bit. */
+
+#define CZ_INT(n)           ((cz_value_t)(((intptr_t)(n) << 1) | 1))
+#define CZ_INT_VALUE(x)     ((intptr_t)(x) >> 1)
+#define CZ_ARG(base, i)     CZ_INT_VALUE(p->frame[base + i])
+
+#define CZ_PUSH_INT(n)      cz_process_push(p, CZ_INT(n))
+#define CZ_PUSH_ADD(base)   cz_process_push(p, CZ_INT(CZ_ARG(base, 0) + CZ_ARG(base, 1)))
+#define CZ_PUSH_SUB(base)   cz_process_push(p, CZ_INT(CZ_ARG(base, 0) - CZ_ARG(base, 1)))
+#define CZ_PUSH_MUL(base)   cz_process_push(p, CZ_INT(CZ_ARG(base, 0) * CZ_ARG(base, 1)))
+#define CZ_PUSH_CMP(base)   cz_process_push(p, CZ_INT((CZ_ARG(base, 0) > CZ_ARG(base, 1)) - (CZ_ARG(base, 0) < CZ_ARG(base, 1))))
+#define CZ_PUSH_EQ(base)    cz_process_push(p, CZ_TAG(CZ_ARG(base, 0) == CZ_ARG(base, 1)))
+#define CZ_PUSH_LT(base)    cz_process_push(p, CZ_TAG(CZ_ARG(base, 0) < CZ_ARG(base, 1)))
+
+/* Constructors without fields, such as booleans, are immediates too, with 010 as their low bits. Others
+   are allocated. */
+
+#define CZ_TAG(tag)         ((cz_value_t)(((intptr_t)(tag) << 3) | 2))
+
+#define CZ_PUSH_TAG(tag)                cz_process_push(p, CZ_TAG(tag))
+#define CZ_PUSH_CON(tag, base, argc)    cz_process_con(p, tag, p->frame + base, argc)
+#define CZ_SWITCH(base, argc)           cz_process_switch(p, p->frame + base, argc)
+
+/* Recursive functions capture placeholders for each other, which are replaced once they all exist.
+   Placeholders have 110 as their low bits, which no integer, constructor or pointer has. */
+
+#define CZ_REC(var)         ((cz_value_t)(((intptr_t)(var) << 3) | 6))
+#define CZ_IS_REC(x)        (((intptr_t)(x) & 7) == 6)
+#define CZ_REC_VAR(x)       ((intptr_t)(x) >> 3)
+
+#define CZ_PUSH_REC(var)    cz_process_push(p, CZ_REC(var))
+#define CZ_TIE(base, count) cz_process_tie(p, p->frame + base, count)
+
 #define CZ_BLOCK_TYPE 1
\ No newline at end of file
@@ -0,0 +1,15 @@
+#include "cz.h"
+
+/* A function is its block followed by the values of its free variables. */
+
+void cz_process_tie(cz_process_t *p, cz_value_t *base, int count) {
+    for (int i = 0; i < count; i++) {
+        cz_value_t *fn = base[i];
+        cz_block_t *block = fn[0];
+        for (int j = 1; j <= block->closure; j++) {
+            if (CZ_IS_REC(fn[j])) {
+                fn[j] = base[CZ_REC_VAR(fn[j])];
+            }
+        }
+    }
+}
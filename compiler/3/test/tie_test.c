@@ -0,0 +1,32 @@
+#include <stdio.h>
+#include "cz.h"
+
+static int failed = 0;
+
+static void expect(const char *what, cz_value_t got, cz_value_t want) {
+    if (got != want) {
+        printf("%s: got %p, expecting %p\n", what, got, want);
+        failed = 1;
+    }
+}
+
+/* Ties a pair of functions that refer to each other, one of which also holds integers and a
+   constructor that must be left alone. */
+int main(void) {
+    cz_block_t even = {.type = CZ_BLOCK_TYPE, .closure = 4};
+    cz_block_t odd = {.type = CZ_BLOCK_TYPE, .closure = 1};
+
+    cz_value_t f[] = {&even, CZ_INT(1), CZ_INT(3), CZ_TAG(0), CZ_REC(1)};
+    cz_value_t g[] = {&odd, CZ_REC(0)};
+    cz_value_t frame[] = {f, g};
+    cz_process_t p = {.frame = frame};
+
+    cz_process_tie(&p, frame, 2);
+
+    expect("integer 1", f[1], CZ_INT(1));
+    expect("integer 3", f[2], CZ_INT(3));
+    expect("constructor", f[3], CZ_TAG(0));
+    expect("odd in even", f[4], g);
+    expect("even in odd", g[1], f);
+    return failed;
+}